@@ -71,6 +71,7 @@ func (handler *ExecHandlersImpl) Configure(api *operations.PortLayerAPI, netCtx
 		ClusterPath:    options.PortLayerOptions.ClusterPath,
 		DatastorePath:  options.PortLayerOptions.DatastorePath,
 		NetworkPath:    options.PortLayerOptions.NetworkPath,
+		RequireAll:     true,
 	}
 
 	execSession, err = session.NewSession(sessionconfig).Create(ctx)
@@ -57,6 +57,7 @@ func (handler *StorageHandlersImpl) Configure(api *operations.PortLayerAPI, netC
 		ClusterPath:    options.PortLayerOptions.ClusterPath,
 		DatastorePath:  options.PortLayerOptions.DatastorePath,
 		NetworkPath:    options.PortLayerOptions.NetworkPath,
+		RequireAll:     true,
 	}
 
 	storageSession, err = session.NewSession(sessionconfig).Create(ctx)
@@ -412,6 +412,9 @@ func (r dlogReader) open() (entry, error) {
 func client() (*session.Session, error) {
 	ctx := context.Background()
 
+	// the datastore is needed whether or not -ds was given
+	config.RequireAll = true
+
 	session := session.NewSession(&config.Config)
 	_, err := session.Connect(ctx)
 	if err != nil {
@@ -0,0 +1,60 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// CreateAll creates a session for each of configs, as Create does, with at most
+// concurrency of them being created at once, or all of them if concurrency isn't
+// positive. The sessions and errors are returned by position in configs, with each
+// failure leaving a nil session and not affecting the rest. Once ctx is done
+// those still being created fail along with it, and the rest aren't attempted.
+func CreateAll(ctx context.Context, configs []*Config, concurrency int) ([]*Session, []error) {
+	sessions := make([]*Session, len(configs))
+	errs := make([]error, len(configs))
+
+	if concurrency <= 0 || concurrency > len(configs) {
+		concurrency = len(configs)
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range work {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				sessions[i], errs[i] = NewSession(configs[i]).Create(ctx)
+			}
+		}()
+	}
+
+	for i := range configs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	return sessions, errs
+}
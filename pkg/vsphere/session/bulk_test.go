@@ -0,0 +1,70 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestCreateAll(t *testing.T) {
+	server := serviceContentServer()
+	defer server.Close()
+
+	service := "root:pass@" + strings.TrimPrefix(server.URL, "https://") + "/sdk"
+	configs := []*Config{
+		{Service: service, Insecure: true},
+		{},
+		{Service: service, Insecure: true},
+	}
+
+	ctx := context.Background()
+
+	sessions, errs := CreateAll(ctx, configs, 2)
+	if assert.Len(t, sessions, 3) && assert.Len(t, errs, 3) {
+		assert.NoError(t, errs[0])
+		assert.NotNil(t, sessions[0])
+
+		// an invalid config fails on its own
+		assert.Error(t, errs[1])
+		assert.Nil(t, sessions[1])
+
+		assert.NoError(t, errs[2])
+		assert.NotNil(t, sessions[2])
+	}
+
+	for _, s := range sessions {
+		if s != nil {
+			s.Logout(ctx)
+		}
+	}
+
+	// nothing is attempted once ctx is done
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	sessions, errs = CreateAll(cctx, configs, 0)
+	for i := range configs {
+		assert.Nil(t, sessions[i])
+		assert.Equal(t, context.Canceled, errs[i])
+	}
+
+	sessions, errs = CreateAll(ctx, nil, 4)
+	assert.Empty(t, sessions)
+	assert.Empty(t, errs)
+}
@@ -0,0 +1,114 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/net/context"
+)
+
+// sessionCache is the content of Config.SessionCacheFile, the session cookies
+// for each target keyed by sessionCacheKey
+type sessionCache map[string][]*http.Cookie
+
+// sessionCacheKey returns the cache key for user's session with service. The
+// key is hashed so that the file doesn't list the targets and users within it.
+func sessionCacheKey(service *url.URL, user *url.Userinfo) string {
+	name := ""
+	if user != nil {
+		name = user.Username()
+	}
+
+	sum := sha256.Sum256([]byte(name + "@" + service.Host + service.Path))
+	return hex.EncodeToString(sum[:])
+}
+
+// readSessionCache returns the cache in path, which is empty if the file
+// doesn't exist or cannot be parsed
+func readSessionCache(path string) sessionCache {
+	cache := sessionCache{}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+
+	if err = json.Unmarshal(b, &cache); err != nil {
+		return sessionCache{}
+	}
+	return cache
+}
+
+// restoreSession loads any cached cookie for user into the client, returning
+// whether the server still considers that session active
+func (s *Session) restoreSession(ctx context.Context, u *url.URL, user *url.Userinfo) bool {
+	cookies, ok := readSessionCache(s.SessionCacheFile)[sessionCacheKey(u, user)]
+	if !ok {
+		return false
+	}
+
+	sc := s.Client.Client.Client
+	sc.Jar.SetCookies(sc.URL(), cookies)
+
+	err := s.bounded(ctx, "session restore", func(ctx context.Context) error {
+		_, err := s.UserSession(ctx)
+		return err
+	})
+	return err == nil
+}
+
+// saveSession records the client's current session cookie for user, leaving
+// the entries for other targets untouched. The file is only readable by the
+// owner as the cookie grants access to the session.
+func (s *Session) saveSession(u *url.URL, user *url.Userinfo) error {
+	cache := readSessionCache(s.SessionCacheFile)
+
+	sc := s.Client.Client.Client
+	cache[sessionCacheKey(u, user)] = sc.Jar.Cookies(sc.URL())
+
+	b, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	// write and rename so that concurrent readers never see a partial file
+	f, err := ioutil.TempFile(filepath.Dir(s.SessionCacheFile), filepath.Base(s.SessionCacheFile))
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(b); err == nil {
+		err = f.Chmod(0600)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), s.SessionCacheFile)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
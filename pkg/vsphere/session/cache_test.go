@@ -0,0 +1,119 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/vic/pkg/vsphere/test/env"
+)
+
+func TestSessionCacheKey(t *testing.T) {
+	u, _ := url.Parse("https://vc.example.com/sdk")
+	other, _ := url.Parse("https://esx.example.com/sdk")
+
+	key := sessionCacheKey(u, url.UserPassword("root", "secret"))
+
+	// the password doesn't select the session, the user and target do
+	assert.Equal(t, key, sessionCacheKey(u, url.UserPassword("root", "changed")))
+	assert.NotEqual(t, key, sessionCacheKey(u, url.User("admin")))
+	assert.NotEqual(t, key, sessionCacheKey(other, url.User("root")))
+	assert.NotEqual(t, key, sessionCacheKey(u, nil))
+}
+
+func TestSaveSession(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session-cache")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	vc, _ := url.Parse("https://vc.example.com/sdk")
+	esx, _ := url.Parse("https://esx.example.com/sdk")
+	path := filepath.Join(dir, "sessions.json")
+
+	save := func(u *url.URL, value string) {
+		sc := soap.NewClient(u, true)
+		sc.Jar.SetCookies(u, []*http.Cookie{{Name: "vmware_soap_session", Value: value}})
+
+		s := NewSession(&Config{SessionCacheFile: path})
+		s.Client = &govmomi.Client{Client: &vim25.Client{Client: sc}}
+		assert.NoError(t, s.saveSession(u, url.User("root")))
+	}
+
+	save(vc, "vc-session")
+	save(esx, "esx-session")
+
+	info, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// both targets are cached side by side
+	cache := readSessionCache(path)
+	if assert.Len(t, cache, 2) {
+		assert.Equal(t, "vc-session", cache[sessionCacheKey(vc, url.User("root"))][0].Value)
+		assert.Equal(t, "esx-session", cache[sessionCacheKey(esx, url.User("root"))][0].Value)
+	}
+}
+
+func TestSessionCacheReuse(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "session-cache")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	config := &Config{
+		Service:          env.URL(t),
+		Insecure:         true,
+		SessionCacheFile: filepath.Join(dir, "sessions.json"),
+	}
+
+	first, err := NewSession(config).Connect(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	us, err := first.UserSession(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	second, err := NewSession(config).Connect(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	reused, err := second.UserSession(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, us.Key, reused.Key, "Expected the cached session to be reused")
+	}
+
+	first.Logout(ctx)
+}
@@ -0,0 +1,182 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net/url"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// CloneWithCredentials returns a new session connected to the service s is, but
+// logged in as username, with the resources s resolved cached rather than looked
+// up again. The clone has a client of its own, so either may be logged out while
+// the other carries on. Resources username isn't permitted to see only fail once
+// used, as the references aren't checked.
+func (s *Session) CloneWithCredentials(ctx context.Context, username, password string) (*Session, error) {
+	s.l.RLock()
+	service := s.ActiveService
+	s.l.RUnlock()
+	if service == "" {
+		service = s.Service
+	}
+
+	u, err := parseService(service)
+	if err != nil {
+		return nil, withKind(ErrURLParse, errors.Errorf("SDK URL (%s) could not be parsed: %s", redactService(service), err))
+	}
+	u.User = url.UserPassword(username, password)
+
+	config := *s.Config
+	config.Service = u.String()
+	config.Services = nil
+	// any other means of logging in would take precedence over the credentials
+	config.Token = ""
+	config.SessionTicket = ""
+	config.STSIssueToken = false
+	config.CertFile = ""
+	config.KeyFile = ""
+	config.SessionCacheFile = ""
+	config.ShareClient = false
+
+	clone := NewSession(&config)
+	if _, err = clone.Connect(ctx); err != nil {
+		return nil, err
+	}
+
+	c := clone.Vim25()
+
+	src := &Session{}
+	s.l.RLock()
+	src.copyResources(s)
+	s.l.RUnlock()
+
+	clone.l.Lock()
+	clone.rebind(src, c)
+	if clone.Datacenter != nil && clone.scopeFinder() {
+		clone.Finder.SetDatacenter(clone.Datacenter)
+	}
+	clone.l.Unlock()
+
+	clone.copyCaps(s)
+
+	return clone, nil
+}
+
+// rebind caches the resources of src bound to c, and must be called with the
+// write lock held
+func (s *Session) rebind(src *Session, c *vim25.Client) {
+	if src.Cluster != nil {
+		cluster := *src.Cluster
+		cluster.Common = object.NewCommon(c, cluster.Reference())
+		s.Cluster = &cluster
+	}
+	if src.Datacenter != nil {
+		s.Datacenter = object.NewDatacenter(c, src.Datacenter.Reference())
+	}
+
+	s.Datastores = nil
+	for _, ds := range src.Datastores {
+		s.Datastores = append(s.Datastores, rebindDatastore(ds, c))
+	}
+	if src.Datastore != nil {
+		s.Datastore = rebindDatastore(src.Datastore, c)
+		// Datastore is the first of Datastores, so keep it so
+		if len(s.Datastores) > 0 && s.Datastores[0].Reference() == s.Datastore.Reference() {
+			s.Datastore = s.Datastores[0]
+		}
+	}
+
+	if src.Host != nil {
+		host := *src.Host
+		host.Common = object.NewCommon(c, host.Reference())
+		s.Host = &host
+	}
+
+	s.Networks = nil
+	for _, network := range src.Networks {
+		s.Networks = append(s.Networks, rebindNetwork(network, c))
+	}
+	if src.Network != nil {
+		s.Network = rebindNetwork(src.Network, c)
+		if len(s.Networks) > 0 && s.Networks[0].Reference() == s.Network.Reference() {
+			s.Network = s.Networks[0]
+		}
+	}
+
+	if src.Pool != nil {
+		s.Pool = rebindPool(src.Pool, c)
+	}
+	if src.VMFolder != nil {
+		s.VMFolder = rebindFolder(src.VMFolder, c)
+	}
+	if src.DVS != nil {
+		dvs := *src.DVS
+		dvs.Common = object.NewCommon(c, dvs.Reference())
+		s.DVS = &dvs
+	}
+	if src.StoragePod != nil {
+		s.StoragePod = &object.StoragePod{Folder: rebindFolder(src.StoragePod.Folder, c)}
+	}
+	if src.VirtualApp != nil {
+		s.VirtualApp = &object.VirtualApp{ResourcePool: rebindPool(src.VirtualApp.ResourcePool, c)}
+	}
+}
+
+func rebindDatastore(ds *object.Datastore, c *vim25.Client) *object.Datastore {
+	d := *ds
+	d.Common = object.NewCommon(c, d.Reference())
+	return &d
+}
+
+func rebindPool(pool *object.ResourcePool, c *vim25.Client) *object.ResourcePool {
+	p := *pool
+	p.Common = object.NewCommon(c, p.Reference())
+	return &p
+}
+
+func rebindFolder(folder *object.Folder, c *vim25.Client) *object.Folder {
+	f := *folder
+	f.Common = object.NewCommon(c, f.Reference())
+	return &f
+}
+
+// rebindNetwork returns network bound to c, keeping the inventory path of the
+// types that record it
+func rebindNetwork(network object.NetworkReference, c *vim25.Client) object.NetworkReference {
+	switch n := network.(type) {
+	case *object.Network:
+		r := *n
+		r.Common = object.NewCommon(c, r.Reference())
+		return &r
+	case *object.DistributedVirtualPortgroup:
+		r := *n
+		r.Common = object.NewCommon(c, r.Reference())
+		return &r
+	}
+
+	ref := network.Reference()
+	if !referenceTypes[ref.Type] {
+		return network
+	}
+	if n, ok := object.NewReference(c, ref).(object.NetworkReference); ok {
+		return n
+	}
+	return network
+}
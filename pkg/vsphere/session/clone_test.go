@@ -0,0 +1,110 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestCloneWithCredentials(t *testing.T) {
+	var mu sync.Mutex
+	var users []string
+	userName := regexp.MustCompile(`<userName>([^<]*)</userName>`)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		w.Header().Set("Content-Type", "text/xml")
+		switch {
+		case strings.Contains(string(body), "<RetrieveServiceContent "):
+			w.Write([]byte(serviceContentResponse))
+		case strings.Contains(string(body), "<Login "):
+			mu.Lock()
+			if m := userName.FindSubmatch(body); m != nil {
+				users = append(users, string(m[1]))
+			}
+			mu.Unlock()
+			w.Write([]byte(loginResponse))
+		case strings.Contains(string(body), "<Logout "):
+			w.Write([]byte(logoutResponse))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(notImplementedFault))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	s, err := NewSession(&Config{
+		Service:  "root:pass@" + strings.TrimPrefix(server.URL, "https://") + "/sdk",
+		Insecure: true,
+	}).Connect(ctx)
+	require.NoError(t, err)
+
+	c := s.Vim25()
+	s.Datacenter = object.NewDatacenter(c, types.ManagedObjectReference{Type: "Datacenter", Value: "datacenter-2"})
+	s.Datastore = object.NewDatastore(c, types.ManagedObjectReference{Type: "Datastore", Value: "datastore-42"})
+	s.Datastore.InventoryPath = "/dc1/datastore/ds1"
+	s.Datastores = []*object.Datastore{s.Datastore}
+	pg := object.NewDistributedVirtualPortgroup(c, types.ManagedObjectReference{Type: "DistributedVirtualPortgroup", Value: "dvportgroup-9"})
+	pg.InventoryPath = "/dc1/network/pg1"
+	s.Network = pg
+	s.Networks = []object.NetworkReference{pg}
+
+	clone, err := s.CloneWithCredentials(ctx, "alice", "secret")
+	require.NoError(t, err)
+
+	mu.Lock()
+	assert.Equal(t, []string{"root", "alice"}, users)
+	mu.Unlock()
+	assert.NotContains(t, clone.Service, "root")
+
+	// the resources are those of s, bound to the clone's client
+	cc := clone.Vim25()
+	assert.True(t, cc != c, "expected a client of its own")
+	if assert.NotNil(t, clone.Datastore) {
+		assert.Equal(t, s.Datastore.Reference(), clone.Datastore.Reference())
+		assert.Equal(t, "/dc1/datastore/ds1", clone.Datastore.InventoryPath)
+		assert.True(t, clone.Datastore.Client() == cc)
+		assert.True(t, clone.Datastores[0] == clone.Datastore)
+	}
+	if assert.NotNil(t, clone.Datacenter) {
+		assert.True(t, clone.Datacenter.Client() == cc)
+	}
+	if n, ok := clone.Network.(*object.DistributedVirtualPortgroup); assert.True(t, ok) {
+		assert.Equal(t, "/dc1/network/pg1", n.InventoryPath)
+		assert.True(t, n.Client() == cc)
+	}
+	assert.True(t, s.Datastore.Client() == c, "the parent's resources were rebound")
+
+	// and logging out of the clone leaves s be
+	assert.NoError(t, clone.Logout(ctx))
+	assert.False(t, clone.IsConnected())
+	assert.True(t, s.IsConnected())
+	assert.NotNil(t, s.GetDatastore())
+}
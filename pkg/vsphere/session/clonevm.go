@@ -0,0 +1,113 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// CloneOptions adjusts the clones made by CloneVM. Targets left nil default to
+// the cached resources.
+type CloneOptions struct {
+	Folder    *object.Folder
+	Pool      *object.ResourcePool
+	Host      *object.HostSystem
+	Datastore *object.Datastore
+
+	// Linked clones share the disks of the current snapshot of the source,
+	// only writing their changes to disks of their own
+	Linked bool
+
+	// PowerOn powers the clone on once it's created
+	PowerOn bool
+}
+
+// CloneVM clones src, typically a template, as a VM named name in the cached
+// VMFolder, Pool and Host and on the cached Datastore, save for those opts
+// overrides, waiting for the clone to complete. A folder is required, while
+// the other targets default to those of src if neither cached nor given.
+func (s *Session) CloneVM(ctx context.Context, src *object.VirtualMachine, name string, opts CloneOptions) (*object.VirtualMachine, error) {
+	client := s.client()
+	if client == nil {
+		return nil, ErrSessionExpired
+	}
+
+	location, folder, _ := s.placement(false)
+
+	if opts.Folder != nil {
+		folder = opts.Folder
+	}
+	if folder == nil {
+		return nil, errors.Errorf("No folder to clone %s into", name)
+	}
+
+	if opts.Pool != nil {
+		ref := opts.Pool.Reference()
+		location.Pool = &ref
+	}
+	if opts.Host != nil {
+		ref := opts.Host.Reference()
+		location.Host = &ref
+	}
+	if opts.Datastore != nil {
+		ref := opts.Datastore.Reference()
+		location.Datastore = &ref
+	}
+
+	spec := types.VirtualMachineCloneSpec{
+		Location: location,
+		PowerOn:  opts.PowerOn,
+	}
+
+	if opts.Linked {
+		var vm mo.VirtualMachine
+		if err := src.Properties(ctx, src.Reference(), []string{"snapshot"}, &vm); err != nil {
+			return nil, err
+		}
+
+		if vm.Snapshot == nil || vm.Snapshot.CurrentSnapshot == nil {
+			return nil, errors.Errorf("Unable to make a linked clone of %s as it has no snapshot", src.Reference())
+		}
+
+		spec.Snapshot = vm.Snapshot.CurrentSnapshot
+		spec.Location.DiskMoveType = string(types.VirtualMachineRelocateDiskMoveOptionsCreateNewChildDiskBacking)
+	}
+
+	t, err := src.Clone(ctx, folder, name, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.WaitForTask(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, ok := info.Result.(types.ManagedObjectReference)
+	if !ok {
+		return nil, errors.Errorf("Clone of %s returned no VM", name)
+	}
+
+	vm := object.NewVirtualMachine(client.Client, ref)
+	if folder.InventoryPath != "" {
+		vm.InventoryPath = folder.InventoryPath + "/" + name
+	}
+	return vm, nil
+}
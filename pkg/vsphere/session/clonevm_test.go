@@ -0,0 +1,129 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// cloneRoundTripper answers CloneVM_Task, recording the request, and the
+// retrieval of the source's snapshot, leaving the task wait to taskRoundTripper
+type cloneRoundTripper struct {
+	taskRoundTripper
+
+	snapshot *types.ManagedObjectReference
+	req      *types.CloneVM_Task
+}
+
+func (f *cloneRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	switch res := res.(type) {
+	case *methods.CloneVM_TaskBody:
+		f.req = req.(*methods.CloneVM_TaskBody).Req
+		res.Res = &types.CloneVM_TaskResponse{Returnval: types.ManagedObjectReference{Type: "Task", Value: "task-1"}}
+	case *methods.RetrievePropertiesBody:
+		var props []types.DynamicProperty
+		if f.snapshot != nil {
+			info := types.VirtualMachineSnapshotInfo{CurrentSnapshot: f.snapshot}
+			props = append(props, types.DynamicProperty{Name: "snapshot", Val: info})
+		}
+
+		res.Res = &types.RetrievePropertiesResponse{
+			Returnval: []types.ObjectContent{{Obj: types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-1"}, PropSet: props}},
+		}
+	default:
+		return f.taskRoundTripper.RoundTrip(ctx, req, res)
+	}
+	return nil
+}
+
+func cloneSession() (*Session, *cloneRoundTripper, *object.VirtualMachine) {
+	clone := types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-2"}
+	rt := &cloneRoundTripper{
+		taskRoundTripper: taskRoundTripper{infos: []types.TaskInfo{{State: types.TaskInfoStateSuccess, Result: clone}}},
+	}
+	client := &vim25.Client{RoundTripper: rt}
+
+	s := NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+	return s, rt, object.NewVirtualMachine(client, types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-1"})
+}
+
+func TestCloneVM(t *testing.T) {
+	ctx := context.Background()
+	s, rt, src := cloneSession()
+	c := s.Vim25()
+
+	_, err := s.CloneVM(ctx, src, "clone", CloneOptions{})
+	assert.Error(t, err, "expected a failure without a folder")
+
+	s.VMFolder = object.NewFolder(c, types.ManagedObjectReference{Type: "Folder", Value: "group-v1"})
+	s.VMFolder.InventoryPath = "/dc1/vm"
+	s.Pool = object.NewResourcePool(c, types.ManagedObjectReference{Type: "ResourcePool", Value: "resgroup-1"})
+	s.Datastore = object.NewDatastore(c, types.ManagedObjectReference{Type: "Datastore", Value: "datastore-1"})
+
+	vm, err := s.CloneVM(ctx, src, "clone", CloneOptions{PowerOn: true})
+	require.NoError(t, err)
+	assert.Equal(t, "vm-2", vm.Reference().Value)
+	assert.Equal(t, "/dc1/vm/clone", vm.InventoryPath)
+
+	req := rt.req
+	assert.Equal(t, "group-v1", req.Folder.Value)
+	assert.Equal(t, "clone", req.Name)
+	assert.Equal(t, "resgroup-1", req.Spec.Location.Pool.Value)
+	assert.Equal(t, "datastore-1", req.Spec.Location.Datastore.Value)
+	assert.Nil(t, req.Spec.Location.Host)
+	assert.Nil(t, req.Spec.Snapshot)
+	assert.True(t, req.Spec.PowerOn)
+}
+
+func TestCloneVMOptions(t *testing.T) {
+	ctx := context.Background()
+	s, rt, src := cloneSession()
+	c := s.Vim25()
+
+	s.VMFolder = object.NewFolder(c, types.ManagedObjectReference{Type: "Folder", Value: "group-v1"})
+	s.Datastore = object.NewDatastore(c, types.ManagedObjectReference{Type: "Datastore", Value: "datastore-1"})
+
+	opts := CloneOptions{
+		Folder:    object.NewFolder(c, types.ManagedObjectReference{Type: "Folder", Value: "group-v2"}),
+		Datastore: object.NewDatastore(c, types.ManagedObjectReference{Type: "Datastore", Value: "datastore-2"}),
+		Linked:    true,
+	}
+
+	_, err := s.CloneVM(ctx, src, "linked", opts)
+	assert.Error(t, err, "expected a linked clone to need a snapshot")
+	assert.Nil(t, rt.req)
+
+	rt.snapshot = &types.ManagedObjectReference{Type: "VirtualMachineSnapshot", Value: "snapshot-1"}
+	vm, err := s.CloneVM(ctx, src, "linked", opts)
+	require.NoError(t, err)
+	assert.Empty(t, vm.InventoryPath)
+
+	req := rt.req
+	assert.Equal(t, "group-v2", req.Folder.Value)
+	assert.Equal(t, "datastore-2", req.Spec.Location.Datastore.Value)
+	assert.Equal(t, rt.snapshot, req.Spec.Snapshot)
+	assert.Equal(t, string(types.VirtualMachineRelocateDiskMoveOptionsCreateNewChildDiskBacking), req.Spec.Location.DiskMoveType)
+}
@@ -0,0 +1,179 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// DRSEnabled returns whether DRS is enabled on the cached cluster
+func (s *Session) DRSEnabled(ctx context.Context) (bool, error) {
+	config, err := s.clusterConfig(ctx)
+	if err != nil {
+		return false, err
+	}
+	return config.DrsConfig.Enabled != nil && *config.DrsConfig.Enabled, nil
+}
+
+// HAEnabled returns whether vSphere HA is enabled on the cached cluster
+func (s *Session) HAEnabled(ctx context.Context) (bool, error) {
+	config, err := s.clusterConfig(ctx)
+	if err != nil {
+		return false, err
+	}
+	return config.DasConfig.Enabled != nil && *config.DasConfig.Enabled, nil
+}
+
+// DRSAutomationLevel returns the default DRS automation level of the cached
+// cluster, which is configured whether or not DRS is enabled
+func (s *Session) DRSAutomationLevel(ctx context.Context) (types.DrsBehavior, error) {
+	config, err := s.clusterConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	return config.DrsConfig.DefaultVmBehavior, nil
+}
+
+// clusterConfig returns the configuration of the cached cluster, retrieved in
+// a single round trip. A standalone host's compute resource is refused, as it
+// has no DRS or HA configuration.
+func (s *Session) clusterConfig(ctx context.Context) (*types.ClusterConfigInfoEx, error) {
+	cluster, err := s.cachedCluster()
+	if err != nil {
+		return nil, err
+	}
+
+	var mc mo.ClusterComputeResource
+	err = s.bounded(ctx, "cluster configuration retrieval", func(ctx context.Context) error {
+		return s.Properties(ctx, cluster.Reference(), []string{"configurationEx"}, &mc)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	config, ok := mc.ConfigurationEx.(*types.ClusterConfigInfoEx)
+	if !ok {
+		return nil, errors.Errorf("%s has no cluster configuration", cluster.InventoryPath)
+	}
+	return config, nil
+}
+
+// cachedCluster returns the cached compute resource if it's a cluster
+func (s *Session) cachedCluster() (*object.ComputeResource, error) {
+	cluster := s.GetCluster()
+	if cluster == nil {
+		return nil, errors.New("No cluster is cached in this session")
+	}
+
+	if cluster.Reference().Type != "ClusterComputeResource" {
+		return nil, errors.Errorf("%s is a standalone host, not a cluster", cluster.InventoryPath)
+	}
+
+	if s.client() == nil {
+		return nil, ErrSessionExpired
+	}
+	return cluster, nil
+}
+
+// RecommendHost returns the host DRS recommends for creating a virtual machine
+// with spec in the cached cluster, on the cached datastore if there is one.
+// Should DRS be disabled, the first of AvailableHosts is returned instead. An
+// error is returned if DRS has no recommendation, with its reasons if given.
+func (s *Session) RecommendHost(ctx context.Context, spec types.VirtualMachineConfigSpec) (*object.HostSystem, error) {
+	cluster, err := s.cachedCluster()
+	if err != nil {
+		return nil, err
+	}
+
+	drs, err := s.DRSEnabled(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !drs {
+		hosts, err := s.AvailableHosts(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(hosts) == 0 {
+			return nil, errors.Errorf("%s has no available hosts", cluster.InventoryPath)
+		}
+		return hosts[0], nil
+	}
+
+	req := types.PlaceVm{
+		This: cluster.Reference(),
+		PlacementSpec: types.PlacementSpec{
+			PlacementType: "create",
+			ConfigSpec:    &spec,
+		},
+	}
+	if ds := s.GetDatastore(); ds != nil {
+		req.PlacementSpec.Datastores = []types.ManagedObjectReference{ds.Reference()}
+	}
+
+	var res *types.PlaceVmResponse
+	err = s.bounded(ctx, "placement recommendation", func(ctx context.Context) (err error) {
+		res, err = methods.PlaceVm(ctx, s.Vim25(), &req)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the recommendations are ordered best first
+	for _, recommendation := range res.Returnval.Recommendations {
+		for _, action := range recommendation.Action {
+			if placement, ok := action.(*types.PlacementAction); ok && placement.TargetHost != nil {
+				return object.NewHostSystem(s.Vim25(), *placement.TargetHost), nil
+			}
+		}
+	}
+
+	return nil, errors.Errorf("DRS made no placement recommendation in %s%s", cluster.InventoryPath, drsFaults(res.Returnval.DrsFault))
+}
+
+// drsFaults returns the reasons DRS gave in faults for being unable to place,
+// formatted to follow an error message, or nothing if it gave none
+func drsFaults(faults *types.ClusterDrsFaults) string {
+	if faults == nil {
+		return ""
+	}
+
+	var reasons []string
+	if faults.Reason != "" {
+		reasons = append(reasons, faults.Reason)
+	}
+	for _, byVM := range faults.FaultsByVm {
+		for _, fault := range byVM.GetClusterDrsFaultsFaultsByVm().Fault {
+			if fault.LocalizedMessage != "" {
+				reasons = append(reasons, fault.LocalizedMessage)
+			}
+		}
+	}
+
+	if len(reasons) == 0 {
+		return ""
+	}
+	return ": " + strings.Join(reasons, "; ")
+}
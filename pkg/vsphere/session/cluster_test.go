@@ -0,0 +1,159 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// clusterRoundTripper answers retrievals of a cluster's configuration and its
+// hosts' state, and DRS placement requests
+type clusterRoundTripper struct {
+	config    types.ClusterConfigInfoEx
+	retrieved int
+
+	placement types.PlacementResult
+	placed    *types.PlacementSpec
+}
+
+func (f *clusterRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	switch body := res.(type) {
+	case *methods.RetrievePropertiesBody:
+		spec := req.(*methods.RetrievePropertiesBody).Req.SpecSet[0]
+		obj := spec.ObjectSet[0].Obj
+
+		props := []types.DynamicProperty{{Name: "configurationEx", Val: &f.config}}
+		if spec.PropSet[0].PathSet[0] == "configurationEx" {
+			f.retrieved++
+		} else {
+			props = []types.DynamicProperty{
+				{Name: "name", Val: obj.Value},
+				{Name: "runtime", Val: types.HostRuntimeInfo{ConnectionState: types.HostSystemConnectionStateConnected}},
+			}
+		}
+
+		body.Res = &types.RetrievePropertiesResponse{
+			Returnval: []types.ObjectContent{{Obj: obj, PropSet: props}},
+		}
+	case *methods.PlaceVmBody:
+		f.placed = &req.(*methods.PlaceVmBody).Req.PlacementSpec
+		body.Res = &types.PlaceVmResponse{Returnval: f.placement}
+	}
+	return nil
+}
+
+func TestClusterConfig(t *testing.T) {
+	ctx := context.Background()
+
+	rt := &clusterRoundTripper{
+		config: types.ClusterConfigInfoEx{
+			DrsConfig: types.ClusterDrsConfigInfo{Enabled: types.NewBool(true), DefaultVmBehavior: types.DrsBehaviorPartiallyAutomated},
+			DasConfig: types.ClusterDasConfigInfo{Enabled: types.NewBool(false)},
+		},
+	}
+	client := &vim25.Client{RoundTripper: rt}
+	s := NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+
+	_, err := s.DRSEnabled(ctx)
+	assert.Error(t, err, "expected a failure without a cluster")
+
+	s.Cluster = object.NewComputeResource(client, types.ManagedObjectReference{Type: "ClusterComputeResource", Value: "domain-c7"})
+
+	drs, err := s.DRSEnabled(ctx)
+	require.NoError(t, err)
+	assert.True(t, drs)
+
+	ha, err := s.HAEnabled(ctx)
+	require.NoError(t, err)
+	assert.False(t, ha)
+
+	level, err := s.DRSAutomationLevel(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, types.DrsBehaviorPartiallyAutomated, level)
+	assert.Equal(t, 3, rt.retrieved)
+
+	// unset is disabled
+	rt.config.DasConfig.Enabled = nil
+	ha, err = s.HAEnabled(ctx)
+	require.NoError(t, err)
+	assert.False(t, ha)
+
+	// standalone hosts have no cluster configuration to fetch
+	s.Cluster = object.NewComputeResource(client, types.ManagedObjectReference{Type: "ComputeResource", Value: "domain-s9"})
+	s.Cluster.InventoryPath = "/dc1/host/esx1"
+	rt.retrieved = 0
+	_, err = s.DRSEnabled(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "/dc1/host/esx1 is a standalone host")
+	}
+	assert.Equal(t, 0, rt.retrieved)
+}
+
+func TestRecommendHost(t *testing.T) {
+	ctx := context.Background()
+
+	host := types.ManagedObjectReference{Type: "HostSystem", Value: "host-12"}
+	rt := &clusterRoundTripper{
+		config: types.ClusterConfigInfoEx{
+			DrsConfig: types.ClusterDrsConfigInfo{Enabled: types.NewBool(true)},
+		},
+		placement: types.PlacementResult{
+			Recommendations: []types.ClusterRecommendation{{
+				Action: []types.BaseClusterAction{&types.PlacementAction{TargetHost: &host}},
+			}},
+		},
+	}
+	client := &vim25.Client{RoundTripper: rt}
+	s := NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+	s.Cluster = object.NewComputeResource(client, types.ManagedObjectReference{Type: "ClusterComputeResource", Value: "domain-c7"})
+	s.Datastore = object.NewDatastore(client, types.ManagedObjectReference{Type: "Datastore", Value: "datastore-42"})
+
+	spec := types.VirtualMachineConfigSpec{Name: "vm1", NumCPUs: 2}
+	h, err := s.RecommendHost(ctx, spec)
+	require.NoError(t, err)
+	assert.Equal(t, host, h.Reference())
+	if assert.NotNil(t, rt.placed) {
+		assert.Equal(t, "create", rt.placed.PlacementType)
+		assert.Equal(t, "vm1", rt.placed.ConfigSpec.Name)
+		assert.Equal(t, []types.ManagedObjectReference{s.Datastore.Reference()}, rt.placed.Datastores)
+	}
+
+	// nothing recommended
+	rt.placement = types.PlacementResult{DrsFault: &types.ClusterDrsFaults{Reason: "Insufficient resources"}}
+	_, err = s.RecommendHost(ctx, spec)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Insufficient resources")
+	}
+
+	// and without DRS the first available host is used
+	rt.placed = nil
+	rt.config.DrsConfig.Enabled = types.NewBool(false)
+	s.Host = object.NewHostSystem(client, types.ManagedObjectReference{Type: "HostSystem", Value: "host-7"})
+	h, err = s.RecommendHost(ctx, spec)
+	require.NoError(t, err)
+	assert.Equal(t, "host-7", h.Reference().Value)
+	assert.Nil(t, rt.placed, "DRS should not be asked")
+}
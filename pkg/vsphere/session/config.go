@@ -0,0 +1,276 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// redacted replaces secrets in anything formatted for display
+const redacted = "xxxxx"
+
+// redactURL returns u as a string with any password masked
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	if u.User == nil {
+		return u.String()
+	}
+
+	if _, ok := u.User.Password(); ok {
+		c := *u
+		c.User = url.UserPassword(u.User.Username(), redacted)
+		return c.String()
+	}
+	return u.String()
+}
+
+// redactService returns service with any password masked. The userinfo is
+// masked entirely if service doesn't parse, as the password cannot be isolated.
+func redactService(service string) string {
+	// without a scheme the userinfo would parse as an opaque URL and go unmasked
+	if u, err := url.Parse(bracketIPv6(service)); err == nil && u.Opaque == "" {
+		return redactURL(u)
+	}
+
+	at := strings.LastIndex(service, "@")
+	if at < 0 {
+		return service
+	}
+
+	start := 0
+	if i := strings.Index(service, "://"); i >= 0 && i < at {
+		start = i + len("://")
+	}
+	return service[:start] + redacted + service[at:]
+}
+
+// bracketIPv6 encloses the host of service in brackets if it's a bare IPv6
+// literal, as it must be in a URL, escaping the % of any zone. Anything else
+// is returned as is.
+func bracketIPv6(service string) string {
+	prefix, rest := "", service
+	if i := strings.Index(rest, "://"); i >= 0 {
+		prefix, rest = rest[:i+len("://")], rest[i+len("://"):]
+	}
+
+	host, suffix := rest, ""
+	if i := strings.Index(host, "/"); i >= 0 {
+		host, suffix = host[:i], host[i:]
+	}
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		prefix, host = prefix+host[:i+1], host[i+1:]
+	}
+
+	addr, zone := host, ""
+	if i := strings.Index(host, "%"); i >= 0 {
+		addr, zone = host[:i], "%25"+host[i+1:]
+	}
+
+	if ip := net.ParseIP(addr); ip == nil || ip.To4() != nil {
+		return service
+	}
+	return prefix + "[" + addr + zone + "]" + suffix
+}
+
+// parseService parses service as soap.ParseURL does, allowing for bare IPv6 literals
+func parseService(service string) (*url.URL, error) {
+	return soap.ParseURL(bracketIPv6(service))
+}
+
+// String returns the configuration in a form that is safe to log, with the
+// passwords in Service and Services, any Token and any SessionTicket masked
+func (c *Config) String() string {
+	// plain has Config's fields but not this method
+	type plain Config
+
+	p := plain(*c)
+	p.Service = redactService(c.Service)
+	if c.Services != nil {
+		// copied, as the slice is shared with c
+		p.Services = make([]string, len(c.Services))
+		for i, service := range c.Services {
+			p.Services[i] = redactService(service)
+		}
+	}
+	if p.Token != "" {
+		p.Token = redacted
+	}
+	if p.SessionTicket != "" {
+		p.SessionTicket = redacted
+	}
+
+	// none are useful to read
+	p.CAData = nil
+	p.KeepaliveHandler = nil
+	p.DialContext = nil
+	p.RoundTripperWrapper = nil
+	p.Metrics = nil
+	p.Resolvers = nil
+	p.DebugWriter = nil
+
+	return fmt.Sprintf("%+v", p)
+}
+
+// ConfigFromEnv returns a Config built from the environment variables used by govc.
+// Variables that aren't set leave the corresponding field at its zero value.
+func ConfigFromEnv() *Config {
+	return &Config{
+		Service:        os.Getenv("GOVC_URL"),
+		Insecure:       truthy(os.Getenv("GOVC_INSECURE")),
+		DatacenterPath: os.Getenv("GOVC_DATACENTER"),
+		DatastorePath:  os.Getenv("GOVC_DATASTORE"),
+		NetworkPath:    os.Getenv("GOVC_NETWORK"),
+		PoolPath:       os.Getenv("GOVC_RESOURCE_POOL"),
+		HostPath:       os.Getenv("GOVC_HOST"),
+		ClusterPath:    os.Getenv("GOVC_CLUSTER"),
+		CertFile:       os.Getenv("GOVC_CERTIFICATE"),
+		KeyFile:        os.Getenv("GOVC_PRIVATE_KEY"),
+	}
+}
+
+// truthy returns whether s is one of the common spellings of true
+func truthy(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "t", "true", "y", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// duration decodes either a duration string such as "5m", or a number of nanoseconds
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	switch value := v.(type) {
+	case string:
+		p, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*d = duration(p)
+	case float64:
+		*d = duration(value)
+	default:
+		return errors.Errorf("invalid duration %s", b)
+	}
+
+	return nil
+}
+
+// configFile is the on disk form of Config, accepting durations as strings.
+// Its fields shadow those of the embedded Config with the same names.
+type configFile struct {
+	Config
+
+	Keepalive          duration `json:"keepalive,omitempty"`
+	ReconnectBaseDelay duration `json:"reconnectBaseDelay,omitempty"`
+	ReconnectMaxDelay  duration `json:"reconnectMaxDelay,omitempty"`
+	OperationTimeout   duration `json:"operationTimeout,omitempty"`
+	ConnectTimeout     duration `json:"connectTimeout,omitempty"`
+	ConnectRetryDelay  duration `json:"connectRetryDelay,omitempty"`
+}
+
+// LoadConfig reads a Config from the JSON or YAML file at path, the format being
+// chosen by the .json, .yaml or .yml extension. Field names are those of the json
+// struct tags on Config, and durations may be given as strings such as "5m".
+// Unrecognized fields are rejected so that typos are caught.
+//
+// The file may hold credentials, so neither its content nor the resulting
+// Config is included in returned errors.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		// the yaml decoder cannot reject unknown fields, so convert to json and let that
+		if b, err = yamlToJSON(b); err != nil {
+			return nil, errors.Errorf("Unable to parse %s: %s", path, err)
+		}
+	default:
+		return nil, errors.Errorf("Unable to determine format of %s from its extension", path)
+	}
+
+	var file configFile
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&file); err != nil {
+		return nil, errors.Errorf("Unable to parse %s: %s", path, err)
+	}
+
+	config := file.Config
+	config.Keepalive = time.Duration(file.Keepalive)
+	config.ReconnectBaseDelay = time.Duration(file.ReconnectBaseDelay)
+	config.ReconnectMaxDelay = time.Duration(file.ReconnectMaxDelay)
+	config.OperationTimeout = time.Duration(file.OperationTimeout)
+	config.ConnectTimeout = time.Duration(file.ConnectTimeout)
+	config.ConnectRetryDelay = time.Duration(file.ConnectRetryDelay)
+
+	return &config, nil
+}
+
+func yamlToJSON(b []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jsonValue(v))
+}
+
+// jsonValue converts the maps produced by the yaml decoder into string keyed maps
+func jsonValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, e := range value {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range value {
+			value[i] = jsonValue(e)
+		}
+		return value
+	default:
+		return v
+	}
+}
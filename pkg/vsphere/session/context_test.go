@@ -0,0 +1,51 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+
+	_, ok := FromContext(ctx)
+	assert.False(t, ok, "expected no session in a bare context")
+
+	s := &Session{Config: &Config{}}
+	got, ok := FromContext(NewContext(ctx, s))
+	assert.True(t, ok)
+	assert.Equal(t, s, got)
+
+	// the session survives derived contexts and can be replaced
+	derived, cancel := context.WithCancel(NewContext(ctx, s))
+	defer cancel()
+	got, _ = FromContext(derived)
+	assert.Equal(t, s, got)
+
+	other := &Session{Config: &Config{}}
+	got, _ = FromContext(NewContext(derived, other))
+	assert.True(t, got == other, "expected the innermost session")
+
+	_, ok = FromContext(NewContext(ctx, nil))
+	assert.False(t, ok, "expected a nil session to be reported as absent")
+
+	// another package's string key of the same name doesn't collide
+	_, ok = FromContext(context.WithValue(ctx, "sessionKey", s))
+	assert.False(t, ok)
+}
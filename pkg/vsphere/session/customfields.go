@@ -0,0 +1,90 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/task"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// CustomFieldsManager returns the custom fields manager of the session client,
+// or object.ErrNotSupported if the server has none, as ESXi doesn't
+func (s *Session) CustomFieldsManager(ctx context.Context) (*object.CustomFieldsManager, error) {
+	client := s.client()
+	if client == nil {
+		return nil, ErrSessionExpired
+	}
+
+	return object.GetCustomFieldsManager(client.Client)
+}
+
+// SetCustomField sets the custom field named key of the entity ref refers to,
+// defining the field for all types of entity if it doesn't exist yet. Should
+// another client define it meanwhile, theirs is used.
+func (s *Session) SetCustomField(ctx context.Context, ref types.ManagedObjectReference, key, value string) error {
+	m, err := s.CustomFieldsManager(ctx)
+	if err != nil {
+		return err
+	}
+
+	k, err := m.FindKey(ctx, key)
+	if err == object.ErrKeyNameNotFound {
+		k, err = s.addCustomField(ctx, m, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	return m.Set(ctx, ref, k, value)
+}
+
+// addCustomField defines the custom field name, returning its key. If it's
+// already defined the key of the existing field is returned.
+func (s *Session) addCustomField(ctx context.Context, m *object.CustomFieldsManager, name string) (int32, error) {
+	def, err := m.Add(ctx, name, "", nil, nil)
+	if err == nil {
+		return def.Key, nil
+	}
+
+	if !isDuplicateName(err) {
+		return -1, err
+	}
+	return m.FindKey(ctx, name)
+}
+
+// isDuplicateName returns whether err is a DuplicateName fault, whether
+// returned by a method or by the task it started
+func isDuplicateName(err error) bool {
+	var fault interface{}
+	switch e := err.(type) {
+	case task.Error:
+		fault = e.Fault()
+	default:
+		if !soap.IsSoapFault(err) {
+			return false
+		}
+		fault = soap.ToSoapFault(err).VimFault()
+	}
+
+	switch fault.(type) {
+	case types.DuplicateName, *types.DuplicateName:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const (
+	setFieldResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><SetFieldResponse xmlns="urn:vim25"></SetFieldResponse></soapenv:Body>
+</soapenv:Envelope>`
+
+	duplicateNameFault = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><soapenv:Fault><faultcode>ServerFaultCode</faultcode><faultstring>The name already exists.</faultstring><detail><DuplicateNameFault xmlns="urn:vim25" xsi:type="DuplicateName" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><name>team</name><object type="CustomFieldsManager">CustomFieldsManager</object></DuplicateNameFault></detail></soapenv:Fault></soapenv:Body>
+</soapenv:Envelope>`
+)
+
+// fieldsServer is a VC with a custom fields manager. If racing is set each
+// field added is taken to have been defined by another client just before.
+type fieldsServer struct {
+	mu     sync.Mutex
+	fields map[string]int32
+	racing bool
+	set    []string
+}
+
+var (
+	fieldNameRE = regexp.MustCompile(`<name>([^<]*)</name>`)
+	setFieldRE  = regexp.MustCompile(`<entity type="[^"]*">([^<]*)</entity><key>([^<]*)</key><value>([^<]*)</value>`)
+)
+
+func (f *fieldsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/xml")
+	switch {
+	case strings.Contains(string(body), "<RetrieveServiceContent "):
+		w.Write([]byte(strings.Replace(serviceContentResponse, "</returnval></RetrieveServiceContentResponse>",
+			`<customFieldsManager type="CustomFieldsManager">CustomFieldsManager</customFieldsManager></returnval></RetrieveServiceContentResponse>`, 1)))
+	case strings.Contains(string(body), "<Login "):
+		w.Write([]byte(loginResponse))
+	case strings.Contains(string(body), "<Logout "):
+		w.Write([]byte(logoutResponse))
+	case strings.Contains(string(body), "<RetrieveProperties ") && strings.Contains(string(body), "CustomFieldsManager"):
+		var defs string
+		for name, key := range f.fields {
+			defs += fmt.Sprintf("<CustomFieldDef><key>%d</key><name>%s</name><type>string</type></CustomFieldDef>", key, name)
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<soapenv:Body><RetrievePropertiesResponse xmlns="urn:vim25"><returnval><obj type="CustomFieldsManager">CustomFieldsManager</obj>
+<propSet><name>field</name><val xsi:type="ArrayOfCustomFieldDef">%s</val></propSet></returnval></RetrievePropertiesResponse></soapenv:Body>
+</soapenv:Envelope>`, defs)
+	case strings.Contains(string(body), "<AddCustomFieldDef "):
+		name := fieldNameRE.FindStringSubmatch(string(body))[1]
+		key := int32(100 + len(f.fields))
+		f.fields[name] = key
+
+		if f.racing {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(duplicateNameFault))
+			return
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><AddCustomFieldDefResponse xmlns="urn:vim25"><returnval><key>%d</key><name>%s</name><type>string</type></returnval></AddCustomFieldDefResponse></soapenv:Body>
+</soapenv:Envelope>`, key, name)
+	case strings.Contains(string(body), "<SetField "):
+		m := setFieldRE.FindStringSubmatch(string(body))
+		f.set = append(f.set, strings.Join(m[1:], " "))
+		w.Write([]byte(setFieldResponse))
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(notImplementedFault))
+	}
+}
+
+func TestSetCustomField(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewSession(&Config{}).CustomFieldsManager(ctx)
+	assert.Equal(t, ErrSessionExpired, err)
+
+	f := &fieldsServer{fields: map[string]int32{"owner": 99}}
+	server := httptest.NewTLSServer(f)
+	defer server.Close()
+
+	config := &Config{Service: "root:pass@" + strings.TrimPrefix(server.URL, "https://") + "/sdk", Insecure: true}
+	s, err := NewSession(config).Connect(ctx)
+	require.NoError(t, err)
+	defer s.Logout(ctx)
+
+	vm := types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-42"}
+
+	// an existing field is set by its key
+	assert.NoError(t, s.SetCustomField(ctx, vm, "owner", "alice"))
+
+	// a missing one is defined first
+	assert.NoError(t, s.SetCustomField(ctx, vm, "project", "vic"))
+
+	// even if another client beats us to it
+	f.mu.Lock()
+	f.racing = true
+	f.mu.Unlock()
+	assert.NoError(t, s.SetCustomField(ctx, vm, "team", "core"))
+
+	f.mu.Lock()
+	assert.Equal(t, []string{"vm-42 99 alice", "vm-42 101 vic", "vm-42 102 core"}, f.set)
+	f.racing = false
+	f.mu.Unlock()
+
+	// a read only session can neither define fields nor set them
+	ro := &Config{Service: config.Service, Insecure: true, ReadOnly: true}
+	s, err = NewSession(ro).Connect(ctx)
+	require.NoError(t, err)
+	defer s.Logout(ctx)
+
+	assert.Equal(t, ErrReadOnly, s.SetCustomField(ctx, vm, "owner", "bob"))
+	assert.Equal(t, ErrReadOnly, s.SetCustomField(ctx, vm, "site", "west"))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	assert.Len(t, f.set, 3)
+	_, ok := f.fields["site"]
+	assert.False(t, ok, "Expected the field not to be defined")
+}
+
+func TestCustomFieldsManagerUnsupported(t *testing.T) {
+	server := serviceContentServer()
+	defer server.Close()
+
+	config := &Config{Service: "root:pass@" + strings.TrimPrefix(server.URL, "https://") + "/sdk", Insecure: true}
+	s, err := NewSession(config).Connect(context.Background())
+	require.NoError(t, err)
+	defer s.Logout(context.Background())
+
+	// servers without a manager
+	_, err = s.CustomFieldsManager(context.Background())
+	assert.Equal(t, object.ErrNotSupported, err)
+}
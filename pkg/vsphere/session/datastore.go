@@ -0,0 +1,122 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// RecommendedDatastore asks Storage DRS to place spec within the cached datastore
+// cluster and returns the datastore of the first recommendation. The cluster is
+// filled in on spec if it doesn't already name one.
+func (s *Session) RecommendedDatastore(ctx context.Context, spec types.StoragePlacementSpec) (*object.Datastore, error) {
+	pod := s.GetStoragePod()
+	if pod == nil && spec.PodSelectionSpec.StoragePod == nil {
+		return nil, errors.New("No datastore cluster is cached in this session")
+	}
+
+	if spec.PodSelectionSpec.StoragePod == nil {
+		ref := pod.Reference()
+		spec.PodSelectionSpec.StoragePod = &ref
+	}
+
+	srm := object.NewStorageResourceManager(s.Vim25())
+	result, err := srm.RecommendDatastores(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range result.Recommendations {
+		for _, action := range r.Action {
+			if placement, ok := action.(*types.StoragePlacementAction); ok {
+				return object.NewDatastore(s.Vim25(), placement.Destination), nil
+			}
+		}
+	}
+
+	return nil, errors.New("Storage DRS made no placement recommendation")
+}
+
+// DatastoreSummary returns the current summary of ds, or of the cached
+// datastore if ds is nil, including its capacity and free space. Nothing is
+// cached as the free space changes constantly.
+func (s *Session) DatastoreSummary(ctx context.Context, ds *object.Datastore) (*types.DatastoreSummary, error) {
+	if ds == nil {
+		if ds = s.GetDatastore(); ds == nil {
+			return nil, errors.New("No datastore is cached in this session")
+		}
+	}
+
+	if s.client() == nil {
+		return nil, ErrSessionExpired
+	}
+
+	var mds mo.Datastore
+	if err := s.Properties(ctx, ds.Reference(), []string{"summary"}, &mds); err != nil {
+		return nil, err
+	}
+	return &mds.Summary, nil
+}
+
+// DatastoreFreeBytes returns the free space of the cached datastore in bytes
+func (s *Session) DatastoreFreeBytes(ctx context.Context) (int64, error) {
+	summary, err := s.DatastoreSummary(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	return summary.FreeSpace, nil
+}
+
+// DatastoreFilePath returns relative as a path on the cached datastore, in the
+// "[datastore] path/to/file" form, or "" if no datastore with a known name is
+// cached. A leading / on relative is dropped. It isn't named DatastorePath as
+// that is the Config field.
+func (s *Session) DatastoreFilePath(relative string) string {
+	ds := s.GetDatastore()
+	if ds == nil || ds.InventoryPath == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("[%s] %s", ds.Name(), strings.TrimPrefix(relative, "/"))
+}
+
+// DatastoreURL returns the URL at which relative, a path on the cached
+// datastore, can be transferred directly over HTTP(S) by the session's client
+func (s *Session) DatastoreURL(ctx context.Context, relative string) (*url.URL, error) {
+	ds := s.GetDatastore()
+	if ds == nil {
+		return nil, errors.New("No datastore is cached in this session")
+	}
+
+	dc := s.GetDatacenter()
+	if dc == nil {
+		return nil, errors.New("No datacenter is cached in this session")
+	}
+
+	if s.client() == nil {
+		return nil, ErrSessionExpired
+	}
+
+	return ds.URL(ctx, dc, strings.TrimPrefix(relative, "/"))
+}
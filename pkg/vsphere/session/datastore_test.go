@@ -0,0 +1,165 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/vsphere/test/env"
+)
+
+// placementRoundTripper answers RecommendDatastores with actions, recording the spec
+type placementRoundTripper struct {
+	actions []types.BaseClusterAction
+	spec    *types.StoragePlacementSpec
+}
+
+func (f *placementRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	f.spec = &req.(*methods.RecommendDatastoresBody).Req.StorageSpec
+
+	result := types.StoragePlacementResult{}
+	if len(f.actions) > 0 {
+		result.Recommendations = []types.ClusterRecommendation{{Key: "1", Action: f.actions}}
+	}
+	res.(*methods.RecommendDatastoresBody).Res = &types.RecommendDatastoresResponse{Returnval: result}
+	return nil
+}
+
+func TestRecommendedDatastore(t *testing.T) {
+	ctx := context.Background()
+
+	srm := types.ManagedObjectReference{Type: "StorageResourceManager", Value: "StorageResourceManager"}
+	rt := &placementRoundTripper{}
+	client := &vim25.Client{RoundTripper: rt, ServiceContent: types.ServiceContent{StorageResourceManager: &srm}}
+	s := NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+
+	_, err := s.RecommendedDatastore(ctx, types.StoragePlacementSpec{Type: "create"})
+	assert.Error(t, err, "Expected an error without a datastore cluster")
+
+	s.StoragePod = object.NewStoragePod(client, types.ManagedObjectReference{Type: "StoragePod", Value: "group-p1"})
+
+	_, err = s.RecommendedDatastore(ctx, types.StoragePlacementSpec{Type: "create"})
+	assert.Error(t, err, "Expected an error without a recommendation")
+
+	rt.actions = []types.BaseClusterAction{
+		&types.ClusterAction{Type: "other"},
+		&types.StoragePlacementAction{Destination: types.ManagedObjectReference{Type: "Datastore", Value: "datastore-2"}},
+	}
+	ds, err := s.RecommendedDatastore(ctx, types.StoragePlacementSpec{Type: "create"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "datastore-2", ds.Reference().Value)
+	}
+	assert.Equal(t, "group-p1", rt.spec.PodSelectionSpec.StoragePod.Value, "Expected the cached cluster to be filled in")
+
+	// a cluster named by the spec is kept
+	other := types.ManagedObjectReference{Type: "StoragePod", Value: "group-p2"}
+	_, err = s.RecommendedDatastore(ctx, types.StoragePlacementSpec{Type: "create", PodSelectionSpec: types.StorageDrsPodSelectionSpec{StoragePod: &other}})
+	assert.NoError(t, err)
+	assert.Equal(t, "group-p2", rt.spec.PodSelectionSpec.StoragePod.Value)
+}
+
+func TestDatastoreSummaryUncached(t *testing.T) {
+	ctx := context.Background()
+	s := NewSession(&Config{})
+
+	_, err := s.DatastoreFreeBytes(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "datastore")
+	}
+
+	ds := object.NewDatastore(nil, types.ManagedObjectReference{Type: "Datastore", Value: "ds-1"})
+	_, err = s.DatastoreSummary(ctx, ds)
+	assert.Equal(t, ErrSessionExpired, err)
+}
+
+func TestDatastoreSummary(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:        env.URL(t),
+		Insecure:       true,
+		DatacenterPath: "/ha-datacenter",
+		DatastorePath:  "/ha-datacenter/datastore/*",
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	summary, err := session.DatastoreSummary(ctx, session.Datastore)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, session.Datastore.Reference(), *summary.Datastore)
+	assert.True(t, summary.Capacity > 0)
+
+	free, err := session.DatastoreFreeBytes(ctx)
+	if assert.NoError(t, err) {
+		assert.True(t, free >= 0 && free <= summary.Capacity)
+	}
+}
+
+func TestDatastoreFilePath(t *testing.T) {
+	s := NewSession(&Config{})
+	assert.Equal(t, "", s.DatastoreFilePath("vm/vm.vmx"))
+
+	_, err := s.DatastoreURL(context.Background(), "vm/vm.vmx")
+	assert.Error(t, err)
+
+	s.Datastore = object.NewDatastore(nil, types.ManagedObjectReference{Type: "Datastore", Value: "ds-1"})
+	s.Datastore.InventoryPath = "/dc1/datastore/my datastore"
+	assert.Equal(t, "[my datastore] vm/vm.vmx", s.DatastoreFilePath("vm/vm.vmx"))
+	assert.Equal(t, "[my datastore] vm/vm.vmx", s.DatastoreFilePath("/vm/vm.vmx"))
+	assert.Equal(t, "[my datastore] ", s.DatastoreFilePath(""))
+}
+
+func TestDatastoreURL(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:        env.URL(t),
+		Insecure:       true,
+		DatacenterPath: "/ha-datacenter",
+		DatastorePath:  "/ha-datacenter/datastore/*",
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	u, err := session.DatastoreURL(ctx, "/dir with space/file")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "/folder/dir with space/file", u.Path)
+	assert.Equal(t, session.Datastore.Name(), u.Query().Get("dsName"))
+	assert.Equal(t, "ha-datacenter", u.Query().Get("dcPath"))
+	assert.Contains(t, u.String(), "dir%20with%20space")
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	stdcontext "context"
+	stderrors "errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+const (
+	defaultConnectRetryDelay = time.Second
+	maxConnectRetryDelay     = 10 * time.Second
+)
+
+// configureDial installs Config.DialContext on the client's transport. TLS is
+// still negotiated by the transport, over the connection DialContext returns,
+// so the TLS configuration applies unchanged. With a proxy, DialContext is
+// used to reach the proxy.
+func (s *Session) configureDial(sc *soap.Client) {
+	if s.DialContext == nil {
+		return
+	}
+
+	t, ok := sc.Transport.(*http.Transport)
+	if !ok {
+		return
+	}
+
+	// DialContext takes precedence over the Dial set by the soap client
+	dial := s.DialContext
+	t.DialContext = func(ctx stdcontext.Context, network, addr string) (net.Conn, error) {
+		return dial(ctx, network, addr)
+	}
+}
+
+// connectRetryDelay returns the backoff to wait after the given (zero based)
+// failed attempt to create a client, doubling from ConnectRetryDelay
+func (s *Session) connectRetryDelay(attempt int) time.Duration {
+	delay := s.ConnectRetryDelay
+	if delay <= 0 {
+		delay = defaultConnectRetryDelay
+	}
+
+	for i := 0; i < attempt && delay < maxConnectRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxConnectRetryDelay {
+		delay = maxConnectRetryDelay
+	}
+	return delay
+}
+
+// isTransient returns whether err, from creating a client, is a failure to
+// reach the server that may clear by itself, such as a refused connection or
+// the 503 from a server that is still starting. Certificate problems and faults
+// from the server are not.
+func isTransient(err error) bool {
+	// the transport reports everything as a url.Error, which is itself a net.Error
+	for {
+		uerr, ok := err.(*url.Error)
+		if !ok {
+			break
+		}
+		err = uerr.Err
+	}
+
+	if err == nil {
+		return false
+	}
+
+	var nerr net.Error
+	if stderrors.As(err, &nerr) {
+		return true
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// the connection was dropped, as by a server shutting down
+		return true
+	}
+
+	// the soap client reports unexpected statuses by their text alone
+	return strings.HasPrefix(err.Error(), strconv.Itoa(http.StatusServiceUnavailable)+" ")
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	stderrors "errors"
+	"sort"
+	"strings"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// ErrSessionExpired is returned by Ping and UserSession when the server no longer
+// recognizes the session, and by the helpers needing a client when there is none.
+// Sessions with StickySession false log in again rather than report it.
+var ErrSessionExpired = errors.New("Session is not authenticated")
+
+// ErrReadOnly is returned in place of calling a mutating method on a ReadOnly session
+var ErrReadOnly = errors.New("Session is read only")
+
+// The well known ways in which Connect fails, which can be told apart with
+// errors.Is. Other than the ESXi ones, which are returned as is, each is wrapped
+// by an error with the detail, and the cause if any can be found with errors.As.
+var (
+	ErrURLParse                   = errors.New("SDK URL could not be parsed")
+	ErrCertLoad                   = errors.New("Unable to load X509 key pair")
+	ErrLoginFailed                = errors.New("Failed to log in")
+	ErrCertAuthUnsupportedOnESXi  = errors.New("Certificate based authentication not yet supported with ESXi")
+	ErrTokenAuthUnsupportedOnESXi = errors.New("Token based authentication not supported with ESXi")
+)
+
+// kindError is err, matching kind with errors.Is as well as whatever err does
+type kindError struct {
+	kind error
+	err  error
+}
+
+// withKind returns err marked as being of kind, one of the sentinels above
+func withKind(kind, err error) error {
+	return &kindError{kind: kind, err: err}
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+// connectErrors is the failure of each of several services, matching with
+// errors.Is anything one of them does
+type connectErrors struct {
+	msg  string
+	errs []error
+}
+
+func (e *connectErrors) Error() string {
+	return e.msg
+}
+
+func (e *connectErrors) Is(target error) bool {
+	for _, err := range e.errs {
+		if stderrors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// PopulateError is returned by Populate when one or more resources could not be
+// resolved. Resources that were resolved are still cached on the Session.
+type PopulateError struct {
+	// Failures maps the kind of resource, e.g. "datacenter" or "host", to the
+	// reason it could not be resolved
+	Failures map[string]error
+
+	// kinds records the order in which failures were added
+	kinds []string
+}
+
+func (e *PopulateError) add(kind string, err error) {
+	if e.Failures == nil {
+		e.Failures = make(map[string]error)
+	}
+
+	if _, ok := e.Failures[kind]; !ok {
+		e.kinds = append(e.kinds, kind)
+	}
+	e.Failures[kind] = err
+}
+
+// Error returns the failure detail, one resource per line
+func (e *PopulateError) Error() string {
+	kinds := e.kinds
+	if len(kinds) != len(e.Failures) {
+		// not built by add, fall back to a stable order
+		kinds = make([]string, 0, len(e.Failures))
+		for kind := range e.Failures {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+	}
+
+	msgs := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		msgs = append(msgs, e.Failures[kind].Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// isDefaultMultipleFound returns whether err is from a default lookup that
+// found several candidates
+func isDefaultMultipleFound(err error) bool {
+	switch err.(type) {
+	case find.DefaultMultipleFoundError, *find.DefaultMultipleFoundError:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/find"
+)
+
+func TestPopulateError(t *testing.T) {
+	e := &PopulateError{}
+	e.add("datastore", errors.New("datastore 'ds1' not found"))
+	e.add("datacenter", errors.New("no default datacenter found"))
+
+	// in the order added, as Populate reported them prior to PopulateError
+	assert.Equal(t, "datastore 'ds1' not found\nno default datacenter found", e.Error())
+
+	_, hostFailed := e.Failures["host"]
+	assert.False(t, hostFailed)
+	assert.Error(t, e.Failures["datacenter"])
+
+	// constructed directly the order is by kind
+	e = &PopulateError{
+		Failures: map[string]error{
+			"pool": errors.New("b"),
+			"host": errors.New("a"),
+		},
+	}
+	assert.Equal(t, "a\nb", e.Error())
+}
+
+func TestIsDefaultMultipleFound(t *testing.T) {
+	assert.True(t, isDefaultMultipleFound(&find.DefaultMultipleFoundError{}))
+	assert.True(t, isDefaultMultipleFound(find.DefaultMultipleFoundError{}))
+
+	// only the ambiguity of a default is soft
+	assert.False(t, isDefaultMultipleFound(&find.MultipleFoundError{}))
+	assert.False(t, isDefaultMultipleFound(&find.DefaultNotFoundError{}))
+	assert.False(t, isDefaultMultipleFound(errors.New("path matched more than one")))
+	assert.False(t, isDefaultMultipleFound(nil))
+}
+
+func TestConnectErrorKinds(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewSession(&Config{Service: "https://vc:badport/sdk"}).Connect(ctx)
+	if assert.Error(t, err) {
+		assert.True(t, errors.Is(err, ErrURLParse), "%s", err)
+		assert.Contains(t, err.Error(), "could not be parsed")
+		assert.False(t, errors.Is(err, ErrLoginFailed))
+	}
+
+	// with several services any of their failures match
+	_, err = NewSession(&Config{Service: "https://vc:badport/sdk", Services: []string{"https://vc:worse/sdk"}}).Connect(ctx)
+	if assert.Error(t, err) {
+		assert.True(t, errors.Is(err, ErrURLParse), "%s", err)
+		assert.Contains(t, err.Error(), "Failed to connect to any of the services")
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		w.Header().Set("Content-Type", "text/xml")
+		if strings.Contains(string(body), "<RetrieveServiceContent ") {
+			w.Write([]byte(serviceContentResponse))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(invalidLoginFault))
+	}))
+	defer server.Close()
+
+	_, err = NewSession(&Config{Service: "root:wrong@" + strings.TrimPrefix(server.URL, "https://") + "/sdk", Insecure: true}).Connect(ctx)
+	if assert.Error(t, err) {
+		assert.True(t, errors.Is(err, ErrLoginFailed), "%s", err)
+		assert.Contains(t, err.Error(), "Failed to log in to")
+
+		// the fault is still there to be inspected
+		assert.True(t, isInvalidLogin(errors.Unwrap(errors.Unwrap(err))))
+	}
+}
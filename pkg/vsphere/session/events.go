@@ -0,0 +1,343 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/event"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+const (
+	// eventPageSize is the number of the most recent events each watch starts with
+	eventPageSize = 25
+
+	defaultEventBufferSize = 16
+
+	// eventQueryPageSize is the number of events each query reads from the server at a time
+	eventQueryPageSize = 100
+)
+
+// EventManager returns the event manager of the session client, or nil if the
+// session isn't connected
+func (s *Session) EventManager() *event.Manager {
+	client := s.client()
+	if client == nil {
+		return nil
+	}
+
+	return event.NewManager(client.Client)
+}
+
+// WatchEvents passes the events for the objects refs refer to, and for their
+// descendants, to fn until ctx is cancelled, starting with the most recent.
+// Batches of events are buffered for a slow fn according to EventBufferSize,
+// and once the buffer is full the watch either waits for fn or, if
+// DropEvents is set, discards the batch. fn is called from a single goroutine.
+func (s *Session) WatchEvents(ctx context.Context, refs []types.ManagedObjectReference, fn func([]types.BaseEvent)) error {
+	if len(refs) == 0 {
+		return errors.New("No objects to watch events for")
+	}
+
+	m := s.EventManager()
+	if m == nil {
+		return ErrSessionExpired
+	}
+
+	batches := make(chan []types.BaseEvent, s.eventBufferSize())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for events := range batches {
+			fn(events)
+		}
+	}()
+
+	dropped := 0
+	err := m.Events(ctx, refs, eventPageSize, true, false, func(events []types.BaseEvent) error {
+		if s.DropEvents {
+			select {
+			case batches <- events:
+			default:
+				dropped += len(events)
+				log.Warnf("Dropped %d events as the handler is not keeping up (%d in total)", len(events), dropped)
+			}
+			return nil
+		}
+
+		select {
+		case batches <- events:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+
+	close(batches)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (c *Config) eventBufferSize() int {
+	if c.EventBufferSize > 0 {
+		return c.EventBufferSize
+	}
+	return defaultEventBufferSize
+}
+
+// QueryEvents returns the events created between begin and end for the objects
+// refs refer to and their descendants, oldest first, as QueryEventsChan does
+func (s *Session) QueryEvents(ctx context.Context, begin, end time.Time, refs []object.Reference) ([]types.BaseEvent, error) {
+	var events []types.BaseEvent
+	err := s.queryEvents(ctx, begin, end, refs, func(e types.BaseEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	return events, err
+}
+
+// QueryEventsChan passes the events created between begin and end for the
+// objects refs refer to and their descendants on the returned channel, oldest
+// first. A zero begin or end leaves that side of the window open. Without refs,
+// the events of the cached objects themselves are returned instead, excluding
+// those of their descendants. Events are read from the server a page at a time
+// as the channel is drained, and an event concerning several of the objects is
+// passed once.
+//
+// The event channel is closed once the events are exhausted, after which the
+// error channel yields the error that ended the query, if any. Callers that stop
+// draining the events early must cancel ctx for the query to be abandoned.
+func (s *Session) QueryEventsChan(ctx context.Context, begin, end time.Time, refs []object.Reference) (<-chan types.BaseEvent, <-chan error) {
+	events := make(chan types.BaseEvent)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+
+		err := s.queryEvents(ctx, begin, end, refs, func(e types.BaseEvent) error {
+			select {
+			case events <- e:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		close(events)
+
+		if err != nil {
+			errs <- err
+		}
+	}()
+
+	return events, errs
+}
+
+// eventCursor reads the events of a single history collector a page at a time
+type eventCursor struct {
+	collector *event.HistoryCollector
+	page      []types.BaseEvent
+	done      bool
+}
+
+// head returns the oldest event not yet consumed, reading the next page if
+// needed, or nil once the collector is exhausted
+func (c *eventCursor) head(ctx context.Context) (types.BaseEvent, error) {
+	if len(c.page) == 0 && !c.done {
+		page, err := c.collector.ReadNextEvents(ctx, eventQueryPageSize)
+		if err != nil {
+			return nil, err
+		}
+		c.page = page
+		c.done = len(page) == 0
+	}
+
+	if len(c.page) == 0 {
+		return nil, nil
+	}
+	return c.page[0], nil
+}
+
+// queryEvents passes the events of the query described by QueryEventsChan to
+// fn in order, stopping at the first error fn returns. A collector is created
+// for each object, as filters only take a single entity, and their streams
+// merged.
+func (s *Session) queryEvents(ctx context.Context, begin, end time.Time, refs []object.Reference, fn func(types.BaseEvent) error) error {
+	m := s.EventManager()
+	if m == nil {
+		return ErrSessionExpired
+	}
+
+	recursion := types.EventFilterSpecRecursionOptionAll
+	entities := eventEntities(refs)
+	if len(entities) == 0 {
+		recursion = types.EventFilterSpecRecursionOptionSelf
+		entities = s.cachedEntities()
+	}
+	if len(entities) == 0 {
+		return errors.New("No objects to query events for")
+	}
+
+	window := &types.EventFilterSpecByTime{}
+	if !begin.IsZero() {
+		window.BeginTime = &begin
+	}
+	if !end.IsZero() {
+		window.EndTime = &end
+	}
+
+	// the collectors count against the session's limit, so they're destroyed
+	// even once ctx is done, as it is when a query is abandoned
+	var cursors []*eventCursor
+	defer func() {
+		for _, c := range cursors {
+			if err := c.collector.Destroy(context.Background()); err != nil {
+				log.Debugf("Failed to destroy event collector %s: %s", c.collector.Reference(), err)
+			}
+		}
+	}()
+
+	for _, entity := range entities {
+		filter := types.EventFilterSpec{
+			Entity: &types.EventFilterSpecByEntity{Entity: entity, Recursion: recursion},
+			Time:   window,
+		}
+
+		var collector *event.HistoryCollector
+		err := s.bounded(ctx, "event query", func(ctx context.Context) error {
+			var err error
+			if collector, err = m.CreateCollectorForEvents(ctx, filter); err != nil {
+				return err
+			}
+			// read from the oldest event on
+			return collector.Rewind(ctx)
+		})
+		if collector != nil {
+			cursors = append(cursors, &eventCursor{collector: collector})
+		}
+		if err != nil {
+			return errors.Errorf("Unable to query events for %s: %s", entity, err)
+		}
+	}
+
+	// each collector returns its events oldest first, so repeatedly take the
+	// oldest of their heads, skipping those already passed by another
+	last := int32(-1)
+	for {
+		var oldest *eventCursor
+		var next *types.Event
+
+		for _, c := range cursors {
+			var head types.BaseEvent
+			err := s.bounded(ctx, "event query", func(ctx context.Context) error {
+				var err error
+				head, err = c.head(ctx)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if head == nil {
+				continue
+			}
+
+			e := head.GetEvent()
+			if next == nil || e.CreatedTime.Before(next.CreatedTime) ||
+				(e.CreatedTime.Equal(next.CreatedTime) && e.Key < next.Key) {
+				oldest, next = c, e
+			}
+		}
+
+		if oldest == nil {
+			return nil
+		}
+
+		head := oldest.page[0]
+		oldest.page = oldest.page[1:]
+
+		// an event concerning several of the objects has the same key and time
+		// in each stream, so its copies are taken in succession
+		if next.Key == last {
+			continue
+		}
+		last = next.Key
+
+		if err := fn(head); err != nil {
+			return err
+		}
+	}
+}
+
+// eventEntities returns the references of refs, without duplicates
+func eventEntities(refs []object.Reference) []types.ManagedObjectReference {
+	var entities []types.ManagedObjectReference
+	seen := make(map[types.ManagedObjectReference]bool)
+
+	for _, r := range refs {
+		if r == nil {
+			continue
+		}
+
+		ref := r.Reference()
+		if !seen[ref] {
+			seen[ref] = true
+			entities = append(entities, ref)
+		}
+	}
+	return entities
+}
+
+// cachedEntities returns the references of the cached objects, without duplicates
+func (s *Session) cachedEntities() []types.ManagedObjectReference {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	var refs []object.Reference
+	add := func(r object.Reference, ok bool) {
+		if ok {
+			refs = append(refs, r)
+		}
+	}
+
+	add(s.Datacenter, s.Datacenter != nil)
+	add(s.Cluster, s.Cluster != nil)
+	add(s.Host, s.Host != nil)
+	add(s.Datastore, s.Datastore != nil)
+	for _, ds := range s.Datastores {
+		add(ds, ds != nil)
+	}
+	add(s.Network, s.Network != nil)
+	for _, n := range s.Networks {
+		add(n, n != nil)
+	}
+	add(s.Pool, s.Pool != nil)
+	add(s.VMFolder, s.VMFolder != nil)
+	add(s.DVS, s.DVS != nil)
+	add(s.StoragePod, s.StoragePod != nil)
+	add(s.VirtualApp, s.VirtualApp != nil)
+
+	return eventEntities(refs)
+}
@@ -0,0 +1,249 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/vsphere/test/env"
+)
+
+func TestWatchEventsUnconnected(t *testing.T) {
+	ctx := context.Background()
+	s := NewSession(&Config{})
+
+	assert.Nil(t, s.EventManager())
+
+	ref := types.ManagedObjectReference{Type: "Folder", Value: "group-d1"}
+	assert.Equal(t, ErrSessionExpired, s.WatchEvents(ctx, []types.ManagedObjectReference{ref}, func([]types.BaseEvent) {}))
+	assert.Error(t, s.WatchEvents(ctx, nil, func([]types.BaseEvent) {}))
+}
+
+func TestWatchEvents(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:    env.URL(t),
+		Insecure:   true,
+		DropEvents: true,
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	// the login alone is an event on the root folder
+	root := session.ServiceContent.RootFolder
+
+	wctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var events []types.BaseEvent
+	err = session.WatchEvents(wctx, []types.ManagedObjectReference{root}, func(e []types.BaseEvent) {
+		events = append(events, e...)
+		cancel()
+	})
+
+	assert.Equal(t, context.Canceled, err)
+	assert.NotEmpty(t, events)
+}
+
+// eventRoundTripper answers the event collector calls made by QueryEvents,
+// each collector returning the events of its entity a page at a time
+type eventRoundTripper struct {
+	mu      sync.Mutex
+	events  map[string][]types.BaseEvent
+	filters map[string]types.EventFilterSpec
+
+	// collectors maps each collector to its entity, until destroyed
+	collectors map[string]string
+}
+
+func (f *eventRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch res := res.(type) {
+	case *methods.CreateCollectorForEventsBody:
+		filter := req.(*methods.CreateCollectorForEventsBody).Req.Filter
+		entity := filter.Entity.Entity.Value
+
+		f.filters[entity] = filter
+		f.collectors["collector-"+entity] = entity
+		res.Res = &types.CreateCollectorForEventsResponse{
+			Returnval: types.ManagedObjectReference{Type: "EventHistoryCollector", Value: "collector-" + entity},
+		}
+	case *methods.RewindCollectorBody:
+		res.Res = &types.RewindCollectorResponse{}
+	case *methods.ReadNextEventsBody:
+		r := req.(*methods.ReadNextEventsBody).Req
+		entity := f.collectors[r.This.Value]
+
+		page := f.events[entity]
+		if len(page) > int(r.MaxCount) {
+			page = page[:r.MaxCount]
+		}
+		f.events[entity] = f.events[entity][len(page):]
+		res.Res = &types.ReadNextEventsResponse{Returnval: page}
+	case *methods.DestroyCollectorBody:
+		// as the soap client does, refuse calls on a context that's done
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		delete(f.collectors, req.(*methods.DestroyCollectorBody).Req.This.Value)
+		res.Res = &types.DestroyCollectorResponse{}
+	}
+	return nil
+}
+
+func eventSession(events map[string][]types.BaseEvent) (*Session, *eventRoundTripper) {
+	rt := &eventRoundTripper{
+		events:     events,
+		filters:    make(map[string]types.EventFilterSpec),
+		collectors: make(map[string]string),
+	}
+
+	ref := types.ManagedObjectReference{Type: "EventManager", Value: "EventManager"}
+	client := &vim25.Client{RoundTripper: rt, ServiceContent: types.ServiceContent{EventManager: &ref}}
+	return NewSessionFromClient(&govmomi.Client{Client: client}, nil), rt
+}
+
+// generalEvents returns count events with keys from key on, a second apart from start
+func generalEvents(start time.Time, key int32, count int) []types.BaseEvent {
+	var events []types.BaseEvent
+	for i := 0; i < count; i++ {
+		events = append(events, &types.GeneralEvent{Event: types.Event{
+			Key:         key + int32(i),
+			CreatedTime: start.Add(time.Duration(i) * time.Second),
+		}})
+	}
+	return events
+}
+
+func eventKeys(events []types.BaseEvent) []int32 {
+	var keys []int32
+	for _, e := range events {
+		keys = append(keys, e.GetEvent().Key)
+	}
+	return keys
+}
+
+func TestQueryEvents(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// more than a page for the host, interleaved with the pool's, and one
+	// event shared by both
+	host := generalEvents(start, 0, eventQueryPageSize+10)
+	pool := generalEvents(start.Add(500*time.Millisecond), 1000, 3)
+	pool = append(pool, host[5])
+
+	s, rt := eventSession(map[string][]types.BaseEvent{"host-1": host, "resgroup-1": pool})
+
+	refs := []object.Reference{
+		object.NewHostSystem(s.Vim25(), types.ManagedObjectReference{Type: "HostSystem", Value: "host-1"}),
+		object.NewResourcePool(s.Vim25(), types.ManagedObjectReference{Type: "ResourcePool", Value: "resgroup-1"}),
+	}
+
+	end := start.Add(time.Hour)
+	events, err := s.QueryEvents(ctx, start, end, refs)
+	require.NoError(t, err)
+
+	keys := eventKeys(events)
+	require.Len(t, keys, len(host)+3)
+	assert.Equal(t, []int32{0, 1000, 1, 1001, 2, 1002, 3, 4, 5, 6}, keys[:10])
+
+	filter := rt.filters["host-1"]
+	assert.Equal(t, types.EventFilterSpecRecursionOptionAll, filter.Entity.Recursion)
+	if assert.NotNil(t, filter.Time) {
+		assert.Equal(t, start, *filter.Time.BeginTime)
+		assert.Equal(t, end, *filter.Time.EndTime)
+	}
+	assert.Empty(t, rt.collectors, "expected the collectors to be destroyed")
+}
+
+func TestQueryEventsCached(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	s, rt := eventSession(map[string][]types.BaseEvent{"datastore-1": generalEvents(start, 0, 2)})
+
+	_, err := s.QueryEvents(ctx, time.Time{}, time.Time{}, nil)
+	assert.Error(t, err, "expected a failure without objects to query")
+
+	ds := object.NewDatastore(s.Vim25(), types.ManagedObjectReference{Type: "Datastore", Value: "datastore-1"})
+	s.Datastore = ds
+	s.Datastores = []*object.Datastore{ds}
+
+	events, errs := s.QueryEventsChan(ctx, time.Time{}, time.Time{}, nil)
+
+	var keys []int32
+	for e := range events {
+		keys = append(keys, e.GetEvent().Key)
+	}
+	assert.NoError(t, <-errs)
+	assert.Equal(t, []int32{0, 1}, keys)
+
+	filter := rt.filters["datastore-1"]
+	assert.Len(t, rt.filters, 1, "expected the datastore to be queried once")
+	assert.Equal(t, types.EventFilterSpecRecursionOptionSelf, filter.Entity.Recursion)
+	if assert.NotNil(t, filter.Time) {
+		assert.Nil(t, filter.Time.BeginTime)
+		assert.Nil(t, filter.Time.EndTime)
+	}
+}
+
+func TestQueryEventsChanCancel(t *testing.T) {
+	start := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	s, rt := eventSession(map[string][]types.BaseEvent{"host-1": generalEvents(start, 0, 10)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	host := object.NewHostSystem(s.Vim25(), types.ManagedObjectReference{Type: "HostSystem", Value: "host-1"})
+	events, errs := s.QueryEventsChan(ctx, time.Time{}, time.Time{}, []object.Reference{host})
+
+	<-events
+	cancel()
+
+	// the query gives up rather than blocking on the abandoned channel
+	assert.Equal(t, context.Canceled, <-errs)
+	_, ok := <-events
+	assert.False(t, ok)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	assert.Len(t, rt.filters, 1)
+	assert.Empty(t, rt.collectors, "expected the collectors of an abandoned query to be destroyed")
+}
+
+func TestQueryEventsUnconnected(t *testing.T) {
+	_, err := NewSession(&Config{}).QueryEvents(context.Background(), time.Time{}, time.Time{}, nil)
+	assert.Equal(t, ErrSessionExpired, err)
+}
@@ -0,0 +1,273 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// The vendored govmomi predates first class disks, so the requests and the
+// parts of the responses used are declared here, and the manager, missing
+// from its ServiceContent, is found by its well known reference.
+var vStorageObjectManager = types.ManagedObjectReference{Type: "VcenterVStorageObjectManager", Value: "VStorageObjectManager"}
+
+// VStorageObjectManager manages first class disks, virtual disks with a
+// lifecycle of their own rather than that of a virtual machine
+type VStorageObjectManager struct {
+	object.Common
+}
+
+// VStorageObjectManager returns the first class disk manager of the session
+// client, or object.ErrNotSupported if the server has none, as only VC does
+// from API 6.5. The client must speak 6.5 too, as the server rejects the
+// methods made under an older version, so VimVersion must be set to at least
+// that with the vendored govmomi.
+func (s *Session) VStorageObjectManager() (*VStorageObjectManager, error) {
+	client := s.client()
+	if client == nil {
+		return nil, ErrSessionExpired
+	}
+
+	if !s.IsVC() || !s.AtLeast(6, 5) {
+		return nil, object.ErrNotSupported
+	}
+
+	if version := clientVimVersion(client.Client); !versionAtLeast(version, 6, 5) {
+		return nil, errors.Errorf("First class disks need a vim version of at least 6.5, not %s; set VimVersion", version)
+	}
+
+	return &VStorageObjectManager{object.NewCommon(client.Client, vStorageObjectManager)}, nil
+}
+
+// clientVimVersion returns the vim version the requests of client are made under
+func clientVimVersion(client *vim25.Client) string {
+	if client.Client == nil || client.Client.Version == "" {
+		return soap.DefaultVimVersion
+	}
+	return client.Client.Version
+}
+
+// CreateDisk starts creating a thin provisioned first class disk of capacityMB
+// named name on ds
+func (m VStorageObjectManager) CreateDisk(ctx context.Context, ds *object.Datastore, name string, capacityMB int64) (*object.Task, error) {
+	req := createDisk_TaskBody{
+		Req: &createDiskRequest{
+			This: m.Reference(),
+			Spec: vslmCreateSpec{
+				BackingSpec: vslmDiskFileBackingSpec{
+					Type:             "VslmCreateSpecDiskFileBackingSpec",
+					Datastore:        ds.Reference(),
+					ProvisioningType: "thin",
+				},
+				Name:         name,
+				CapacityInMB: capacityMB,
+			},
+		},
+	}
+
+	var res createDisk_TaskBody
+	if err := m.Client().RoundTrip(ctx, &req, &res); err != nil {
+		return nil, err
+	}
+	return object.NewTask(m.Client(), res.Res.Returnval), nil
+}
+
+// DeleteVStorageObject starts deleting the first class disk id on ds
+func (m VStorageObjectManager) DeleteVStorageObject(ctx context.Context, ds *object.Datastore, id string) (*object.Task, error) {
+	req := deleteVStorageObject_TaskBody{
+		Req: &deleteVStorageObjectRequest{
+			This:      m.Reference(),
+			ID:        vStorageObjectID{ID: id},
+			Datastore: ds.Reference(),
+		},
+	}
+
+	var res deleteVStorageObject_TaskBody
+	if err := m.Client().RoundTrip(ctx, &req, &res); err != nil {
+		return nil, err
+	}
+	return object.NewTask(m.Client(), res.Res.Returnval), nil
+}
+
+// CreateFCD creates a thin provisioned first class disk of capacityMB named
+// name on the cached datastore, returning its id
+func (s *Session) CreateFCD(ctx context.Context, name string, capacityMB int64) (string, error) {
+	m, ds, err := s.fcdTarget()
+	if err != nil {
+		return "", err
+	}
+
+	t, err := m.CreateDisk(ctx, ds, name, capacityMB)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = s.WaitForTask(ctx, t); err != nil {
+		return "", err
+	}
+
+	disk, err := s.createdDisk(ctx, t)
+	if err != nil {
+		return "", errors.Errorf("Unable to determine the id of disk %s: %w", name, err)
+	}
+	return disk.Config.ID.ID, nil
+}
+
+// DeleteFCD deletes the first class disk id from the cached datastore
+func (s *Session) DeleteFCD(ctx context.Context, id string) error {
+	m, ds, err := s.fcdTarget()
+	if err != nil {
+		return err
+	}
+
+	t, err := m.DeleteVStorageObject(ctx, ds, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.WaitForTask(ctx, t)
+	return err
+}
+
+// fcdTarget returns the manager and datastore for first class disk operations
+func (s *Session) fcdTarget() (*VStorageObjectManager, *object.Datastore, error) {
+	m, err := s.VStorageObjectManager()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ds := s.GetDatastore()
+	if ds == nil {
+		return nil, nil, errors.New("No datastore is cached for first class disks")
+	}
+	return m, ds, nil
+}
+
+// createdDisk returns the disk created by t, read from its result directly as
+// the vendored types cannot decode it, so it would be dropped from the TaskInfo
+func (s *Session) createdDisk(ctx context.Context, t *object.Task) (*vStorageObject, error) {
+	client := s.client()
+	if client == nil {
+		return nil, ErrSessionExpired
+	}
+
+	req := taskResultBody{
+		Req: &types.RetrieveProperties{
+			This: client.ServiceContent.PropertyCollector,
+			SpecSet: []types.PropertyFilterSpec{{
+				ObjectSet: []types.ObjectSpec{{Obj: t.Reference()}},
+				PropSet:   []types.PropertySpec{{Type: "Task", PathSet: []string{"info.result"}}},
+			}},
+		},
+	}
+
+	var res taskResultBody
+	if err := client.RoundTrip(ctx, &req, &res); err != nil {
+		return nil, err
+	}
+
+	for _, content := range res.Res.Returnval {
+		for _, prop := range content.PropSet {
+			if prop.Val.Config.ID.ID != "" {
+				return &prop.Val, nil
+			}
+		}
+	}
+	return nil, errors.Errorf("%s:%s has no result", t.Reference().Type, t.Reference().Value)
+}
+
+type vStorageObjectID struct {
+	ID string `xml:"id"`
+}
+
+type vslmDiskFileBackingSpec struct {
+	// Type is the xsi:type the server needs to tell the kind of backing
+	Type             string                       `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+	Datastore        types.ManagedObjectReference `xml:"datastore"`
+	ProvisioningType string                       `xml:"provisioningType,omitempty"`
+}
+
+type vslmCreateSpec struct {
+	BackingSpec  vslmDiskFileBackingSpec `xml:"backingSpec"`
+	Name         string                  `xml:"name"`
+	CapacityInMB int64                   `xml:"capacityInMB"`
+}
+
+type createDiskRequest struct {
+	This types.ManagedObjectReference `xml:"_this"`
+	Spec vslmCreateSpec               `xml:"spec"`
+}
+
+type deleteVStorageObjectRequest struct {
+	This      types.ManagedObjectReference `xml:"_this"`
+	ID        vStorageObjectID             `xml:"id"`
+	Datastore types.ManagedObjectReference `xml:"datastore"`
+}
+
+type taskResponse struct {
+	Returnval types.ManagedObjectReference `xml:"returnval"`
+}
+
+// the bodies are named after their methods, as in the methods package, so that
+// soapMethod finds the MutatingMethods among them
+type createDisk_TaskBody struct {
+	Req    *createDiskRequest `xml:"urn:vim25 CreateDisk_Task,omitempty"`
+	Res    *taskResponse      `xml:"urn:vim25 CreateDisk_TaskResponse,omitempty"`
+	Fault_ *soap.Fault        `xml:"http://schemas.xmlsoap.org/soap/envelope/ Fault,omitempty"`
+}
+
+func (b *createDisk_TaskBody) Fault() *soap.Fault { return b.Fault_ }
+
+type deleteVStorageObject_TaskBody struct {
+	Req    *deleteVStorageObjectRequest `xml:"urn:vim25 DeleteVStorageObject_Task,omitempty"`
+	Res    *taskResponse                `xml:"urn:vim25 DeleteVStorageObject_TaskResponse,omitempty"`
+	Fault_ *soap.Fault                  `xml:"http://schemas.xmlsoap.org/soap/envelope/ Fault,omitempty"`
+}
+
+func (b *deleteVStorageObject_TaskBody) Fault() *soap.Fault { return b.Fault_ }
+
+// vStorageObject is the part of a VStorageObject used
+type vStorageObject struct {
+	Config struct {
+		ID   vStorageObjectID `xml:"id"`
+		Name string           `xml:"name"`
+	} `xml:"config"`
+}
+
+type taskResultProperty struct {
+	Val vStorageObject `xml:"val"`
+}
+
+type taskResultContent struct {
+	PropSet []taskResultProperty `xml:"propSet"`
+}
+
+type taskResultResponse struct {
+	Returnval []taskResultContent `xml:"returnval"`
+}
+
+type taskResultBody struct {
+	Req    *types.RetrieveProperties `xml:"urn:vim25 RetrieveProperties,omitempty"`
+	Res    *taskResultResponse       `xml:"urn:vim25 RetrievePropertiesResponse,omitempty"`
+	Fault_ *soap.Fault               `xml:"http://schemas.xmlsoap.org/soap/envelope/ Fault,omitempty"`
+}
+
+func (b *taskResultBody) Fault() *soap.Fault { return b.Fault_ }
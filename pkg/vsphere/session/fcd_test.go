@@ -0,0 +1,182 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/govmomi/vim25/xml"
+)
+
+// fcdRoundTripper answers the first class disk requests, and those made
+// waiting on their tasks as taskRoundTripper does
+type fcdRoundTripper struct {
+	taskRoundTripper
+
+	created *createDiskRequest
+	deleted *deleteVStorageObjectRequest
+}
+
+func (f *fcdRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	task := types.ManagedObjectReference{Type: "Task", Value: "task-1"}
+
+	switch res := res.(type) {
+	case *createDisk_TaskBody:
+		f.created = req.(*createDisk_TaskBody).Req
+		f.infos = append(f.infos, types.TaskInfo{State: types.TaskInfoStateSuccess})
+		res.Res = &taskResponse{Returnval: task}
+	case *deleteVStorageObject_TaskBody:
+		f.deleted = req.(*deleteVStorageObject_TaskBody).Req
+		f.infos = append(f.infos, types.TaskInfo{State: types.TaskInfoStateSuccess})
+		res.Res = &taskResponse{Returnval: task}
+	case *taskResultBody:
+		var disk vStorageObject
+		disk.Config.ID.ID = "0b6f0bbc-5e4c-4e1d-a36b-7c1a9c6f2d42"
+		disk.Config.Name = f.created.Spec.Name
+
+		res.Res = new(taskResultResponse)
+		res.Res.Returnval = make([]taskResultContent, 1)
+		res.Res.Returnval[0].PropSet = []taskResultProperty{{Val: disk}}
+	default:
+		return f.taskRoundTripper.RoundTrip(ctx, req, res)
+	}
+	return nil
+}
+
+// fcdSession returns a session for the server described by about, whose client
+// speaks vim version 6.5 as first class disks need
+func fcdSession(rt soap.RoundTripper, about types.AboutInfo) *Session {
+	sc := soap.NewClient(&url.URL{Scheme: "https", Host: "localhost"}, true)
+	sc.Version = "6.5"
+
+	client := &vim25.Client{
+		Client:         sc,
+		RoundTripper:   rt,
+		ServiceContent: types.ServiceContent{About: about},
+	}
+	return NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+}
+
+func TestVStorageObjectManager(t *testing.T) {
+	_, err := NewSession(&Config{}).VStorageObjectManager()
+	assert.Equal(t, ErrSessionExpired, err)
+
+	// too old, and not VC
+	_, err = fcdSession(nil, types.AboutInfo{ApiType: "VirtualCenter", ApiVersion: "6.0"}).VStorageObjectManager()
+	assert.Equal(t, object.ErrNotSupported, err)
+	_, err = fcdSession(nil, types.AboutInfo{ApiType: "HostAgent", ApiVersion: "6.5"}).VStorageObjectManager()
+	assert.Equal(t, object.ErrNotSupported, err)
+
+	s := fcdSession(nil, types.AboutInfo{ApiType: "VirtualCenter", ApiVersion: "6.7"})
+	m, err := s.VStorageObjectManager()
+	if assert.NoError(t, err) {
+		assert.Equal(t, vStorageObjectManager, m.Reference())
+	}
+
+	// the server has them, but would reject them from a client speaking 6.0
+	s.Vim25().Client.Version = "6.0"
+	_, err = s.VStorageObjectManager()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "VimVersion")
+	}
+
+	// as it would from the default client
+	s.Vim25().Client = nil
+	_, err = s.VStorageObjectManager()
+	assert.Error(t, err)
+}
+
+func TestCreateDiskRequest(t *testing.T) {
+	ds := object.NewDatastore(nil, types.ManagedObjectReference{Type: "Datastore", Value: "datastore-42"})
+	req := createDisk_TaskBody{
+		Req: &createDiskRequest{
+			This: vStorageObjectManager,
+			Spec: vslmCreateSpec{
+				BackingSpec: vslmDiskFileBackingSpec{
+					Type:      "VslmCreateSpecDiskFileBackingSpec",
+					Datastore: ds.Reference(),
+				},
+				Name:         "disk1",
+				CapacityInMB: 1024,
+			},
+		},
+	}
+
+	b, err := xml.Marshal(req)
+	require.NoError(t, err)
+
+	body := string(b)
+	assert.Contains(t, body, `<CreateDisk_Task xmlns="urn:vim25">`)
+	assert.Contains(t, body, `<_this type="VcenterVStorageObjectManager">VStorageObjectManager</_this>`)
+	assert.Contains(t, body, `type="VslmCreateSpecDiskFileBackingSpec"`)
+	assert.Contains(t, body, `<datastore type="Datastore">datastore-42</datastore>`)
+	assert.Contains(t, body, `<name>disk1</name><capacityInMB>1024</capacityInMB>`)
+
+	// read only sessions refuse them
+	assert.True(t, MutatingMethods[soapMethod(&req)])
+	assert.True(t, MutatingMethods[soapMethod(&deleteVStorageObject_TaskBody{})])
+}
+
+func TestCreateFCD(t *testing.T) {
+	ctx := context.Background()
+	rt := &fcdRoundTripper{}
+	s := fcdSession(rt, types.AboutInfo{ApiType: "VirtualCenter", ApiVersion: "6.5"})
+
+	_, err := s.CreateFCD(ctx, "disk1", 1024)
+	assert.Error(t, err, "expected a failure without a datastore")
+
+	ds := object.NewDatastore(s.Vim25(), types.ManagedObjectReference{Type: "Datastore", Value: "datastore-42"})
+	s.Datastore = ds
+
+	id, err := s.CreateFCD(ctx, "disk1", 1024)
+	require.NoError(t, err)
+	assert.Equal(t, "0b6f0bbc-5e4c-4e1d-a36b-7c1a9c6f2d42", id)
+	if assert.NotNil(t, rt.created) {
+		assert.Equal(t, ds.Reference(), rt.created.Spec.BackingSpec.Datastore)
+		assert.Equal(t, "thin", rt.created.Spec.BackingSpec.ProvisioningType)
+		assert.Equal(t, int64(1024), rt.created.Spec.CapacityInMB)
+	}
+
+	require.NoError(t, s.DeleteFCD(ctx, id))
+	if assert.NotNil(t, rt.deleted) {
+		assert.Equal(t, id, rt.deleted.ID.ID)
+		assert.Equal(t, ds.Reference(), rt.deleted.Datastore)
+	}
+}
+
+func TestTaskResultResponse(t *testing.T) {
+	const response = `<RetrievePropertiesResponse xmlns="urn:vim25" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><returnval><obj type="Task">task-1</obj>
+<propSet><name>info.result</name><val xsi:type="VStorageObject"><config><id><id>0b6f0bbc</id></id><name>disk1</name><capacityInMB>1024</capacityInMB>
+<backing xsi:type="BaseConfigInfoDiskFileBackingInfo"><filePath>[ds1] fcd/disk1.vmdk</filePath></backing></config></val></propSet></returnval></RetrievePropertiesResponse>`
+
+	var res taskResultResponse
+	require.NoError(t, xml.Unmarshal([]byte(response), &res))
+
+	if assert.Len(t, res.Returnval, 1) && assert.Len(t, res.Returnval[0].PropSet, 1) {
+		disk := res.Returnval[0].PropSet[0].Val
+		assert.Equal(t, "0b6f0bbc", disk.Config.ID.ID)
+		assert.Equal(t, "disk1", disk.Config.Name)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// DatastoreFileManager manages the files on a datastore by their paths
+// relative to it, in the datacenter of the session it was created from
+type DatastoreFileManager struct {
+	*object.FileManager
+
+	Datacenter *object.Datacenter
+	Datastore  *object.Datastore
+
+	// Force overwrites existing files when copying or moving
+	Force bool
+}
+
+// FileManager returns the file manager of the session client, or nil if the
+// session isn't connected
+func (s *Session) FileManager() *object.FileManager {
+	client := s.client()
+	if client == nil {
+		return nil
+	}
+
+	return object.NewFileManager(client.Client)
+}
+
+// DatastoreFileManager returns a DatastoreFileManager for ds in the cached
+// datacenter, or for the cached datastore if ds is nil
+func (s *Session) DatastoreFileManager(ds *object.Datastore, force bool) (*DatastoreFileManager, error) {
+	dc := s.GetDatacenter()
+	if dc == nil {
+		return nil, errors.New("No datacenter is cached in this session")
+	}
+
+	if ds == nil {
+		if ds = s.GetDatastore(); ds == nil {
+			return nil, errors.New("No datastore is cached in this session")
+		}
+	}
+
+	fm := s.FileManager()
+	if fm == nil {
+		return nil, ErrSessionExpired
+	}
+
+	return &DatastoreFileManager{
+		FileManager: fm,
+		Datacenter:  dc,
+		Datastore:   ds,
+		Force:       force,
+	}, nil
+}
+
+// Path returns the datastore path of name, which is relative to the datastore
+func (m *DatastoreFileManager) Path(name string) string {
+	return m.Datastore.Path(name)
+}
+
+// Copy copies src to dst on the datastore, waiting for the task to complete
+func (m *DatastoreFileManager) Copy(ctx context.Context, src, dst string) error {
+	task, err := m.CopyDatastoreFile(ctx, m.Path(src), m.Datacenter, m.Path(dst), m.Datacenter, m.Force)
+	if err != nil {
+		return err
+	}
+	return task.Wait(ctx)
+}
+
+// Move moves src to dst on the datastore, waiting for the task to complete
+func (m *DatastoreFileManager) Move(ctx context.Context, src, dst string) error {
+	task, err := m.MoveDatastoreFile(ctx, m.Path(src), m.Datacenter, m.Path(dst), m.Datacenter, m.Force)
+	if err != nil {
+		return err
+	}
+	return task.Wait(ctx)
+}
+
+// Delete deletes the file or directory name from the datastore, waiting for
+// the task to complete
+func (m *DatastoreFileManager) Delete(ctx context.Context, name string) error {
+	task, err := m.DeleteDatastoreFile(ctx, m.Path(name), m.Datacenter)
+	if err != nil {
+		return err
+	}
+	return task.Wait(ctx)
+}
+
+// Mkdir creates the directory name on the datastore, along with any missing
+// parents if parents is set
+func (m *DatastoreFileManager) Mkdir(ctx context.Context, name string, parents bool) error {
+	return m.MakeDirectory(ctx, m.Path(name), m.Datacenter, parents)
+}
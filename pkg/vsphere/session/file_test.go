@@ -0,0 +1,77 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/vsphere/test/env"
+)
+
+func TestDatastoreFileManagerUncached(t *testing.T) {
+	s := NewSession(&Config{})
+
+	assert.Nil(t, s.FileManager())
+
+	_, err := s.DatastoreFileManager(nil, false)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "datacenter")
+	}
+
+	s.Datacenter = object.NewDatacenter(nil, types.ManagedObjectReference{Type: "Datacenter", Value: "dc"})
+	_, err = s.DatastoreFileManager(nil, false)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "datastore")
+	}
+}
+
+func TestDatastoreFileManager(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:        env.URL(t),
+		Insecure:       true,
+		DatacenterPath: "/ha-datacenter",
+		DatastorePath:  "/ha-datacenter/datastore/*",
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	fm, err := session.DatastoreFileManager(nil, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, session.Datastore, fm.Datastore)
+
+	dir := "session-file-manager-test"
+	if !assert.NoError(t, fm.Mkdir(ctx, dir+"/a", true)) {
+		return
+	}
+	defer fm.Delete(ctx, dir)
+
+	assert.NoError(t, fm.Move(ctx, dir+"/a", dir+"/b"))
+	assert.Error(t, fm.Delete(ctx, dir+"/a"))
+	assert.NoError(t, fm.Delete(ctx, dir+"/b"))
+}
@@ -0,0 +1,158 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// HostFilter decides whether a host is suitable for placement from its name and
+// runtime state, the properties retrieved by AvailableHosts
+type HostFilter func(host mo.HostSystem) bool
+
+// HostAvailable accepts hosts that are connected and not in maintenance mode
+func HostAvailable(host mo.HostSystem) bool {
+	return host.Runtime.ConnectionState == types.HostSystemConnectionStateConnected && !host.Runtime.InMaintenanceMode
+}
+
+// AvailableHosts returns those of Hosts that every filter accepts, HostAvailable
+// if none are given. The state of all the hosts is retrieved in a single round
+// trip, and the hosts are returned in the order Hosts listed them. The result is
+// empty rather than nil if there are none.
+func (s *Session) AvailableHosts(ctx context.Context, filters ...HostFilter) ([]*object.HostSystem, error) {
+	hosts, err := s.Hosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	available := []*object.HostSystem{}
+	if len(hosts) == 0 {
+		return available, nil
+	}
+
+	if len(filters) == 0 {
+		filters = []HostFilter{HostAvailable}
+	}
+
+	refs := make([]types.ManagedObjectReference, len(hosts))
+	for i, host := range hosts {
+		refs[i] = host.Reference()
+	}
+
+	var mhs []mo.HostSystem
+	err = s.bounded(ctx, "host state retrieval", func(ctx context.Context) error {
+		pc := s.PropertyCollector()
+		if pc == nil {
+			return ErrSessionExpired
+		}
+		return pc.Retrieve(ctx, refs, []string{"name", "runtime"}, &mhs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	state := make(map[types.ManagedObjectReference]mo.HostSystem, len(mhs))
+	for _, mh := range mhs {
+		state[mh.Reference()] = mh
+	}
+
+	for _, host := range hosts {
+		mh, ok := state[host.Reference()]
+		if !ok {
+			// removed since it was listed
+			continue
+		}
+
+		if accepted(mh, filters) {
+			available = append(available, host)
+		}
+	}
+	return available, nil
+}
+
+// accepted returns whether all of filters accept host
+func accepted(host mo.HostSystem, filters []HostFilter) bool {
+	for _, filter := range filters {
+		if !filter(host) {
+			return false
+		}
+	}
+	return true
+}
+
+// HostConfigManager returns the config manager of the cached Host. On VC the
+// Host is only cached if the HostPath names one, or there is only one.
+func (s *Session) HostConfigManager(ctx context.Context) (*object.HostConfigManager, error) {
+	host := s.GetHost()
+	if host == nil {
+		return nil, errors.New("No host is cached in this session")
+	}
+
+	if s.client() == nil {
+		return nil, ErrSessionExpired
+	}
+
+	return host.ConfigManager(), nil
+}
+
+// HostDatastoreSystem returns the datastore system of the cached Host
+func (s *Session) HostDatastoreSystem(ctx context.Context) (*object.HostDatastoreSystem, error) {
+	m, err := s.HostConfigManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ds *object.HostDatastoreSystem
+	err = s.bounded(ctx, "host datastore system lookup", func(ctx context.Context) (err error) {
+		ds, err = m.DatastoreSystem(ctx)
+		return
+	})
+	return ds, err
+}
+
+// HostNetworkSystem returns the network system of the cached Host
+func (s *Session) HostNetworkSystem(ctx context.Context) (*object.HostNetworkSystem, error) {
+	m, err := s.HostConfigManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ns *object.HostNetworkSystem
+	err = s.bounded(ctx, "host network system lookup", func(ctx context.Context) (err error) {
+		ns, err = m.NetworkSystem(ctx)
+		return
+	})
+	return ns, err
+}
+
+// HostFirewallSystem returns the firewall system of the cached Host
+func (s *Session) HostFirewallSystem(ctx context.Context) (*object.HostFirewallSystem, error) {
+	m, err := s.HostConfigManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var fs *object.HostFirewallSystem
+	err = s.bounded(ctx, "host firewall system lookup", func(ctx context.Context) (err error) {
+		fs, err = m.FirewallSystem(ctx)
+		return
+	})
+	return fs, err
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/vsphere/test/env"
+)
+
+func TestHostAvailable(t *testing.T) {
+	host := mo.HostSystem{}
+	host.Runtime.ConnectionState = types.HostSystemConnectionStateConnected
+	assert.True(t, HostAvailable(host))
+
+	host.Runtime.InMaintenanceMode = true
+	assert.False(t, HostAvailable(host))
+
+	host.Runtime.InMaintenanceMode = false
+	host.Runtime.ConnectionState = types.HostSystemConnectionStateNotResponding
+	assert.False(t, HostAvailable(host))
+
+	host.Runtime.ConnectionState = types.HostSystemConnectionStateDisconnected
+	assert.False(t, HostAvailable(host))
+}
+
+func TestAvailableHosts(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewSession(&Config{}).AvailableHosts(ctx)
+	assert.Error(t, err)
+
+	config := &Config{
+		Service:        env.URL(t),
+		Insecure:       true,
+		DatacenterPath: "/ha-datacenter",
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	hosts, err := session.AvailableHosts(ctx)
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, hosts)
+	}
+
+	none, err := session.AvailableHosts(ctx, func(mo.HostSystem) bool { return false })
+	if assert.NoError(t, err) {
+		assert.NotNil(t, none)
+		assert.Empty(t, none)
+	}
+}
+
+func TestHostConfigManager(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewSession(&Config{}).HostConfigManager(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "No host")
+	}
+	_, err = NewSession(&Config{}).HostNetworkSystem(ctx)
+	assert.Error(t, err)
+
+	config := &Config{
+		Service:        env.URL(t),
+		Insecure:       true,
+		DatacenterPath: "/ha-datacenter",
+		HostPath:       "/ha-datacenter/host/*/*",
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	m, err := session.HostConfigManager(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, session.Host.Reference(), m.Reference())
+	}
+
+	ds, err := session.HostDatastoreSystem(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "HostDatastoreSystem", ds.Reference().Type)
+	}
+
+	ns, err := session.HostNetworkSystem(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "HostNetworkSystem", ns.Reference().Type)
+	}
+
+	fs, err := session.HostFirewallSystem(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "HostFirewallSystem", fs.Reference().Type)
+	}
+}
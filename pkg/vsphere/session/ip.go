@@ -0,0 +1,105 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// WaitForIP waits for the guest of vm to report a primary IP address that's
+// neither link-local nor unspecified, returning it. The link-local addresses
+// guests assign themselves until DHCP completes are passed over. Should ctx
+// expire first, the returned error includes the last address reported.
+func (s *Session) WaitForIP(ctx context.Context, vm *object.VirtualMachine) (string, error) {
+	var last string
+
+	ip, err := s.waitForIP(ctx, vm, "guest.ipAddress", func(val interface{}) string {
+		last, _ = val.(string)
+		if usableIP(last) {
+			return last
+		}
+		return ""
+	})
+	if err != nil {
+		return "", errors.Errorf("Unable to get an IP for %s (last reported %q): %s", vm.Reference(), last, err)
+	}
+	return ip, nil
+}
+
+// WaitForNetworkIP waits as WaitForIP does for an address on the NIC of vm
+// attached to network, matched by network name or by the NIC's MAC address
+func (s *Session) WaitForNetworkIP(ctx context.Context, vm *object.VirtualMachine, network string) (string, error) {
+	var last []string
+
+	ip, err := s.waitForIP(ctx, vm, "guest.net", func(val interface{}) string {
+		last = nil
+
+		nics, _ := val.(types.ArrayOfGuestNicInfo)
+		for _, nic := range nics.GuestNicInfo {
+			if nic.Network != network && nic.MacAddress != network {
+				continue
+			}
+
+			last = nic.IpAddress
+			for _, ip := range nic.IpAddress {
+				if usableIP(ip) {
+					return ip
+				}
+			}
+		}
+		return ""
+	})
+	if err != nil {
+		return "", errors.Errorf("Unable to get an IP on %s for %s (last reported %q): %s", network, vm.Reference(), last, err)
+	}
+	return ip, nil
+}
+
+// waitForIP watches the property p of vm until ip returns an address from one
+// of its values
+func (s *Session) waitForIP(ctx context.Context, vm *object.VirtualMachine, p string, ip func(val interface{}) string) (string, error) {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var found string
+	err := s.WatchProperties(wctx, vm.Reference(), []string{p}, func(changes []types.PropertyChange) {
+		for _, c := range changes {
+			if c.Name != p || found != "" {
+				continue
+			}
+
+			if found = ip(c.Val); found != "" {
+				cancel()
+			}
+		}
+	})
+
+	if found != "" {
+		return found, nil
+	}
+	return "", err
+}
+
+// usableIP returns whether ip is an address that can be used to reach a guest
+func usableIP(ip string) bool {
+	addr := net.ParseIP(ip)
+	return addr != nil && !addr.IsUnspecified() && !addr.IsLinkLocalUnicast()
+}
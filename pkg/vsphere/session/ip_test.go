@@ -0,0 +1,123 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// propertyRoundTripper answers the property collector calls made by a watch,
+// reporting each of changes in turn and then blocking until cancelled
+type propertyRoundTripper struct {
+	changes []types.PropertyChange
+}
+
+func (f *propertyRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	switch res := res.(type) {
+	case *methods.CreatePropertyCollectorBody:
+		res.Res = &types.CreatePropertyCollectorResponse{Returnval: types.ManagedObjectReference{Type: "PropertyCollector", Value: "session[1]"}}
+	case *methods.CreateFilterBody:
+		res.Res = &types.CreateFilterResponse{}
+	case *methods.DestroyPropertyCollectorBody:
+		res.Res = &types.DestroyPropertyCollectorResponse{}
+	case *methods.WaitForUpdatesExBody:
+		if len(f.changes) == 0 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		change := f.changes[0]
+		f.changes = f.changes[1:]
+
+		res.Res = &types.WaitForUpdatesExResponse{
+			Returnval: &types.UpdateSet{
+				FilterSet: []types.PropertyFilterUpdate{
+					{ObjectSet: []types.ObjectUpdate{{ChangeSet: []types.PropertyChange{change}}}},
+				},
+			},
+		}
+	}
+	return nil
+}
+
+func propertySession(changes ...types.PropertyChange) (*Session, *object.VirtualMachine) {
+	client := &vim25.Client{RoundTripper: &propertyRoundTripper{changes: changes}}
+
+	s := NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+	return s, object.NewVirtualMachine(client, types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-42"})
+}
+
+func ipChange(ip string) types.PropertyChange {
+	return types.PropertyChange{Name: "guest.ipAddress", Op: types.PropertyChangeOpAssign, Val: ip}
+}
+
+func TestWaitForIP(t *testing.T) {
+	s, vm := propertySession(ipChange(""), ipChange("169.254.3.4"), ipChange("fe80::1"), ipChange("10.0.0.5"))
+
+	ip, err := s.WaitForIP(context.Background(), vm)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", ip)
+}
+
+func TestWaitForIPTimeout(t *testing.T) {
+	s, vm := propertySession(ipChange("169.254.3.4"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := s.WaitForIP(ctx, vm)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "169.254.3.4", "expected the last reported address")
+	}
+}
+
+func TestWaitForNetworkIP(t *testing.T) {
+	nics := func(nics ...types.GuestNicInfo) types.PropertyChange {
+		return types.PropertyChange{Name: "guest.net", Op: types.PropertyChangeOpAssign, Val: types.ArrayOfGuestNicInfo{GuestNicInfo: nics}}
+	}
+
+	s, vm := propertySession(
+		nics(types.GuestNicInfo{Network: "VM Network", IpAddress: []string{"10.0.0.5"}}),
+		nics(
+			types.GuestNicInfo{Network: "VM Network", IpAddress: []string{"10.0.0.5"}},
+			types.GuestNicInfo{Network: "bridge", MacAddress: "00:50:56:aa:bb:cc", IpAddress: []string{"fe80::1", "172.16.0.2"}},
+		),
+	)
+
+	ip, err := s.WaitForNetworkIP(context.Background(), vm, "bridge")
+	assert.NoError(t, err)
+	assert.Equal(t, "172.16.0.2", ip)
+
+	s, vm = propertySession(nics(types.GuestNicInfo{Network: "bridge", MacAddress: "00:50:56:aa:bb:cc", IpAddress: []string{"fe80::1"}}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = s.WaitForNetworkIP(ctx, vm, "00:50:56:aa:bb:cc")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "fe80::1")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net/url"
+	"reflect"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// unstickyLogins bounds the logins confirmLogin attempts before giving up on
+// reaching a node that knows the session
+const unstickyLogins = 3
+
+// reloginKey marks the context of the requests made while logging in, which must
+// not themselves trigger a login
+type reloginKey struct{}
+
+// reauth logs in again and retries the request once if it fails with a
+// NotAuthenticated fault, for sessions that aren't StickySession
+type reauth struct {
+	soap.RoundTripper
+
+	owner *clientOwner
+}
+
+// clientOwner is the session whose credentials reauth logs in with, handed on
+// to whichever session takes over the client
+type clientOwner struct {
+	mu sync.Mutex
+	s  *Session
+}
+
+func (o *clientOwner) session() *Session {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.s
+}
+
+func (o *clientOwner) set(s *Session) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.s = s
+}
+
+func (r reauth) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	err := r.RoundTripper.RoundTrip(ctx, req, res)
+	if !isNotAuthenticated(err) || ctx.Value(reloginKey{}) != nil {
+		return err
+	}
+
+	log.Debugf("%s was not authenticated, logging in again", soapMethod(req))
+	if lerr := r.owner.session().relogin(ctx); lerr != nil {
+		log.Debugf("Unable to log in again after %s: %s", err, lerr)
+		return err
+	}
+
+	// the decoder leaves fields absent from the response as they were, the fault included
+	resetResponse(res)
+	return r.RoundTripper.RoundTrip(ctx, req, res)
+}
+
+// resetResponse zeroes the response body res points to
+func resetResponse(res soap.HasFault) {
+	v := reflect.ValueOf(res)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+}
+
+// confirmLogin checks that the server session client has just logged in to is
+// known to the server, logging in again if the request reached a node that
+// doesn't know it, as may happen behind a load balancer without affinity
+func (s *Session) confirmLogin(ctx context.Context, client *govmomi.Client, user *url.Userinfo) error {
+	ctx = context.WithValue(ctx, reloginKey{}, true)
+
+	for attempt := 1; ; attempt++ {
+		// depending on how the fault is wrapped UserSession reports we're not
+		// authenticated either as a nil session or as the fault itself
+		us, err := client.SessionManager.UserSession(ctx)
+		if err == nil && us != nil {
+			return nil
+		}
+		if err != nil && !isNotAuthenticated(err) {
+			// this says nothing about which node was reached
+			log.Debugf("Unable to confirm login: %s", err)
+			return nil
+		}
+
+		if attempt >= unstickyLogins {
+			return errors.Errorf("Session was not recognized after %d logins", attempt)
+		}
+
+		log.Debugf("Session was not recognized after login, logging in again")
+		if err = s.login(ctx, client, user); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+const (
+	currentSessionResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<soapenv:Body><RetrievePropertiesResponse xmlns="urn:vim25"><returnval><obj type="SessionManager">SessionManager</obj>
+<propSet><name>currentSession</name><val xsi:type="UserSession"><key>52</key><userName>root</userName><fullName>root</fullName><loginTime>2016-04-01T00:00:00Z</loginTime><lastActiveTime>2016-04-01T00:00:00Z</lastActiveTime><locale>en</locale><messageLocale>en</messageLocale><extensionSession>false</extensionSession></val></propSet>
+</returnval></RetrievePropertiesResponse></soapenv:Body>
+</soapenv:Envelope>`
+
+	notAuthenticatedFault = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><soapenv:Fault><faultcode>ServerFaultCode</faultcode><faultstring>The session is not authenticated.</faultstring><detail><NotAuthenticatedFault xmlns="urn:vim25" xsi:type="NotAuthenticated" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"></NotAuthenticatedFault></detail></soapenv:Fault></soapenv:Body>
+</soapenv:Envelope>`
+)
+
+// balancer imitates a load balancer without affinity in front of nodes that
+// don't share sessions: a login only lands on the node serving the following
+// requests once the logins in strays have been used up
+type balancer struct {
+	mu     sync.Mutex
+	logins int
+	strays int
+	known  bool
+}
+
+func (b *balancer) handler(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/xml")
+	switch {
+	case strings.Contains(string(body), "<RetrieveServiceContent "):
+		w.Write([]byte(serviceContentResponse))
+	case strings.Contains(string(body), "<Login "):
+		b.logins++
+		b.known = b.strays == 0
+		if b.strays > 0 {
+			b.strays--
+		}
+		w.Write([]byte(loginResponse))
+	case strings.Contains(string(body), "<Logout "):
+		w.Write([]byte(logoutResponse))
+	case strings.Contains(string(body), "<RetrieveProperties ") && b.known:
+		w.Write([]byte(currentSessionResponse))
+	case strings.Contains(string(body), "<RetrieveProperties "):
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(notAuthenticatedFault))
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(notImplementedFault))
+	}
+}
+
+// reroute makes the balancer send the following requests to another node
+func (b *balancer) reroute(strays int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.known = false
+	b.strays = strays
+}
+
+func (b *balancer) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.logins
+}
+
+func TestUnstickySession(t *testing.T) {
+	ctx := context.Background()
+
+	b := &balancer{strays: 1}
+	server := httptest.NewTLSServer(http.HandlerFunc(b.handler))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	sticky := false
+	config := &Config{Service: "root:pass@" + host + "/sdk", Insecure: true, StickySession: &sticky}
+
+	// the first login went astray, so Connect logs in again
+	s, err := NewSession(config).Connect(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, b.count())
+
+	_, err = s.UserSession(ctx)
+	assert.NoError(t, err)
+
+	// and later requests reaching another node log in again transparently
+	b.reroute(0)
+	_, err = s.UserSession(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, b.count())
+
+	assert.NoError(t, s.Logout(ctx))
+
+	// logins that never reach a node that knows them fail in the end
+	b.reroute(unstickyLogins)
+	_, err = NewSession(config).Connect(ctx)
+	assert.True(t, errors.Is(err, ErrLoginFailed), "%s", err)
+	assert.Equal(t, 3+unstickyLogins, b.count())
+}
+
+func TestStickySession(t *testing.T) {
+	ctx := context.Background()
+
+	b := &balancer{strays: 1}
+	server := httptest.NewTLSServer(http.HandlerFunc(b.handler))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	sticky := true
+	config := &Config{Service: "root:pass@" + host + "/sdk", Insecure: true, StickySession: &sticky}
+
+	// a sticky session trusts the first login
+	s, err := NewSession(config).Connect(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, b.count())
+
+	// and leaves it to the caller to handle its expiry
+	_, err = s.UserSession(ctx)
+	assert.True(t, isNotAuthenticated(err), "%s", err)
+	assert.Equal(t, 1, b.count())
+
+	// as sessions are by default
+	b.reroute(1)
+	s, err = NewSession(&Config{Service: config.Service, Insecure: true}).Connect(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, b.count(), "Expected no confirmation of the login")
+	_, err = s.UserSession(ctx)
+	assert.True(t, isNotAuthenticated(err), "%s", err)
+}
@@ -0,0 +1,143 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/license"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// licenseTTL is how long the licenses HasFeature queries are cached for
+const licenseTTL = 5 * time.Minute
+
+// cachedLicenses are the licenses of an entity as of when they were queried
+type cachedLicenses struct {
+	licenses []types.LicenseManagerLicenseInfo
+	queried  time.Time
+}
+
+// LicenseManager returns the license manager of the session client, or nil if
+// the session isn't connected
+func (s *Session) LicenseManager() *license.Manager {
+	client := s.client()
+	if client == nil {
+		return nil
+	}
+
+	return license.NewManager(client.Client)
+}
+
+// HasFeature returns whether a license assigned to the cached Cluster or Host
+// includes the feature key, such as "drs" or "vsan", optionally with a minimum
+// level after a colon. On ESXi, which doesn't assign licenses, the host's own
+// licenses are checked. The licenses are cached for a few minutes.
+func (s *Session) HasFeature(ctx context.Context, key string) (bool, error) {
+	var entities []string
+	if cluster := s.GetCluster(); cluster != nil {
+		entities = append(entities, cluster.Reference().Value)
+	}
+	if host := s.GetHost(); host != nil {
+		entities = append(entities, host.Reference().Value)
+	}
+	if len(entities) == 0 {
+		return false, errors.New("No cluster or host is cached in this session")
+	}
+
+	for _, entity := range entities {
+		licenses, err := s.licenses(ctx, entity)
+		if err != nil {
+			return false, err
+		}
+
+		if len(license.InfoList(licenses).WithFeature(key)) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// licenses returns the licenses assigned to entity, or on servers without an
+// assignment manager all of them, from the cache unless it has expired
+func (s *Session) licenses(ctx context.Context, entity string) ([]types.LicenseManagerLicenseInfo, error) {
+	client := s.client()
+	if client == nil {
+		return nil, ErrSessionExpired
+	}
+
+	if cached, ok := s.cachedLicenses(client, entity); ok {
+		return cached, nil
+	}
+
+	m := license.NewManager(client.Client)
+
+	var licenses []types.LicenseManagerLicenseInfo
+	err := s.bounded(ctx, "license query", func(ctx context.Context) error {
+		am, err := m.AssignmentManager(ctx)
+		if err == object.ErrNotSupported {
+			licenses, err = m.List(ctx)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		assigned, err := am.QueryAssigned(ctx, entity)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range assigned {
+			licenses = append(licenses, a.AssignedLicense)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.lcl.Lock()
+	if s.lcc != client {
+		s.lc = make(map[string]cachedLicenses)
+		s.lcc = client
+	}
+	s.lc[entity] = cachedLicenses{licenses: licenses, queried: time.Now()}
+	s.lcl.Unlock()
+
+	return licenses, nil
+}
+
+// cachedLicenses returns the cached licenses of entity if they were queried by
+// client within licenseTTL
+func (s *Session) cachedLicenses(client *govmomi.Client, entity string) ([]types.LicenseManagerLicenseInfo, bool) {
+	s.lcl.Lock()
+	defer s.lcl.Unlock()
+
+	if s.lcc != client {
+		return nil, false
+	}
+
+	cached, ok := s.lc[entity]
+	if !ok || time.Since(cached.queried) > licenseTTL {
+		return nil, false
+	}
+	return cached.licenses, true
+}
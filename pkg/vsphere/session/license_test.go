@@ -0,0 +1,73 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestHasFeature(t *testing.T) {
+	ctx := context.Background()
+
+	s := NewSession(&Config{})
+	assert.Nil(t, s.LicenseManager())
+
+	_, err := s.HasFeature(ctx, "drs")
+	assert.Error(t, err, "Expected an error with nothing cached")
+
+	s.Client = &govmomi.Client{Client: &vim25.Client{}}
+	s.Host = object.NewHostSystem(s.Client.Client, types.ManagedObjectReference{Type: "HostSystem", Value: "host-22"})
+
+	enterprise := types.LicenseManagerLicenseInfo{
+		Name: "vSphere 6 Enterprise Plus",
+		Properties: []types.KeyAnyValue{
+			{Key: "ProductName", Value: "VMware ESX Server"},
+			{Key: "feature", Value: types.KeyValue{Key: "drs", Value: "vSphere DRS"}},
+			{Key: "feature", Value: types.KeyValue{Key: "vmotion:2", Value: "vMotion"}},
+		},
+	}
+
+	// recent queries are answered from the cache, without a round trip
+	s.lcc = s.Client
+	s.lc = map[string]cachedLicenses{
+		"host-22": {licenses: []types.LicenseManagerLicenseInfo{enterprise}, queried: time.Now()},
+	}
+
+	for key, expected := range map[string]bool{"drs": true, "vmotion": true, "vmotion:3": false, "vsan": false} {
+		has, err := s.HasFeature(ctx, key)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, has, key)
+	}
+
+	// but not those of another client
+	s.lcc = nil
+	_, ok := s.cachedLicenses(s.Client, "host-22")
+	assert.False(t, ok)
+
+	// nor once they've expired
+	s.lcc = s.Client
+	s.lc["host-22"] = cachedLicenses{licenses: []types.LicenseManagerLicenseInfo{enterprise}, queried: time.Now().Add(-licenseTTL - time.Second)}
+	_, ok = s.cachedLicenses(s.Client, "host-22")
+	assert.False(t, ok)
+}
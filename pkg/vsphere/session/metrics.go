@@ -0,0 +1,46 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import "time"
+
+// Metrics records the health of sessions for an operator. It is deliberately
+// small so that it can be backed by Prometheus, or anything else, without this
+// package depending on it: for example by a CounterVec of connects labelled by
+// outcome, a Histogram of populate durations and a Gauge of active sessions.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveConnect records the outcome of a Connect, err being nil on success
+	ObserveConnect(err error)
+	// ObservePopulate records the duration and outcome of a Populate
+	ObservePopulate(d time.Duration, err error)
+	// AddActiveSessions adjusts the number of active sessions by delta
+	AddActiveSessions(delta int)
+}
+
+// nopMetrics discards everything, for when Config.Metrics is nil
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveConnect(error)                 {}
+func (nopMetrics) ObservePopulate(time.Duration, error) {}
+func (nopMetrics) AddActiveSessions(int)                {}
+
+// metrics returns Metrics, or a recorder that discards everything if nil
+func (c *Config) metrics() Metrics {
+	if c.Metrics == nil {
+		return nopMetrics{}
+	}
+	return c.Metrics
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/vic/pkg/vsphere/test/env"
+)
+
+// recorder is a Metrics that keeps everything it is given
+type recorder struct {
+	mu        sync.Mutex
+	connects  []error
+	populates []error
+	active    int
+}
+
+func (r *recorder) ObserveConnect(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.connects = append(r.connects, err)
+}
+
+func (r *recorder) ObservePopulate(d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.populates = append(r.populates, err)
+}
+
+func (r *recorder) AddActiveSessions(delta int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.active += delta
+}
+
+func TestMetricsConnectFailure(t *testing.T) {
+	rec := &recorder{}
+
+	_, err := NewSession(&Config{Metrics: rec}).Connect(context.Background())
+	assert.Error(t, err)
+
+	if assert.Len(t, rec.connects, 1) {
+		assert.Error(t, rec.connects[0])
+	}
+	assert.Equal(t, 0, rec.active)
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	rec := &recorder{}
+
+	config := &Config{
+		Service:  env.URL(t),
+		Insecure: true,
+		Metrics:  rec,
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+
+	assert.Equal(t, []error{nil}, rec.connects)
+	assert.Equal(t, []error{nil}, rec.populates)
+	assert.Equal(t, 1, rec.active)
+
+	// connecting again reuses the session without counting it twice
+	_, err = session.Connect(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, rec.connects, 1)
+	assert.Equal(t, 1, rec.active)
+
+	assert.NoError(t, session.Logout(ctx))
+	assert.Equal(t, 0, rec.active)
+}
@@ -0,0 +1,192 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// parseMoRef returns the reference path names if it has the form "Type:value"
+// with Type one of kinds. Anything else is taken to be an inventory path, which
+// is all but certain not to start with a managed object type and a colon.
+func parseMoRef(path string, kinds ...string) (types.ManagedObjectReference, bool) {
+	i := strings.Index(path, ":")
+	if i <= 0 || i == len(path)-1 {
+		return types.ManagedObjectReference{}, false
+	}
+
+	ref := types.ManagedObjectReference{Type: path[:i], Value: path[i+1:]}
+	for _, kind := range kinds {
+		if ref.Type == kind {
+			return ref, true
+		}
+	}
+	return types.ManagedObjectReference{}, false
+}
+
+// byMoRef returns the object ref refers to, with its inventory path set where
+// the object has one, once it's been confirmed to exist
+func (s *Session) byMoRef(ctx context.Context, ref types.ManagedObjectReference) (object.Reference, error) {
+	o := s.ObjectFromRef(ref)
+	if o == nil {
+		return nil, ErrSessionExpired
+	}
+
+	p, ok, err := s.inventoryPath(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.Errorf("%s:%s does not exist", ref.Type, ref.Value)
+	}
+
+	switch o := o.(type) {
+	case *object.ClusterComputeResource:
+		o.InventoryPath = p
+	case *object.ComputeResource:
+		o.InventoryPath = p
+	case *object.HostSystem:
+		o.InventoryPath = p
+	case *object.ResourcePool:
+		o.InventoryPath = p
+	case *object.Folder:
+		o.InventoryPath = p
+	case *object.Datastore:
+		o.InventoryPath = p
+	case *object.Network:
+		o.InventoryPath = p
+	case *object.DistributedVirtualPortgroup:
+		o.InventoryPath = p
+	}
+	return o, nil
+}
+
+// moRefResolvers returns resolvers with those that aren't set filled in for
+// the Config paths that are managed object references
+func (s *Session) moRefResolvers(resolvers *Resolvers) *Resolvers {
+	r := *resolvers
+
+	if ref, ok := parseMoRef(s.DatacenterPath, "Datacenter"); ok && r.DatacenterResolver == nil {
+		r.DatacenterResolver = func(ctx context.Context, _ *find.Finder) (*object.Datacenter, error) {
+			o, err := s.byMoRef(ctx, ref)
+			if err != nil {
+				return nil, err
+			}
+			return o.(*object.Datacenter), nil
+		}
+	}
+
+	if ref, ok := parseMoRef(s.ClusterPath, "ComputeResource", "ClusterComputeResource"); ok && r.ClusterResolver == nil {
+		r.ClusterResolver = func(ctx context.Context, _ *find.Finder) (*object.ComputeResource, error) {
+			o, err := s.byMoRef(ctx, ref)
+			if err != nil {
+				return nil, err
+			}
+			if cluster, ok := o.(*object.ClusterComputeResource); ok {
+				return &cluster.ComputeResource, nil
+			}
+			return o.(*object.ComputeResource), nil
+		}
+	}
+
+	if ref, ok := parseMoRef(s.HostPath, "HostSystem"); ok && r.HostResolver == nil {
+		r.HostResolver = func(ctx context.Context, _ *find.Finder) (*object.HostSystem, error) {
+			o, err := s.byMoRef(ctx, ref)
+			if err != nil {
+				return nil, err
+			}
+			return o.(*object.HostSystem), nil
+		}
+	}
+
+	if ref, ok := parseMoRef(s.PoolPath, "ResourcePool"); ok && r.PoolResolver == nil {
+		r.PoolResolver = func(ctx context.Context, _ *find.Finder) (*object.ResourcePool, error) {
+			o, err := s.byMoRef(ctx, ref)
+			if err != nil {
+				return nil, err
+			}
+			return o.(*object.ResourcePool), nil
+		}
+	}
+
+	if ref, ok := parseMoRef(s.FolderPath, "Folder"); ok && r.FolderResolver == nil {
+		r.FolderResolver = func(ctx context.Context, _ *find.Finder) (*object.Folder, error) {
+			o, err := s.byMoRef(ctx, ref)
+			if err != nil {
+				return nil, err
+			}
+			return o.(*object.Folder), nil
+		}
+	}
+
+	// DatastorePaths and NetworkPaths are resolved entry by entry instead
+	if len(s.DatastorePaths) == 0 && r.DatastoreResolver == nil {
+		if _, ok := parseMoRef(s.DatastorePath, "Datastore"); ok {
+			r.DatastoreResolver = func(ctx context.Context, finder *find.Finder) (*object.Datastore, error) {
+				return s.datastoreByPath(ctx, finder, s.DatastorePath)
+			}
+		}
+	}
+
+	if len(s.NetworkPaths) == 0 && r.NetworkResolver == nil {
+		if _, ok := parseMoRef(s.NetworkPath, networkTypes...); ok {
+			r.NetworkResolver = func(ctx context.Context, finder *find.Finder) (object.NetworkReference, error) {
+				return s.networkByPath(ctx, finder, s.NetworkPath)
+			}
+		}
+	}
+
+	return &r
+}
+
+// networkTypes are the managed object types a network reference may have
+var networkTypes = []string{"Network", "DistributedVirtualPortgroup"}
+
+// datastoreByPath returns the datastore path refers to, either by inventory
+// path or managed object reference
+func (s *Session) datastoreByPath(ctx context.Context, finder *find.Finder, path string) (*object.Datastore, error) {
+	ref, ok := parseMoRef(path, "Datastore")
+	if !ok {
+		return finder.Datastore(ctx, path)
+	}
+
+	o, err := s.byMoRef(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return o.(*object.Datastore), nil
+}
+
+// networkByPath returns the network path refers to, either by inventory path
+// or managed object reference
+func (s *Session) networkByPath(ctx context.Context, finder *find.Finder, path string) (object.NetworkReference, error) {
+	ref, ok := parseMoRef(path, networkTypes...)
+	if !ok {
+		return finder.Network(ctx, path)
+	}
+
+	o, err := s.byMoRef(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return o.(object.NetworkReference), nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestParseMoRef(t *testing.T) {
+	ref, ok := parseMoRef("Datastore:datastore-42", "Datastore")
+	assert.True(t, ok)
+	assert.Equal(t, types.ManagedObjectReference{Type: "Datastore", Value: "datastore-42"}, ref)
+
+	_, ok = parseMoRef("Datastore:datastore-42", "Network")
+	assert.False(t, ok, "type not valid for the path")
+
+	for _, path := range []string{"", "/dc1/datastore/ds1", "ds1", "Datastore:", ":datastore-42", "[ds1] vm/vm.vmx"} {
+		_, ok = parseMoRef(path, "Datastore")
+		assert.False(t, ok, path)
+	}
+}
+
+// ancestorsResponse is the ancestry of datastore-42 in dc1, ordered from the
+// datastore up as the server returns it
+var ancestorsResponse = fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<soapenv:Body><RetrievePropertiesResponse xmlns="urn:vim25">%s%s%s%s</RetrievePropertiesResponse></soapenv:Body>
+</soapenv:Envelope>`,
+	entity("Datastore", "datastore-42", "ds1", `<val type="Folder" xsi:type="ManagedObjectReference">group-s5</val>`),
+	entity("Folder", "group-s5", "datastore", `<val type="Datacenter" xsi:type="ManagedObjectReference">datacenter-2</val>`),
+	entity("Datacenter", "datacenter-2", "dc1", `<val type="Folder" xsi:type="ManagedObjectReference">group-d1</val>`),
+	entity("Folder", "group-d1", "Datacenters", ""))
+
+const datastoreSummaryResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<soapenv:Body><RetrievePropertiesResponse xmlns="urn:vim25"><returnval><obj type="Datastore">datastore-42</obj>
+<propSet><name>summary.type</name><val xsi:type="xsd:string">VMFS</val></propSet></returnval></RetrievePropertiesResponse></soapenv:Body>
+</soapenv:Envelope>`
+
+// entity returns the name and parent of a managed entity as retrieved by mo.Ancestors
+func entity(kind, value, name, parent string) string {
+	if parent != "" {
+		parent = "<propSet><name>parent</name>" + parent + "</propSet>"
+	}
+	return fmt.Sprintf(`<returnval><obj type="%s">%s</obj><propSet><name>name</name><val xsi:type="xsd:string">%s</val></propSet>%s</returnval>`,
+		kind, value, name, parent)
+}
+
+func TestPopulateByMoRef(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		w.Header().Set("Content-Type", "text/xml")
+		if strings.Contains(string(body), `<obj type="Datastore">datastore-42</obj>`) {
+			if strings.Contains(string(body), "traverseParent") {
+				w.Write([]byte(ancestorsResponse))
+			} else {
+				w.Write([]byte(datastoreSummaryResponse))
+			}
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(managedObjectNotFoundFault))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	// not connected by Connect, so there is no finder unless given one
+	populate := func(config *Config) (*Session, error) {
+		s := ticketSession(server, config)
+		s.Finder = find.NewFinder(s.Vim25(), true)
+		_, err := s.Populate(ctx)
+		return s, err
+	}
+
+	s, err := populate(&Config{DatastorePath: "Datastore:datastore-42"})
+	require.NoError(t, err)
+
+	if assert.NotNil(t, s.Datastore) {
+		assert.Equal(t, "datastore-42", s.Datastore.Reference().Value)
+		assert.Equal(t, "/dc1/datastore/ds1", s.Datastore.InventoryPath)
+	}
+	assert.Len(t, s.Datastores, 1)
+
+	s, err = populate(&Config{DatastorePaths: []string{"Datastore:datastore-42", "Datastore:datastore-43"}})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Datastore:datastore-43 does not exist")
+	}
+	if assert.Len(t, s.Datastores, 1) {
+		assert.Equal(t, "/dc1/datastore/ds1", s.Datastores[0].InventoryPath)
+	}
+
+	_, err = populate(&Config{HostPath: "HostSystem:host-7"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "HostSystem:host-7 does not exist")
+	}
+}
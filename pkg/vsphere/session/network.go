@@ -0,0 +1,227 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"path"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// findDVS resolves path to a distributed virtual switch. The finder has no lookup
+// specific to switches, but lists them amongst the networks.
+func findDVS(ctx context.Context, finder *find.Finder, path string) (*object.DistributedVirtualSwitch, error) {
+	n, err := finder.Network(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch dvs := n.(type) {
+	case *object.DistributedVirtualSwitch:
+		return dvs, nil
+	case *object.VmwareDistributedVirtualSwitch:
+		return &dvs.DistributedVirtualSwitch, nil
+	}
+
+	return nil, errors.Errorf("%s is not a distributed virtual switch", path)
+}
+
+// DVSForNetwork returns the distributed virtual switch backing the cached network,
+// which must be a distributed virtual portgroup.
+func (s *Session) DVSForNetwork(ctx context.Context) (*object.DistributedVirtualSwitch, error) {
+	pg, ok := s.GetNetwork().(*object.DistributedVirtualPortgroup)
+	if !ok {
+		return nil, errors.New("The cached network is not a distributed virtual portgroup")
+	}
+
+	var mpg mo.DistributedVirtualPortgroup
+	if err := s.Properties(ctx, pg.Reference(), []string{"config.distributedVirtualSwitch"}, &mpg); err != nil {
+		return nil, err
+	}
+
+	ref := mpg.Config.DistributedVirtualSwitch
+	if ref == nil {
+		return nil, errors.Errorf("Portgroup %s has no distributed virtual switch", pg.Name())
+	}
+
+	// save creating a new object if it's the switch we already have
+	if dvs := s.GetDVS(); dvs != nil && dvs.Reference() == *ref {
+		return dvs, nil
+	}
+
+	return object.NewDistributedVirtualSwitch(pg.Client(), *ref), nil
+}
+
+// CreatePortgroup adds a portgroup named name, its other settings taken from
+// spec, to the cached DVS and returns it once the task completes. Should the
+// switch already have a portgroup named name that one is returned instead, with
+// spec left unapplied. Portgroups default to static binding.
+func (s *Session) CreatePortgroup(ctx context.Context, name string, spec types.DVPortgroupConfigSpec) (object.NetworkReference, error) {
+	dvs := s.GetDVS()
+	if dvs == nil {
+		return nil, errors.New("No distributed virtual switch is cached in this session")
+	}
+
+	spec.Name = name
+	if spec.Type == "" {
+		spec.Type = string(types.DistributedVirtualPortgroupPortgroupTypeEarlyBinding)
+	}
+
+	t, err := dvs.AddPortgroup(ctx, []types.DVPortgroupConfigSpec{spec})
+	if err == nil {
+		_, err = s.WaitForTask(ctx, t)
+	}
+	if err != nil && !isDuplicateName(err) {
+		return nil, err
+	}
+
+	// the task returns nothing, so look the portgroup up by name
+	pg, err := s.dvsPortgroup(ctx, dvs, name)
+	if err != nil {
+		return nil, err
+	}
+	return pg, nil
+}
+
+// dvsPortgroup returns the portgroup of dvs named name. It's given the path it
+// has in the network folder, alongside dvs, if the path of dvs is known.
+func (s *Session) dvsPortgroup(ctx context.Context, dvs *object.DistributedVirtualSwitch, name string) (*object.DistributedVirtualPortgroup, error) {
+	var mdvs mo.DistributedVirtualSwitch
+	if err := s.Properties(ctx, dvs.Reference(), []string{"portgroup"}, &mdvs); err != nil {
+		return nil, err
+	}
+
+	var pgs []mo.DistributedVirtualPortgroup
+	if len(mdvs.Portgroup) > 0 {
+		pc := s.PropertyCollector()
+		if pc == nil {
+			return nil, ErrSessionExpired
+		}
+		if err := pc.Retrieve(ctx, mdvs.Portgroup, []string{"name"}, &pgs); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, mpg := range pgs {
+		if mpg.Name != name {
+			continue
+		}
+
+		pg := object.NewDistributedVirtualPortgroup(dvs.Client(), mpg.Reference())
+		if dvs.InventoryPath != "" {
+			pg.InventoryPath = path.Join(path.Dir(dvs.InventoryPath), name)
+		}
+		return pg, nil
+	}
+
+	return nil, errors.Errorf("Distributed virtual switch %s has no portgroup %s", dvs.Reference().Value, name)
+}
+
+// NetworkByMoRef returns the cached network with the given reference, or if none
+// is cached a new object for it, provided it's a network or distributed virtual
+// portgroup. A new object has no inventory path.
+func (s *Session) NetworkByMoRef(ref types.ManagedObjectReference) (object.NetworkReference, error) {
+	for _, network := range s.GetNetworks() {
+		if network.Reference() == ref {
+			return network, nil
+		}
+	}
+
+	if network := s.GetNetwork(); network != nil && network.Reference() == ref {
+		return network, nil
+	}
+
+	client := s.client()
+	if client == nil {
+		return nil, ErrSessionExpired
+	}
+
+	switch ref.Type {
+	case "Network":
+		return object.NewNetwork(client.Client, ref), nil
+	case "DistributedVirtualPortgroup":
+		return object.NewDistributedVirtualPortgroup(client.Client, ref), nil
+	}
+
+	return nil, errors.Errorf("%s:%s is not a network", ref.Type, ref.Value)
+}
+
+// EthernetCardBackingInfo returns the backing connecting an ethernet card to
+// network, or to the cached Network if network is nil: a port of the switch for
+// a distributed virtual portgroup, or the network by name for a standard one.
+func (s *Session) EthernetCardBackingInfo(ctx context.Context, network object.NetworkReference) (types.BaseVirtualDeviceBackingInfo, error) {
+	if network == nil {
+		network = s.GetNetwork()
+	}
+	if network == nil {
+		return nil, errors.New("No network is cached in this session")
+	}
+
+	switch n := network.(type) {
+	case *object.DistributedVirtualPortgroup:
+		return s.portgroupBacking(ctx, n)
+	case *object.Network:
+		name := n.Name()
+		if n.InventoryPath == "" {
+			// the name is taken from the path, which objects made from a reference lack
+			var mn mo.Network
+			if err := s.Properties(ctx, n.Reference(), []string{"name"}, &mn); err != nil {
+				return nil, err
+			}
+			name = mn.Name
+		}
+
+		return &types.VirtualEthernetCardNetworkBackingInfo{
+			VirtualDeviceDeviceBackingInfo: types.VirtualDeviceDeviceBackingInfo{
+				DeviceName: name,
+			},
+		}, nil
+	}
+
+	return network.EthernetCardBackingInfo(ctx)
+}
+
+// portgroupBacking returns the backing for a port of pg's switch. Unlike that of
+// the vendored portgroup it copes with a portgroup that has no switch.
+func (s *Session) portgroupBacking(ctx context.Context, pg *object.DistributedVirtualPortgroup) (types.BaseVirtualDeviceBackingInfo, error) {
+	var mpg mo.DistributedVirtualPortgroup
+	if err := s.Properties(ctx, pg.Reference(), []string{"key", "config.distributedVirtualSwitch"}, &mpg); err != nil {
+		return nil, err
+	}
+
+	ref := mpg.Config.DistributedVirtualSwitch
+	if ref == nil {
+		return nil, errors.Errorf("Portgroup %s has no distributed virtual switch", mpg.Key)
+	}
+
+	// the switches are VMware's in practice, as the vendored portgroup assumes
+	var mdvs mo.VmwareDistributedVirtualSwitch
+	if err := s.Properties(ctx, *ref, []string{"uuid"}, &mdvs); err != nil {
+		return nil, err
+	}
+
+	return &types.VirtualEthernetCardDistributedVirtualPortBackingInfo{
+		Port: types.DistributedVirtualSwitchPortConnection{
+			PortgroupKey: mpg.Key,
+			SwitchUuid:   mdvs.Uuid,
+		},
+	}, nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestNetworkByMoRef(t *testing.T) {
+	ref := types.ManagedObjectReference{Type: "Network", Value: "network-7"}
+	cached := object.NewNetwork(nil, ref)
+
+	s := NewSession(&Config{})
+	s.Networks = []object.NetworkReference{cached}
+
+	network, err := s.NetworkByMoRef(ref)
+	assert.NoError(t, err)
+	assert.Equal(t, cached, network)
+
+	// anything else needs a client to make an object for
+	_, err = s.NetworkByMoRef(types.ManagedObjectReference{Type: "Network", Value: "network-8"})
+	assert.Equal(t, ErrSessionExpired, err)
+}
+
+func TestEthernetCardBackingInfo(t *testing.T) {
+	ctx := context.Background()
+
+	s := NewSession(&Config{})
+	_, err := s.EthernetCardBackingInfo(ctx, nil)
+	assert.Error(t, err, "Expected an error with nothing cached")
+
+	network := object.NewNetwork(nil, types.ManagedObjectReference{Type: "Network", Value: "network-7"})
+	network.InventoryPath = "/dc1/network/VM Network"
+	s.Network = network
+
+	backing, err := s.EthernetCardBackingInfo(ctx, nil)
+	if assert.NoError(t, err) {
+		if b, ok := backing.(*types.VirtualEthernetCardNetworkBackingInfo); assert.True(t, ok, "Got %T", backing) {
+			assert.Equal(t, "VM Network", b.DeviceName)
+		}
+	}
+
+	// the override is used in place of the cached network
+	other := object.NewNetwork(nil, types.ManagedObjectReference{Type: "Network", Value: "network-9"})
+	other.InventoryPath = "/dc1/network/Storage"
+
+	backing, err = s.EthernetCardBackingInfo(ctx, other)
+	if assert.NoError(t, err) {
+		if b, ok := backing.(*types.VirtualEthernetCardNetworkBackingInfo); assert.True(t, ok, "Got %T", backing) {
+			assert.Equal(t, "Storage", b.DeviceName)
+		}
+	}
+}
+
+// portgroupRoundTripper is a switch with the portgroups named by their
+// references, adding those requested. The task waits are left to
+// taskRoundTripper, so each add must be matched by one of its infos.
+type portgroupRoundTripper struct {
+	taskRoundTripper
+
+	portgroups map[string]types.ManagedObjectReference
+	added      []types.DVPortgroupConfigSpec
+}
+
+func (f *portgroupRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	switch res := res.(type) {
+	case *methods.AddDVPortgroup_TaskBody:
+		for _, spec := range req.(*methods.AddDVPortgroup_TaskBody).Req.Spec {
+			f.added = append(f.added, spec)
+			if _, ok := f.portgroups[spec.Name]; !ok {
+				f.portgroups[spec.Name] = types.ManagedObjectReference{Type: "DistributedVirtualPortgroup", Value: fmt.Sprintf("dvportgroup-%d", 10+len(f.portgroups))}
+			}
+		}
+		res.Res = &types.AddDVPortgroup_TaskResponse{Returnval: types.ManagedObjectReference{Type: "Task", Value: "task-1"}}
+	case *methods.RetrievePropertiesBody:
+		spec := req.(*methods.RetrievePropertiesBody).Req.SpecSet[0]
+
+		var contents []types.ObjectContent
+		if spec.PropSet[0].PathSet[0] == "portgroup" {
+			var refs []types.ManagedObjectReference
+			for _, ref := range f.portgroups {
+				refs = append(refs, ref)
+			}
+			contents = append(contents, types.ObjectContent{
+				Obj:     spec.ObjectSet[0].Obj,
+				PropSet: []types.DynamicProperty{{Name: "portgroup", Val: types.ArrayOfManagedObjectReference{ManagedObjectReference: refs}}},
+			})
+		} else {
+			for name, ref := range f.portgroups {
+				contents = append(contents, types.ObjectContent{Obj: ref, PropSet: []types.DynamicProperty{{Name: "name", Val: name}}})
+			}
+		}
+		res.Res = &types.RetrievePropertiesResponse{Returnval: contents}
+	default:
+		return f.taskRoundTripper.RoundTrip(ctx, req, res)
+	}
+	return nil
+}
+
+func TestCreatePortgroup(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewSession(&Config{}).CreatePortgroup(ctx, "bridge", types.DVPortgroupConfigSpec{})
+	assert.Error(t, err, "Expected an error without a cached switch")
+
+	duplicate := &types.LocalizedMethodFault{Fault: &types.DuplicateName{Name: "VM Network"}, LocalizedMessage: "The name 'VM Network' already exists."}
+	rt := &portgroupRoundTripper{
+		taskRoundTripper: taskRoundTripper{infos: []types.TaskInfo{
+			{State: types.TaskInfoStateSuccess},
+			{State: types.TaskInfoStateError, Error: duplicate},
+		}},
+		portgroups: map[string]types.ManagedObjectReference{
+			"VM Network": {Type: "DistributedVirtualPortgroup", Value: "dvportgroup-2"},
+		},
+	}
+	client := &vim25.Client{RoundTripper: rt}
+
+	s := NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+	s.DVS = object.NewDistributedVirtualSwitch(client, types.ManagedObjectReference{Type: "VmwareDistributedVirtualSwitch", Value: "dvs-1"})
+	s.DVS.InventoryPath = "/dc1/network/dvs1"
+
+	network, err := s.CreatePortgroup(ctx, "bridge", types.DVPortgroupConfigSpec{NumPorts: 128})
+	require.NoError(t, err)
+
+	if pg, ok := network.(*object.DistributedVirtualPortgroup); assert.True(t, ok, "Got %T", network) {
+		assert.Equal(t, rt.portgroups["bridge"], pg.Reference())
+		assert.Equal(t, "/dc1/network/bridge", pg.InventoryPath)
+	}
+	if assert.Len(t, rt.added, 1) {
+		assert.Equal(t, "bridge", rt.added[0].Name)
+		assert.EqualValues(t, 128, rt.added[0].NumPorts)
+		assert.Equal(t, string(types.DistributedVirtualPortgroupPortgroupTypeEarlyBinding), rt.added[0].Type)
+	}
+
+	// an existing portgroup is returned in place of the fault
+	network, err = s.CreatePortgroup(ctx, "VM Network", types.DVPortgroupConfigSpec{})
+	require.NoError(t, err)
+	assert.Equal(t, "dvportgroup-2", network.Reference().Value)
+}
+
+func TestDVSForNetwork(t *testing.T) {
+	ctx := context.Background()
+
+	s := inventorySession()
+	s.Datacenter = nil
+	s.DatacenterPath = "/dc1"
+	s.NetworkPath = "/dc1/network/pg1"
+	s.DVSPath = "/dc1/network/dvs1"
+	_, err := s.Populate(ctx)
+	require.NoError(t, err)
+
+	if assert.NotNil(t, s.DVS) {
+		assert.Equal(t, "dvs-1", s.DVS.Reference().Value)
+		assert.Equal(t, "/dc1/network/dvs1", s.DVS.InventoryPath)
+	}
+
+	// the portgroup's switch is the one cached, so that's what's returned
+	dvs, err := s.DVSForNetwork(ctx)
+	require.NoError(t, err)
+	assert.True(t, dvs == s.DVS, "Expected the cached switch")
+
+	// otherwise it's taken from the portgroup's config
+	s.DVS = nil
+	dvs, err = s.DVSForNetwork(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, types.ManagedObjectReference{Type: "VmwareDistributedVirtualSwitch", Value: "dvs-1"}, dvs.Reference())
+
+	// and only portgroups have a switch
+	s.Network = object.NewNetwork(s.Vim25(), types.ManagedObjectReference{Type: "Network", Value: "network-1"})
+	_, err = s.DVSForNetwork(ctx)
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// OptionManager reads and writes the advanced settings of a server, such as
+// the config.vpxd options of VC, as the vendored govmomi has no equivalent
+type OptionManager struct {
+	object.Common
+}
+
+// Query returns the options named name, or whose keys start with name if it
+// ends in a dot, such as "config.vpxd."
+func (m OptionManager) Query(ctx context.Context, name string) ([]types.BaseOptionValue, error) {
+	req := types.QueryOptions{
+		This: m.Reference(),
+		Name: name,
+	}
+
+	res, err := methods.QueryOptions(ctx, m.Client(), &req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Returnval, nil
+}
+
+// Update sets the options in values, adding any that don't exist yet
+func (m OptionManager) Update(ctx context.Context, values []types.BaseOptionValue) error {
+	req := types.UpdateOptions{
+		This:         m.Reference(),
+		ChangedValue: values,
+	}
+
+	_, err := methods.UpdateOptions(ctx, m.Client(), &req)
+	return err
+}
+
+// OptionManager returns the advanced settings manager of the session client,
+// or nil if the session isn't connected
+func (s *Session) OptionManager() *OptionManager {
+	client := s.client()
+	if client == nil || client.ServiceContent.Setting == nil {
+		return nil
+	}
+
+	return &OptionManager{object.NewCommon(client.Client, *client.ServiceContent.Setting)}
+}
+
+// QueryOptions returns the advanced settings whose keys start with prefix,
+// which should end in a dot, such as "config.vpxd.", or the single setting
+// prefix names if it doesn't
+func (s *Session) QueryOptions(ctx context.Context, prefix string) ([]types.BaseOptionValue, error) {
+	m := s.OptionManager()
+	if m == nil {
+		return nil, ErrSessionExpired
+	}
+
+	var values []types.BaseOptionValue
+	err := s.bounded(ctx, "option query", func(ctx context.Context) (err error) {
+		values, err = m.Query(ctx, prefix)
+		return
+	})
+	return values, err
+}
+
+// UpdateOption sets the advanced setting key to value, which must be of the
+// type the setting has, such as a string or an int32. ReadOnly sessions refuse
+// with ErrReadOnly.
+func (s *Session) UpdateOption(ctx context.Context, key string, value interface{}) error {
+	m := s.OptionManager()
+	if m == nil {
+		return ErrSessionExpired
+	}
+
+	return s.bounded(ctx, "option update", func(ctx context.Context) error {
+		return m.Update(ctx, []types.BaseOptionValue{&types.OptionValue{Key: key, Value: value}})
+	})
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// optionRoundTripper holds the options of a fake OptionManager
+type optionRoundTripper struct {
+	options map[string]interface{}
+}
+
+func (f *optionRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	switch res := res.(type) {
+	case *methods.QueryOptionsBody:
+		name := req.(*methods.QueryOptionsBody).Req.Name
+
+		res.Res = &types.QueryOptionsResponse{}
+		for key, value := range f.options {
+			if key == name || (strings.HasSuffix(name, ".") && strings.HasPrefix(key, name)) {
+				res.Res.Returnval = append(res.Res.Returnval, &types.OptionValue{Key: key, Value: value})
+			}
+		}
+	case *methods.UpdateOptionsBody:
+		for _, v := range req.(*methods.UpdateOptionsBody).Req.ChangedValue {
+			value := v.GetOptionValue()
+			f.options[value.Key] = value.Value
+		}
+		res.Res = &types.UpdateOptionsResponse{}
+	}
+	return nil
+}
+
+func TestOptions(t *testing.T) {
+	ctx := context.Background()
+
+	s := NewSession(&Config{})
+	assert.Nil(t, s.OptionManager())
+	_, err := s.QueryOptions(ctx, "config.vpxd.")
+	assert.Equal(t, ErrSessionExpired, err)
+
+	rt := &optionRoundTripper{options: map[string]interface{}{
+		"config.vpxd.stats.maxQueryMetrics": int32(64),
+		"config.vpxd.hostnameUrl":           "vc.example.com",
+		"event.maxAge":                      int32(30),
+	}}
+	setting := types.ManagedObjectReference{Type: "OptionManager", Value: "VpxSettings"}
+	client := &vim25.Client{
+		RoundTripper:   rt,
+		ServiceContent: types.ServiceContent{Setting: &setting},
+	}
+	s = NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+
+	if m := s.OptionManager(); assert.NotNil(t, m) {
+		assert.Equal(t, setting, m.Reference())
+	}
+
+	values, err := s.QueryOptions(ctx, "config.vpxd.")
+	require.NoError(t, err)
+	assert.Len(t, values, 2)
+
+	require.NoError(t, s.UpdateOption(ctx, "config.vpxd.hostnameUrl", "vc2.example.com"))
+	values, err = s.QueryOptions(ctx, "config.vpxd.hostnameUrl")
+	require.NoError(t, err)
+	if assert.Len(t, values, 1) {
+		assert.Equal(t, "vc2.example.com", values[0].GetOptionValue().Value)
+	}
+
+	// read only sessions may still query
+	s.ReadOnly = true
+	client.RoundTripper = s.wrapRoundTripper(rt)
+	_, err = s.QueryOptions(ctx, "event.maxAge")
+	assert.NoError(t, err)
+	assert.Equal(t, ErrReadOnly, s.UpdateOption(ctx, "event.maxAge", int32(7)))
+	assert.Equal(t, int32(30), rt.options["event.maxAge"])
+}
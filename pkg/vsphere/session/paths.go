@@ -0,0 +1,161 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"path"
+	"strings"
+
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// NormalizePaths makes the Config's relative inventory paths absolute, in place,
+// so that a resource is resolved the same however its path was written:
+//
+//   - DatacenterPath is set to DefaultDatacenter if empty, and if relative is
+//     taken from the root folder, so "dc1" becomes "/dc1"
+//   - any other relative path is taken from the folder of its kind in that
+//     datacenter, as the finder does: host for ClusterPath, HostPath and
+//     PoolPath, vm for FolderPath and VirtualAppPath, datastore for
+//     DatastorePath, DatastorePaths and StoragePodPath, and network for
+//     NetworkPath, NetworkPaths and DVSPath. So with DatacenterPath "/dc1",
+//     the PoolPath "cluster1/Resources" becomes "/dc1/host/cluster1/Resources"
+//   - absolute paths only have repeated and trailing separators removed
+//   - empty paths and managed object references are left as they are
+//
+// Should DatacenterPath be a managed object reference, DefaultDatacenter is
+// the datacenter relative paths are taken from. An error naming the relative
+// paths is returned, and nothing changed, if there is no datacenter to take
+// them from. Normalizing paths that are already normal changes nothing.
+func (c *Config) NormalizePaths() error {
+	dc := c.DatacenterPath
+	if dc == "" {
+		dc = c.DefaultDatacenter
+	}
+	setDatacenter := c.DatacenterPath == "" && dc != ""
+
+	base := dc
+	if isMoRefPath(base) {
+		base = c.DefaultDatacenter
+	}
+	if isMoRefPath(base) {
+		base = ""
+	}
+	if base != "" {
+		base = absolutePath(base)
+	}
+
+	paths := c.relativePaths()
+
+	var relative []string
+	for _, p := range paths {
+		if base == "" && p.relative() {
+			relative = append(relative, *p.path)
+		}
+	}
+	if len(relative) > 0 {
+		return errors.Errorf("No datacenter to take relative paths from: %s", strings.Join(relative, ", "))
+	}
+
+	if setDatacenter {
+		c.DatacenterPath = dc
+	}
+	if !isMoRefPath(c.DatacenterPath) {
+		setPath(&c.DatacenterPath, absolutePath(c.DatacenterPath))
+	}
+
+	for _, p := range paths {
+		switch {
+		case *p.path == "" || isMoRefPath(*p.path):
+		case strings.HasPrefix(*p.path, "/"):
+			setPath(p.path, absolutePath(*p.path))
+		default:
+			setPath(p.path, path.Join(base, p.folder, *p.path))
+		}
+	}
+	return nil
+}
+
+// folderPath is a Config path along with the datacenter folder it's relative to
+type folderPath struct {
+	folder string
+	path   *string
+}
+
+// relative returns whether the path is to be made absolute
+func (p folderPath) relative() bool {
+	return *p.path != "" && !strings.HasPrefix(*p.path, "/") && !isMoRefPath(*p.path)
+}
+
+// relativePaths returns the Config paths resolved from within a datacenter
+func (c *Config) relativePaths() []folderPath {
+	paths := []folderPath{
+		{"host", &c.ClusterPath},
+		{"host", &c.HostPath},
+		{"host", &c.PoolPath},
+		{"vm", &c.FolderPath},
+		{"vm", &c.VirtualAppPath},
+		{"datastore", &c.DatastorePath},
+		{"datastore", &c.StoragePodPath},
+		{"network", &c.NetworkPath},
+		{"network", &c.DVSPath},
+	}
+	for i := range c.DatastorePaths {
+		paths = append(paths, folderPath{"datastore", &c.DatastorePaths[i]})
+	}
+	for i := range c.NetworkPaths {
+		paths = append(paths, folderPath{"network", &c.NetworkPaths[i]})
+	}
+	return paths
+}
+
+// scopedPaths returns whether any of the paths resolved within the datacenter
+// are set, other than managed object references, which need no datacenter
+func (c *Config) scopedPaths() bool {
+	for _, p := range c.relativePaths() {
+		if *p.path != "" && !isMoRefPath(*p.path) {
+			return true
+		}
+	}
+	return false
+}
+
+// absolutePath returns p, taken from the root folder if relative, without
+// repeated or trailing separators. An empty path is left empty.
+func absolutePath(p string) string {
+	if p == "" {
+		return p
+	}
+	return path.Clean("/" + p)
+}
+
+// setPath sets *p to normal only if it differs, so that normalizing a Config
+// that's already normal doesn't write to it
+func setPath(p *string, normal string) {
+	if *p != normal {
+		*p = normal
+	}
+}
+
+// isMoRefPath returns whether p is a managed object reference of a known type
+// rather than an inventory path
+func isMoRefPath(p string) bool {
+	i := strings.Index(p, ":")
+	if i <= 0 {
+		return false
+	}
+	_, ok := parseMoRef(p, p[:i])
+	return ok && referenceTypes[p[:i]]
+}
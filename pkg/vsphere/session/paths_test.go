@@ -0,0 +1,86 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizePaths(t *testing.T) {
+	c := &Config{
+		DefaultDatacenter: "dc1",
+		ClusterPath:       "cluster1",
+		HostPath:          "/dc1/host/cluster1/host1/",
+		PoolPath:          "cluster1//Resources",
+		FolderPath:        "vms",
+		DatastorePaths:    []string{"ds1", "Datastore:datastore-42"},
+		NetworkPath:       "VM Network",
+		DVSPath:           "",
+	}
+
+	require.NoError(t, c.NormalizePaths())
+	assert.Equal(t, "/dc1", c.DatacenterPath)
+	assert.Equal(t, "/dc1/host/cluster1", c.ClusterPath)
+	assert.Equal(t, "/dc1/host/cluster1/host1", c.HostPath)
+	assert.Equal(t, "/dc1/host/cluster1/Resources", c.PoolPath)
+	assert.Equal(t, "/dc1/vm/vms", c.FolderPath)
+	assert.Equal(t, []string{"/dc1/datastore/ds1", "Datastore:datastore-42"}, c.DatastorePaths)
+	assert.Equal(t, "/dc1/network/VM Network", c.NetworkPath)
+	assert.Equal(t, "", c.DVSPath)
+
+	// already normal, so nothing changes
+	normal := *c
+	require.NoError(t, c.NormalizePaths())
+	assert.Equal(t, normal, *c)
+
+	// DatacenterPath is preferred over the default, even in a folder
+	c = &Config{DefaultDatacenter: "dc1", DatacenterPath: "east/dc2", DatastorePath: "ds1"}
+	require.NoError(t, c.NormalizePaths())
+	assert.Equal(t, "/east/dc2", c.DatacenterPath)
+	assert.Equal(t, "/east/dc2/datastore/ds1", c.DatastorePath)
+
+	// but not when it's a reference, as it has no name
+	c = &Config{DefaultDatacenter: "/dc1", DatacenterPath: "Datacenter:datacenter-2", DatastorePath: "ds1"}
+	require.NoError(t, c.NormalizePaths())
+	assert.Equal(t, "Datacenter:datacenter-2", c.DatacenterPath)
+	assert.Equal(t, "/dc1/datastore/ds1", c.DatastorePath)
+
+	// without a datacenter only absolute paths can be normalized
+	c = &Config{HostPath: "host1", PoolPath: "/dc1/host/cluster1/Resources/"}
+	err := c.NormalizePaths()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "host1")
+		assert.NotContains(t, err.Error(), "Resources")
+	}
+	assert.Equal(t, "host1", c.HostPath)
+	assert.Equal(t, "/dc1/host/cluster1/Resources/", c.PoolPath, "nothing should change on failure")
+
+	c.HostPath = ""
+	require.NoError(t, c.NormalizePaths())
+	assert.Equal(t, "/dc1/host/cluster1/Resources", c.PoolPath)
+	assert.Equal(t, "", c.DatacenterPath)
+}
+
+func TestScopedPaths(t *testing.T) {
+	assert.False(t, (&Config{}).scopedPaths())
+	assert.False(t, (&Config{DatacenterPath: "/dc1"}).scopedPaths(), "the datacenter isn't scoped by itself")
+
+	assert.True(t, (&Config{DatastorePath: "datastore1"}).scopedPaths())
+	assert.True(t, (&Config{NetworkPaths: []string{"VM Network"}}).scopedPaths())
+	assert.False(t, (&Config{DatastorePath: "Datastore:datastore-42"}).scopedPaths())
+}
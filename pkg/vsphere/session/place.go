@@ -0,0 +1,103 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// PlaceVM relocates vm into the cached Pool and VMFolder, and onto the cached
+// Host and Datastore, waiting for the relocation to complete. Targets that
+// aren't cached are left as they are, and nothing is done if none are. Servers
+// before API 6.0 cannot relocate into a folder, so there vm is moved into the
+// VMFolder by a separate task.
+func (s *Session) PlaceVM(ctx context.Context, vm *object.VirtualMachine) error {
+	client := s.client()
+	if client == nil {
+		return ErrSessionExpired
+	}
+
+	spec, folder, relocate := s.placement(s.AtLeast(6, 0))
+
+	if relocate {
+		t, err := vm.Relocate(ctx, spec, types.VirtualMachineMovePriorityDefaultPriority)
+		if err != nil {
+			return err
+		}
+
+		if _, err = s.WaitForTask(ctx, t); err != nil {
+			return err
+		}
+	}
+
+	if folder == nil {
+		return nil
+	}
+
+	req := types.MoveIntoFolder_Task{
+		This: folder.Reference(),
+		List: []types.ManagedObjectReference{vm.Reference()},
+	}
+
+	res, err := methods.MoveIntoFolder_Task(ctx, client, &req)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.WaitForTask(ctx, object.NewTask(client.Client, res.Returnval))
+	return err
+}
+
+// placement returns the RelocateSpec targeting the cached resources and
+// whether there's anything to relocate, along with the VMFolder should it have
+// to be moved into separately as the spec cannot name a folder
+func (s *Session) placement(specFolder bool) (spec types.VirtualMachineRelocateSpec, folder *object.Folder, relocate bool) {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	if s.Pool != nil {
+		ref := s.Pool.Reference()
+		spec.Pool = &ref
+		relocate = true
+	}
+
+	if s.Host != nil {
+		ref := s.Host.Reference()
+		spec.Host = &ref
+		relocate = true
+	}
+
+	if s.Datastore != nil {
+		ref := s.Datastore.Reference()
+		spec.Datastore = &ref
+		relocate = true
+	}
+
+	if s.VMFolder != nil {
+		if !specFolder {
+			return spec, s.VMFolder, relocate
+		}
+
+		ref := s.VMFolder.Reference()
+		spec.Folder = &ref
+		relocate = true
+	}
+
+	return spec, nil, relocate
+}
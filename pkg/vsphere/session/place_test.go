@@ -0,0 +1,70 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestPlacement(t *testing.T) {
+	s := NewSession(&Config{})
+
+	// nothing cached, nothing to do
+	_, folder, relocate := s.placement(true)
+	assert.False(t, relocate)
+	assert.Nil(t, folder)
+
+	pool := types.ManagedObjectReference{Type: "ResourcePool", Value: "resgroup-1"}
+	vmFolder := types.ManagedObjectReference{Type: "Folder", Value: "group-v1"}
+	host := types.ManagedObjectReference{Type: "HostSystem", Value: "host-1"}
+
+	s.Pool = object.NewResourcePool(nil, pool)
+	s.VMFolder = object.NewFolder(nil, vmFolder)
+
+	spec, folder, relocate := s.placement(true)
+	assert.True(t, relocate)
+	assert.Nil(t, folder)
+	assert.Equal(t, &pool, spec.Pool)
+	assert.Equal(t, &vmFolder, spec.Folder)
+	assert.Nil(t, spec.Host, "Only cached targets should be set")
+	assert.Nil(t, spec.Datastore, "Only cached targets should be set")
+
+	s.Host = object.NewHostSystem(nil, host)
+
+	// without a folder in the spec it's moved into separately
+	spec, folder, relocate = s.placement(false)
+	assert.True(t, relocate)
+	assert.Equal(t, s.VMFolder, folder)
+	assert.Nil(t, spec.Folder)
+	assert.Equal(t, &host, spec.Host)
+
+	// even if there's nothing else to relocate
+	s.Pool = nil
+	s.Host = nil
+	_, folder, relocate = s.placement(false)
+	assert.False(t, relocate)
+	assert.Equal(t, s.VMFolder, folder)
+}
+
+func TestPlaceVMExpired(t *testing.T) {
+	vm := object.NewVirtualMachine(nil, types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-1"})
+	assert.Equal(t, ErrSessionExpired, NewSession(&Config{}).PlaceVM(context.Background(), vm))
+}
@@ -0,0 +1,238 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"path"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// ChildResourcePools returns the immediate child pools, including vApps, of
+// the cached Pool
+func (s *Session) ChildResourcePools(ctx context.Context) ([]*object.ResourcePool, error) {
+	pool := s.GetPool()
+	if pool == nil {
+		return nil, errors.New("No resource pool is cached in this session")
+	}
+
+	return s.childPools(ctx, pool)
+}
+
+// DescendantResourcePools returns all pools nested beneath the cached Pool,
+// each listed after its parent
+func (s *Session) DescendantResourcePools(ctx context.Context) ([]*object.ResourcePool, error) {
+	pool := s.GetPool()
+	if pool == nil {
+		return nil, errors.New("No resource pool is cached in this session")
+	}
+
+	var all []*object.ResourcePool
+	for queue := []*object.ResourcePool{pool}; len(queue) > 0; queue = queue[1:] {
+		children, err := s.childPools(ctx, queue[0])
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, children...)
+		queue = append(queue, children...)
+	}
+	return all, nil
+}
+
+// ResourcePoolOwner returns the compute resource, cluster or standalone host,
+// that owns the cached Pool. The cached Cluster is returned if it's the owner,
+// otherwise a new object without an inventory path.
+func (s *Session) ResourcePoolOwner(ctx context.Context) (*object.ComputeResource, error) {
+	pool := s.GetPool()
+	if pool == nil {
+		return nil, errors.New("No resource pool is cached in this session")
+	}
+
+	client := s.client()
+	if client == nil {
+		return nil, ErrSessionExpired
+	}
+
+	var mp mo.ResourcePool
+	err := s.bounded(ctx, "resource pool owner lookup", func(ctx context.Context) error {
+		return s.Properties(ctx, pool.Reference(), []string{"owner"}, &mp)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cluster := s.GetCluster(); cluster != nil && cluster.Reference() == mp.Owner {
+		return cluster, nil
+	}
+	return object.NewComputeResource(client.Client, mp.Owner), nil
+}
+
+// ResourcePoolByPath resolves the pool at p, which is relative to the cached
+// Datacenter unless absolute
+func (s *Session) ResourcePoolByPath(ctx context.Context, p string) (*object.ResourcePool, error) {
+	f := s.scopedFinder()
+	if f == nil {
+		return nil, ErrSessionExpired
+	}
+
+	var pool *object.ResourcePool
+	err := s.bounded(ctx, "resource pool lookup", func(ctx context.Context) (err error) {
+		pool, err = f.ResourcePool(ctx, p)
+		return
+	})
+	return pool, err
+}
+
+// CreateResourcePool creates a pool named name beneath the cached Pool,
+// returning it. Allocations spec leaves nil default to those of a new pool
+// in the vSphere client: normal shares, no reservation, expandable and
+// unlimited. A DuplicateName fault is returned if the pool already exists.
+func (s *Session) CreateResourcePool(ctx context.Context, name string, spec types.ResourceConfigSpec) (*object.ResourcePool, error) {
+	pool := s.GetPool()
+	if pool == nil {
+		return nil, errors.New("No resource pool is cached in this session")
+	}
+
+	if spec.CpuAllocation == nil {
+		spec.CpuAllocation = defaultAllocation()
+	}
+	if spec.MemoryAllocation == nil {
+		spec.MemoryAllocation = defaultAllocation()
+	}
+
+	var child *object.ResourcePool
+	err := s.bounded(ctx, "resource pool creation", func(ctx context.Context) (err error) {
+		child, err = pool.Create(ctx, name, spec)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	child.InventoryPath = childPath(pool, name)
+	return child, nil
+}
+
+// EnsureResourcePool creates the pool as CreateResourcePool does, but returns
+// the existing child of the cached Pool named name should there be one, in
+// which case spec isn't applied to it
+func (s *Session) EnsureResourcePool(ctx context.Context, name string, spec types.ResourceConfigSpec) (*object.ResourcePool, error) {
+	child, err := s.CreateResourcePool(ctx, name, spec)
+	if !isDuplicateName(err) {
+		return child, err
+	}
+
+	pool := s.GetPool()
+	if pool == nil {
+		return nil, errors.New("No resource pool is cached in this session")
+	}
+
+	// matched by name, as the children have no paths if the pool hasn't either
+	children, err := s.childPoolNames(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, child := range children {
+		if child.Name == name {
+			existing := object.NewResourcePool(pool.Client(), child.Reference())
+			existing.InventoryPath = childPath(pool, name)
+			return existing, nil
+		}
+	}
+
+	return nil, errors.Errorf("Unable to find the existing resource pool %s", name)
+}
+
+// defaultAllocation returns the allocation of a new pool in the vSphere client
+func defaultAllocation() *types.ResourceAllocationInfo {
+	expandable := true
+
+	return &types.ResourceAllocationInfo{
+		ExpandableReservation: &expandable,
+		Limit:                 -1,
+		Shares:                &types.SharesInfo{Level: types.SharesLevelNormal},
+	}
+}
+
+// childPath returns the inventory path of parent's child named name, or none
+// if parent has no path, such as one made from a reference, as the bare name
+// would be taken as relative by the finder
+func childPath(parent *object.ResourcePool, name string) string {
+	if parent.InventoryPath == "" {
+		return ""
+	}
+	return path.Join(parent.InventoryPath, name)
+}
+
+// childPools returns the immediate children of parent, with their inventory
+// paths set if parent has one
+func (s *Session) childPools(ctx context.Context, parent *object.ResourcePool) ([]*object.ResourcePool, error) {
+	children, err := s.childPoolNames(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	pools := []*object.ResourcePool{}
+	for _, child := range children {
+		pool := object.NewResourcePool(parent.Client(), child.Reference())
+		pool.InventoryPath = childPath(parent, child.Name)
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// childPoolNames returns the immediate children of parent with their names, in
+// a round trip for the parent and one per type of child
+func (s *Session) childPoolNames(ctx context.Context, parent *object.ResourcePool) ([]mo.ResourcePool, error) {
+	var mp mo.ResourcePool
+	if err := s.Properties(ctx, parent.Reference(), []string{"resourcePool"}, &mp); err != nil {
+		return nil, err
+	}
+
+	if len(mp.ResourcePool) == 0 {
+		return nil, nil
+	}
+
+	// the collector retrieves a single type at a time, and vApps may be mixed in
+	var kinds []string
+	byKind := make(map[string][]types.ManagedObjectReference)
+	for _, ref := range mp.ResourcePool {
+		if _, ok := byKind[ref.Type]; !ok {
+			kinds = append(kinds, ref.Type)
+		}
+		byKind[ref.Type] = append(byKind[ref.Type], ref)
+	}
+
+	pc := s.PropertyCollector()
+	if pc == nil {
+		return nil, ErrSessionExpired
+	}
+
+	// each Retrieve appends to children
+	var children []mo.ResourcePool
+	for _, kind := range kinds {
+		if err := pc.Retrieve(ctx, byKind[kind], []string{"name"}, &children); err != nil {
+			return nil, err
+		}
+	}
+	return children, nil
+}
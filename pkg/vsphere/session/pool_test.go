@@ -0,0 +1,159 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// poolRoundTripper is a root pool with children named by their references,
+// failing with DuplicateName to create one that exists
+type poolRoundTripper struct {
+	children map[string]types.ManagedObjectReference
+	created  *types.CreateResourcePool
+}
+
+func (f *poolRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	switch res := res.(type) {
+	case *methods.CreateResourcePoolBody:
+		r := req.(*methods.CreateResourcePoolBody).Req
+		if ref, ok := f.children[r.Name]; ok {
+			fault := &soap.Fault{Code: "ServerFaultCode", String: "The name already exists."}
+			fault.Detail.Fault = types.DuplicateName{Name: r.Name, Object: ref}
+			return soap.WrapSoapFault(fault)
+		}
+
+		f.created = r
+		ref := types.ManagedObjectReference{Type: "ResourcePool", Value: fmt.Sprintf("resgroup-%d", 10+len(f.children))}
+		f.children[r.Name] = ref
+		res.Res = &types.CreateResourcePoolResponse{Returnval: ref}
+	case *methods.RetrievePropertiesBody:
+		spec := req.(*methods.RetrievePropertiesBody).Req.SpecSet[0]
+
+		var contents []types.ObjectContent
+		if spec.PropSet[0].PathSet[0] == "resourcePool" {
+			var refs []types.ManagedObjectReference
+			for _, ref := range f.children {
+				refs = append(refs, ref)
+			}
+			contents = append(contents, types.ObjectContent{
+				Obj:     spec.ObjectSet[0].Obj,
+				PropSet: []types.DynamicProperty{{Name: "resourcePool", Val: types.ArrayOfManagedObjectReference{ManagedObjectReference: refs}}},
+			})
+		} else {
+			for name, ref := range f.children {
+				contents = append(contents, types.ObjectContent{Obj: ref, PropSet: []types.DynamicProperty{{Name: "name", Val: name}}})
+			}
+		}
+		res.Res = &types.RetrievePropertiesResponse{Returnval: contents}
+	}
+	return nil
+}
+
+func poolSession() (*Session, *poolRoundTripper) {
+	rt := &poolRoundTripper{children: map[string]types.ManagedObjectReference{
+		"existing": {Type: "ResourcePool", Value: "resgroup-2"},
+	}}
+	client := &vim25.Client{RoundTripper: rt}
+
+	s := NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+	s.Pool = object.NewResourcePool(client, types.ManagedObjectReference{Type: "ResourcePool", Value: "resgroup-1"})
+	s.Pool.InventoryPath = "/dc1/host/cluster1/Resources"
+	return s, rt
+}
+
+func TestCreateResourcePool(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewSession(&Config{}).CreateResourcePool(ctx, "vch", types.ResourceConfigSpec{})
+	assert.Error(t, err, "expected a failure without a cached pool")
+
+	s, rt := poolSession()
+
+	pool, err := s.CreateResourcePool(ctx, "vch", types.ResourceConfigSpec{})
+	require.NoError(t, err)
+	assert.Equal(t, "/dc1/host/cluster1/Resources/vch", pool.InventoryPath)
+	assert.Equal(t, "resgroup-1", rt.created.This.Value)
+
+	// a zero spec gets the defaults
+	for _, a := range []types.BaseResourceAllocationInfo{rt.created.Spec.CpuAllocation, rt.created.Spec.MemoryAllocation} {
+		info := a.GetResourceAllocationInfo()
+		assert.EqualValues(t, -1, info.Limit)
+		assert.True(t, *info.ExpandableReservation)
+		assert.Equal(t, types.SharesLevelNormal, info.Shares.Level)
+	}
+
+	// and a given one is kept
+	cpu := &types.ResourceAllocationInfo{Limit: 1000, Shares: &types.SharesInfo{Level: types.SharesLevelHigh}}
+	_, err = s.CreateResourcePool(ctx, "limited", types.ResourceConfigSpec{CpuAllocation: cpu})
+	require.NoError(t, err)
+	assert.Equal(t, cpu, rt.created.Spec.CpuAllocation)
+	assert.EqualValues(t, -1, rt.created.Spec.MemoryAllocation.GetResourceAllocationInfo().Limit)
+
+	_, err = s.CreateResourcePool(ctx, "existing", types.ResourceConfigSpec{})
+	assert.True(t, isDuplicateName(err), "expected a DuplicateName fault, not %s", err)
+}
+
+func TestEnsureResourcePool(t *testing.T) {
+	ctx := context.Background()
+	s, _ := poolSession()
+
+	pool, err := s.EnsureResourcePool(ctx, "existing", types.ResourceConfigSpec{})
+	require.NoError(t, err)
+	assert.Equal(t, "resgroup-2", pool.Reference().Value)
+	assert.Equal(t, "/dc1/host/cluster1/Resources/existing", pool.InventoryPath)
+
+	pool, err = s.EnsureResourcePool(ctx, "vch", types.ResourceConfigSpec{})
+	require.NoError(t, err)
+
+	again, err := s.EnsureResourcePool(ctx, "vch", types.ResourceConfigSpec{})
+	require.NoError(t, err)
+	assert.Equal(t, pool.Reference(), again.Reference())
+}
+
+func TestCreateResourcePoolWithoutPath(t *testing.T) {
+	ctx := context.Background()
+	s, _ := poolSession()
+
+	// a pool made from a reference has no path for the children to extend
+	s.Pool.InventoryPath = ""
+
+	pool, err := s.CreateResourcePool(ctx, "vch", types.ResourceConfigSpec{})
+	require.NoError(t, err)
+	assert.Empty(t, pool.InventoryPath)
+
+	pool, err = s.EnsureResourcePool(ctx, "existing", types.ResourceConfigSpec{})
+	require.NoError(t, err)
+	assert.Equal(t, "resgroup-2", pool.Reference().Value)
+	assert.Empty(t, pool.InventoryPath)
+
+	children, err := s.ChildResourcePools(ctx)
+	require.NoError(t, err)
+	for _, child := range children {
+		assert.Empty(t, child.InventoryPath)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+)
+
+// PowerOn powers on each of vms, waiting for the tasks to complete, with at
+// most concurrency of them in flight at once, or all of them if concurrency
+// isn't positive. Each of vms is mapped to the error powering it on, nil if it
+// succeeded. Once ctx is done those still in flight fail along with it, and the
+// rest aren't attempted. A VM that's already on fails with InvalidPowerState.
+func (s *Session) PowerOn(ctx context.Context, vms []*object.VirtualMachine, concurrency int) map[*object.VirtualMachine]error {
+	return s.powerAll(ctx, vms, concurrency, func(ctx context.Context, vm *object.VirtualMachine) (*object.Task, error) {
+		return vm.PowerOn(ctx)
+	})
+}
+
+// PowerOff powers off each of vms as PowerOn powers them on. The guests aren't
+// shut down first.
+func (s *Session) PowerOff(ctx context.Context, vms []*object.VirtualMachine, concurrency int) map[*object.VirtualMachine]error {
+	return s.powerAll(ctx, vms, concurrency, func(ctx context.Context, vm *object.VirtualMachine) (*object.Task, error) {
+		return vm.PowerOff(ctx)
+	})
+}
+
+// powerAll starts the task op returns for each of vms and waits for it, in the
+// manner of CreateAll
+func (s *Session) powerAll(ctx context.Context, vms []*object.VirtualMachine, concurrency int, op func(context.Context, *object.VirtualMachine) (*object.Task, error)) map[*object.VirtualMachine]error {
+	errs := make([]error, len(vms))
+
+	if concurrency <= 0 || concurrency > len(vms) {
+		concurrency = len(vms)
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range work {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+
+				t, err := op(ctx, vms[i])
+				if err == nil {
+					_, err = s.WaitForTask(ctx, t)
+				}
+				errs[i] = err
+			}
+		}()
+	}
+
+	for i := range vms {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	results := make(map[*object.VirtualMachine]error, len(vms))
+	for i, vm := range vms {
+		results[vm] = errs[i]
+	}
+	return results
+}
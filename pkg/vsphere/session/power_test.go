@@ -0,0 +1,152 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// powerRoundTripper starts a power task for each VM and completes it after a
+// moment, failing it for the VMs in fail, while tracking the tasks in flight
+type powerRoundTripper struct {
+	mu         sync.Mutex
+	fail       map[string]bool
+	collectors int
+	tasks      map[string]string // by collector
+	powered    []string
+	inFlight   int
+	maxFlight  int
+}
+
+func (f *powerRoundTripper) start(vm types.ManagedObjectReference) types.ManagedObjectReference {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.powered = append(f.powered, vm.Value)
+	f.inFlight++
+	if f.inFlight > f.maxFlight {
+		f.maxFlight = f.inFlight
+	}
+	return types.ManagedObjectReference{Type: "Task", Value: "task-" + vm.Value}
+}
+
+func (f *powerRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	switch res := res.(type) {
+	case *methods.PowerOnVM_TaskBody:
+		res.Res = &types.PowerOnVM_TaskResponse{Returnval: f.start(req.(*methods.PowerOnVM_TaskBody).Req.This)}
+	case *methods.PowerOffVM_TaskBody:
+		res.Res = &types.PowerOffVM_TaskResponse{Returnval: f.start(req.(*methods.PowerOffVM_TaskBody).Req.This)}
+	case *methods.CreatePropertyCollectorBody:
+		f.mu.Lock()
+		f.collectors++
+		pc := types.ManagedObjectReference{Type: "PropertyCollector", Value: fmt.Sprintf("session[%d]", f.collectors)}
+		f.mu.Unlock()
+
+		res.Res = &types.CreatePropertyCollectorResponse{Returnval: pc}
+	case *methods.CreateFilterBody:
+		r := req.(*methods.CreateFilterBody).Req
+
+		f.mu.Lock()
+		f.tasks[r.This.Value] = r.Spec.ObjectSet[0].Obj.Value
+		f.mu.Unlock()
+
+		res.Res = &types.CreateFilterResponse{}
+	case *methods.DestroyPropertyCollectorBody:
+		res.Res = &types.DestroyPropertyCollectorResponse{}
+	case *methods.WaitForUpdatesExBody:
+		time.Sleep(10 * time.Millisecond)
+
+		f.mu.Lock()
+		task := f.tasks[req.(*methods.WaitForUpdatesExBody).Req.This.Value]
+		info := types.TaskInfo{State: types.TaskInfoStateSuccess}
+		if f.fail[task] {
+			info = types.TaskInfo{State: types.TaskInfoStateError, Error: &types.LocalizedMethodFault{Fault: &types.InvalidPowerState{}, LocalizedMessage: "The attempted operation cannot be performed in the current state."}}
+		}
+		f.inFlight--
+		f.mu.Unlock()
+
+		change := types.PropertyChange{Name: "info", Op: types.PropertyChangeOpAssign, Val: info}
+		res.Res = &types.WaitForUpdatesExResponse{
+			Returnval: &types.UpdateSet{
+				FilterSet: []types.PropertyFilterUpdate{
+					{ObjectSet: []types.ObjectUpdate{{ChangeSet: []types.PropertyChange{change}}}},
+				},
+			},
+		}
+	}
+	return nil
+}
+
+func powerSession(count int, fail ...string) (*Session, *powerRoundTripper, []*object.VirtualMachine) {
+	rt := &powerRoundTripper{fail: make(map[string]bool), tasks: make(map[string]string)}
+	for _, vm := range fail {
+		rt.fail["task-"+vm] = true
+	}
+	client := &vim25.Client{RoundTripper: rt}
+
+	var vms []*object.VirtualMachine
+	for i := 0; i < count; i++ {
+		vms = append(vms, object.NewVirtualMachine(client, types.ManagedObjectReference{Type: "VirtualMachine", Value: fmt.Sprintf("vm-%d", i)}))
+	}
+	return NewSessionFromClient(&govmomi.Client{Client: client}, nil), rt, vms
+}
+
+func TestPowerOn(t *testing.T) {
+	s, rt, vms := powerSession(10, "vm-3")
+
+	results := s.PowerOn(context.Background(), vms, 3)
+	assert.Len(t, results, len(vms))
+	for _, vm := range vms {
+		if vm.Reference().Value == "vm-3" {
+			assert.Error(t, results[vm], "expected the failure of %s", vm.Reference())
+			continue
+		}
+		assert.NoError(t, results[vm], "expected %s to power on", vm.Reference())
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	assert.Len(t, rt.powered, len(vms))
+	assert.True(t, rt.maxFlight <= 3, "expected at most 3 tasks in flight, not %d", rt.maxFlight)
+}
+
+func TestPowerOffCancelled(t *testing.T) {
+	s, rt, vms := powerSession(5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := s.PowerOff(ctx, vms, 0)
+	for _, vm := range vms {
+		assert.Equal(t, context.Canceled, results[vm])
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	assert.Empty(t, rt.powered, "expected nothing to be attempted once cancelled")
+}
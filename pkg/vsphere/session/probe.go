@@ -0,0 +1,89 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// ProbeResult describes a server found by Probe
+type ProbeResult struct {
+	// Product name and version, e.g. "VMware vCenter Server" and "6.0.0"
+	Name       string
+	FullName   string
+	Version    string
+	Build      string
+	APIType    string
+	APIVersion string
+
+	// Certificates presented by the server, leaf first, or none if not https
+	Certificates []*x509.Certificate
+}
+
+// Probe checks that the service Connect would try first is reachable and has
+// an acceptable certificate, according to Insecure, Thumbprint and the CA
+// settings, without logging in. The server's AboutInfo is retrieved with the
+// ServiceContent, which needs no authentication, and the connection is then
+// closed. The session itself is left as is.
+func (s *Session) Probe(ctx context.Context) (*ProbeResult, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	service := s.candidates()[0]
+	u, err := parseService(service)
+	if err != nil {
+		return nil, withKind(ErrURLParse, errors.Errorf("SDK URL (%s) could not be parsed: %s", redactService(service), err))
+	}
+	u.User = nil
+
+	capture := &certCapture{}
+	client, err := s.dial(ctx, u, nil, capture)
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing to log out of, only the connection to close
+	closeIdle(client.Client.Client.Transport)
+
+	about := client.ServiceContent.About
+	return &ProbeResult{
+		Name:         about.Name,
+		FullName:     about.FullName,
+		Version:      about.Version,
+		Build:        about.Build,
+		APIType:      about.ApiType,
+		APIVersion:   about.ApiVersion,
+		Certificates: capture.chain(),
+	}, nil
+}
+
+// closeIdle closes the idle connections of rt, looking through any soapDebug and
+// userAgent wrappers
+func closeIdle(rt http.RoundTripper) {
+	rt = withoutDebug(rt)
+	if u, ok := rt.(*userAgent); ok {
+		rt = u.RoundTripper
+	}
+
+	if t, ok := rt.(*http.Transport); ok {
+		t.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+const (
+	serviceContentResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><RetrieveServiceContentResponse xmlns="urn:vim25"><returnval>
+<rootFolder type="Folder">group-d1</rootFolder>
+<propertyCollector type="PropertyCollector">propertyCollector</propertyCollector>
+<about><name>VMware vCenter Server</name><fullName>VMware vCenter Server 6.0.0 build-3339083</fullName><vendor>VMware, Inc.</vendor><version>6.0.0</version><build>3339083</build><osType>linux-x64</osType><apiType>VirtualCenter</apiType><apiVersion>6.0</apiVersion></about>
+<sessionManager type="SessionManager">SessionManager</sessionManager>
+</returnval></RetrieveServiceContentResponse></soapenv:Body>
+</soapenv:Envelope>`
+
+	loginResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><LoginResponse xmlns="urn:vim25"><returnval><key>52</key><userName>root</userName><fullName>root</fullName></returnval></LoginResponse></soapenv:Body>
+</soapenv:Envelope>`
+
+	logoutResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><LogoutResponse xmlns="urn:vim25"></LogoutResponse></soapenv:Body>
+</soapenv:Envelope>`
+
+	notImplementedFault = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><soapenv:Fault><faultcode>ServerFaultCode</faultcode><faultstring>Not implemented</faultstring><detail><NotImplementedFault xmlns="urn:vim25" xsi:type="NotImplemented" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"></NotImplementedFault></detail></soapenv:Fault></soapenv:Body>
+</soapenv:Envelope>`
+)
+
+// serviceContentServer answers RetrieveServiceContent and Login, failing
+// anything else with notImplementedFault
+func serviceContentServer() *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		w.Header().Set("Content-Type", "text/xml")
+		switch {
+		case strings.Contains(string(body), "<RetrieveServiceContent "):
+			w.Write([]byte(serviceContentResponse))
+		case strings.Contains(string(body), "<Login "):
+			w.Write([]byte(loginResponse))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(notImplementedFault))
+		}
+	}))
+}
+
+func TestProbe(t *testing.T) {
+	server := serviceContentServer()
+	defer server.Close()
+
+	ctx := context.Background()
+	leaf := server.TLS.Certificates[0].Certificate[0]
+
+	s := NewSession(&Config{Service: server.URL + "/sdk", Insecure: true})
+	result, err := s.Probe(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "VMware vCenter Server", result.Name)
+	assert.Equal(t, "6.0.0", result.Version)
+	assert.Equal(t, "3339083", result.Build)
+	assert.Equal(t, "VirtualCenter", result.APIType)
+	assert.Equal(t, "6.0", result.APIVersion)
+	if assert.Len(t, result.Certificates, 1) {
+		assert.Equal(t, leaf, result.Certificates[0].Raw)
+	}
+
+	// not logged in, nor connected
+	assert.Nil(t, s.Client)
+
+	// the thumbprint applies in place of insecure
+	s = NewSession(&Config{Service: server.URL + "/sdk", Thumbprint: Thumbprint(result.Certificates[0])})
+	_, err = s.Probe(ctx)
+	assert.NoError(t, err)
+
+	s = NewSession(&Config{Service: server.URL + "/sdk", Thumbprint: "00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF:00:11:22:33"})
+	_, err = s.Probe(ctx)
+	assert.Error(t, err)
+
+	// the test server's certificate isn't trusted
+	s = NewSession(&Config{Service: server.URL + "/sdk"})
+	_, err = s.Probe(ctx)
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// sdkTunnel is the host soap.Client.SetCertificate directs certificate
+// authenticated requests to, via the VC's own reverse proxy
+const sdkTunnel = "sdkTunnel:8089"
+
+// parseProxy returns the URL in Config.Proxy, which must be http or https
+func (c *Config) parseProxy() (*url.URL, error) {
+	u, err := url.Parse(c.Proxy)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.Errorf("Proxy must be an http or https URL")
+	}
+	return u, nil
+}
+
+// noProxy returns whether requests to host should bypass the proxy according
+// to the NO_PROXY environment variable, a comma separated list of host names,
+// domain suffixes and IP addresses, or "*" to bypass the proxy entirely.
+func noProxy(host string) bool {
+	list := os.Getenv("NO_PROXY")
+	if list == "" {
+		list = os.Getenv("no_proxy")
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	// an IPv6 literal without a port is still bracketed
+	host = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		entry = strings.TrimSuffix(strings.TrimPrefix(entry, "["), "]")
+
+		switch {
+		case entry == "":
+			continue
+		case entry == "*", entry == host:
+			return true
+		case strings.HasSuffix(host, "."+strings.TrimPrefix(entry, ".")):
+			return true
+		}
+	}
+	return false
+}
+
+// configureProxy directs the client's requests through Config.Proxy, unless
+// bypassed by NO_PROXY. When Proxy is empty the soap client's default of
+// honoring the proxy environment variables is left in place. Certificate
+// authenticated requests still go via the sdk tunnel as they must.
+func (s *Session) configureProxy(sc *soap.Client) error {
+	if s.Proxy == "" {
+		return nil
+	}
+
+	proxy, err := s.parseProxy()
+	if err != nil {
+		return err
+	}
+
+	t, ok := sc.Transport.(*http.Transport)
+	if !ok {
+		return nil
+	}
+
+	tunnel := t.Proxy
+	t.Proxy = func(r *http.Request) (*url.URL, error) {
+		if r.URL.Host == sdkTunnel && tunnel != nil {
+			return tunnel(r)
+		}
+
+		if noProxy(r.URL.Host) {
+			return nil, nil
+		}
+		return proxy, nil
+	}
+
+	return nil
+}
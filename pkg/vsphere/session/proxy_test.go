@@ -0,0 +1,71 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestNoProxy(t *testing.T) {
+	defer os.Setenv("NO_PROXY", os.Getenv("NO_PROXY"))
+
+	os.Setenv("NO_PROXY", "localhost, .internal.example.com,10.0.0.1:443")
+
+	assert.True(t, noProxy("localhost:443"))
+	assert.True(t, noProxy("vc.internal.example.com"))
+	assert.True(t, noProxy("10.0.0.1"))
+	assert.False(t, noProxy("vc.example.com"))
+	assert.False(t, noProxy("internal.example.com.evil.com"))
+
+	os.Setenv("NO_PROXY", "fd00::1")
+	assert.True(t, noProxy("[fd00::1]"))
+	assert.True(t, noProxy("[fd00::1]:443"))
+	assert.False(t, noProxy("[fd00::2]"))
+
+	os.Setenv("NO_PROXY", "*")
+	assert.True(t, noProxy("vc.example.com"))
+}
+
+func TestConnectProxy(t *testing.T) {
+	defer os.Setenv("NO_PROXY", os.Getenv("NO_PROXY"))
+	os.Setenv("NO_PROXY", "")
+
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a proxy receives the absolute URL of the target
+		proxied = append(proxied, r.URL.String())
+		http.Error(w, "proxy says no", http.StatusBadGateway)
+	}))
+	defer proxy.Close()
+
+	ctx := context.Background()
+
+	_, err := NewSession(&Config{Service: "http://vc.example.invalid/sdk", Proxy: proxy.URL}).Connect(ctx)
+	assert.Error(t, err)
+	if assert.Len(t, proxied, 1) {
+		assert.Equal(t, "http://vc.example.invalid/sdk", proxied[0])
+	}
+
+	_, err = NewSession(&Config{Service: "https://vc.example.com/sdk", Proxy: "ftp://proxy"}).Connect(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Proxy")
+	}
+}
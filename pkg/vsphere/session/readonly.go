@@ -0,0 +1,119 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"reflect"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+// MutatingMethods are the SOAP methods rejected by ReadOnly sessions. It may be
+// extended, but only before connecting any session as it isn't guarded.
+var MutatingMethods = map[string]bool{
+	// virtual machines
+	"CreateVM_Task":         true,
+	"CloneVM_Task":          true,
+	"RegisterVM_Task":       true,
+	"UnregisterVM":          true,
+	"ReconfigVM_Task":       true,
+	"RelocateVM_Task":       true,
+	"MigrateVM_Task":        true,
+	"PowerOnVM_Task":        true,
+	"PowerOffVM_Task":       true,
+	"ResetVM_Task":          true,
+	"SuspendVM_Task":        true,
+	"ShutdownGuest":         true,
+	"RebootGuest":           true,
+	"CreateSnapshot_Task":   true,
+	"RemoveSnapshot_Task":   true,
+	"RevertToSnapshot_Task": true,
+
+	// any managed entity
+	"Destroy_Task":   true,
+	"Rename_Task":    true,
+	"SetCustomValue": true,
+
+	// inventory
+	"CreateFolder":         true,
+	"MoveIntoFolder_Task":  true,
+	"CreateResourcePool":   true,
+	"MoveIntoResourcePool": true,
+	"UpdateConfig":         true,
+
+	// custom fields
+	"AddCustomFieldDef":    true,
+	"RemoveCustomFieldDef": true,
+	"RenameCustomFieldDef": true,
+	"SetField":             true,
+
+	// networking
+	"AddDVPortgroup_Task": true,
+
+	// advanced settings
+	"UpdateOptions": true,
+
+	// files and disks
+	"MakeDirectory":            true,
+	"CopyDatastoreFile_Task":   true,
+	"MoveDatastoreFile_Task":   true,
+	"DeleteDatastoreFile_Task": true,
+	"CreateVirtualDisk_Task":   true,
+	"CopyVirtualDisk_Task":     true,
+	"MoveVirtualDisk_Task":     true,
+	"DeleteVirtualDisk_Task":   true,
+	"ExtendVirtualDisk_Task":   true,
+	"DeleteDirectory":          true,
+	"CreateDirectory":          true,
+
+	// first class disks
+	"CreateDisk_Task":           true,
+	"DeleteVStorageObject_Task": true,
+}
+
+// readOnly rejects the MutatingMethods, passing everything else to the wrapped
+// round tripper
+type readOnly struct {
+	soap.RoundTripper
+}
+
+func (r readOnly) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	if method := soapMethod(req); MutatingMethods[method] {
+		log.Warnf("Rejected %s on a read only session", method)
+		return ErrReadOnly
+	}
+
+	return r.RoundTripper.RoundTrip(ctx, req, res)
+}
+
+// soapMethod returns the name of the SOAP method req calls, from the type of
+// the request body, such as methods.CreateVM_TaskBody, or the unexported
+// createDisk_TaskBody of a method the vendored govmomi lacks
+func soapMethod(req soap.HasFault) string {
+	t := reflect.TypeOf(req)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	name := strings.TrimSuffix(t.Name(), "Body")
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
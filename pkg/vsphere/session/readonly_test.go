@@ -0,0 +1,53 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+func TestSoapMethod(t *testing.T) {
+	assert.Equal(t, "CreateVM_Task", soapMethod(&methods.CreateVM_TaskBody{}))
+	assert.Equal(t, "RetrieveProperties", soapMethod(&methods.RetrievePropertiesBody{}))
+}
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+
+	inner := &failingRoundTripper{}
+	rt := (&Session{Config: &Config{ReadOnly: true}}).wrapRoundTripper(inner)
+
+	// mutating methods never reach the server
+	for _, req := range []soap.HasFault{&methods.CreateVM_TaskBody{}, &methods.Destroy_TaskBody{}, &methods.MakeDirectoryBody{}} {
+		assert.Equal(t, ErrReadOnly, rt.RoundTrip(ctx, req, nil))
+	}
+	assert.Equal(t, 0, inner.requests)
+
+	// and reads pass through untouched
+	err := rt.RoundTrip(ctx, &methods.RetrievePropertiesBody{}, &methods.RetrievePropertiesBody{})
+	assert.EqualError(t, err, "session expired")
+	assert.Equal(t, 1, inner.requests)
+
+	// nothing is rejected without ReadOnly
+	rt = (&Session{Config: &Config{}}).wrapRoundTripper(inner)
+	rt.RoundTrip(ctx, &methods.CreateVM_TaskBody{}, nil)
+	assert.Equal(t, 2, inner.requests)
+}
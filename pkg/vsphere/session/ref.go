@@ -0,0 +1,151 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"path"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// referenceTypes are the managed object types object.NewReference knows, as
+// it panics given any other
+var referenceTypes = map[string]bool{
+	"Folder":                         true,
+	"StoragePod":                     true,
+	"Datacenter":                     true,
+	"VirtualMachine":                 true,
+	"VirtualApp":                     true,
+	"ComputeResource":                true,
+	"ClusterComputeResource":         true,
+	"HostSystem":                     true,
+	"Network":                        true,
+	"ResourcePool":                   true,
+	"DistributedVirtualSwitch":       true,
+	"VmwareDistributedVirtualSwitch": true,
+	"DistributedVirtualPortgroup":    true,
+	"Datastore":                      true,
+}
+
+// ObjectFromRef returns the govmomi object for ref, bound to the session
+// client, or nil if the type of ref isn't known or the session isn't connected
+func (s *Session) ObjectFromRef(ref types.ManagedObjectReference) object.Reference {
+	client := s.client()
+	if client == nil || !referenceTypes[ref.Type] {
+		return nil
+	}
+
+	return object.NewReference(client.Client, ref)
+}
+
+// VirtualMachine returns the virtual machine ref refers to
+func (s *Session) VirtualMachine(ref types.ManagedObjectReference) (*object.VirtualMachine, error) {
+	o, err := s.objectFromRef(ref, "VirtualMachine")
+	if err != nil {
+		return nil, err
+	}
+	return o.(*object.VirtualMachine), nil
+}
+
+// HostSystem returns the host ref refers to
+func (s *Session) HostSystem(ref types.ManagedObjectReference) (*object.HostSystem, error) {
+	o, err := s.objectFromRef(ref, "HostSystem")
+	if err != nil {
+		return nil, err
+	}
+	return o.(*object.HostSystem), nil
+}
+
+// ResourcePool returns the resource pool ref refers to
+func (s *Session) ResourcePool(ref types.ManagedObjectReference) (*object.ResourcePool, error) {
+	o, err := s.objectFromRef(ref, "ResourcePool")
+	if err != nil {
+		return nil, err
+	}
+	return o.(*object.ResourcePool), nil
+}
+
+// objectFromRef returns the object for ref, which must be of type kind
+func (s *Session) objectFromRef(ref types.ManagedObjectReference, kind string) (object.Reference, error) {
+	if ref.Type != kind {
+		return nil, errors.Errorf("%s is not a %s", ref, kind)
+	}
+
+	o := s.ObjectFromRef(ref)
+	if o == nil {
+		return nil, ErrSessionExpired
+	}
+	return o, nil
+}
+
+// InventoryPath returns the inventory path of o, such as "/dc1/vm/vm1", from its
+// ancestry, retrieved in a single round trip. The root folder isn't named in the
+// path. An object that has been deleted is reported as no longer existing.
+func (s *Session) InventoryPath(ctx context.Context, o object.Reference) (string, error) {
+	ref := o.Reference()
+
+	p, ok, err := s.inventoryPath(ctx, ref)
+	if err == nil && !ok {
+		return "", errors.Errorf("%s:%s no longer exists", ref.Type, ref.Value)
+	}
+	return p, err
+}
+
+// inventoryPath returns the inventory path of the object ref refers to, and
+// whether it exists
+func (s *Session) inventoryPath(ctx context.Context, ref types.ManagedObjectReference) (string, bool, error) {
+	client := s.client()
+	if client == nil || client.Client == nil {
+		return "", false, ErrSessionExpired
+	}
+
+	var entities []mo.ManagedEntity
+	err := s.bounded(ctx, "inventory path lookup", func(ctx context.Context) (err error) {
+		entities, err = mo.Ancestors(ctx, client.Client, client.ServiceContent.PropertyCollector, ref)
+		return
+	})
+	if isManagedObjectNotFound(err) || (err == nil && len(entities) == 0) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	names := make([]string, 0, len(entities)-1)
+	for _, entity := range entities[1:] {
+		names = append(names, entity.Name)
+	}
+	return "/" + path.Join(names...), true, nil
+}
+
+// isManagedObjectNotFound returns whether err is a ManagedObjectNotFound fault,
+// as returned when the object referred to has been deleted
+func isManagedObjectNotFound(err error) bool {
+	if !soap.IsSoapFault(err) {
+		return false
+	}
+
+	switch soap.ToSoapFault(err).VimFault().(type) {
+	case types.ManagedObjectNotFound, *types.ManagedObjectNotFound:
+		return true
+	}
+	return false
+}
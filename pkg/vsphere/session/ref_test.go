@@ -0,0 +1,125 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/vsphere/test/env"
+)
+
+func TestObjectFromRef(t *testing.T) {
+	vm := types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-42"}
+
+	// not connected
+	s := NewSession(&Config{})
+	assert.Nil(t, s.ObjectFromRef(vm))
+	_, err := s.VirtualMachine(vm)
+	assert.Equal(t, ErrSessionExpired, err)
+
+	client := &vim25.Client{}
+	s = NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+
+	o, ok := s.ObjectFromRef(vm).(*object.VirtualMachine)
+	if assert.True(t, ok) {
+		assert.Equal(t, vm, o.Reference())
+		assert.Equal(t, client, o.Client())
+	}
+
+	// unknown types are refused rather than panicking
+	assert.Nil(t, s.ObjectFromRef(types.ManagedObjectReference{Type: "EventManager", Value: "EventManager"}))
+
+	v, err := s.VirtualMachine(vm)
+	if assert.NoError(t, err) {
+		assert.Equal(t, vm, v.Reference())
+	}
+
+	host := types.ManagedObjectReference{Type: "HostSystem", Value: "host-7"}
+	_, err = s.VirtualMachine(host)
+	assert.Error(t, err)
+
+	h, err := s.HostSystem(host)
+	if assert.NoError(t, err) {
+		assert.Equal(t, host, h.Reference())
+	}
+
+	pool := types.ManagedObjectReference{Type: "ResourcePool", Value: "resgroup-9"}
+	p, err := s.ResourcePool(pool)
+	if assert.NoError(t, err) {
+		assert.Equal(t, pool, p.Reference())
+	}
+}
+
+const managedObjectNotFoundFault = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><soapenv:Fault><faultcode>ServerFaultCode</faultcode><faultstring>The object has already been deleted or has not been completely created</faultstring><detail><ManagedObjectNotFoundFault xmlns="urn:vim25" xsi:type="ManagedObjectNotFound" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><obj type="VirtualMachine">vm-42</obj></ManagedObjectNotFoundFault></detail></soapenv:Fault></soapenv:Body>
+</soapenv:Envelope>`
+
+func TestInventoryPathDeleted(t *testing.T) {
+	ctx := context.Background()
+	vm := object.NewVirtualMachine(nil, types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-42"})
+
+	_, err := NewSession(&Config{}).InventoryPath(ctx, vm)
+	assert.Equal(t, ErrSessionExpired, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(managedObjectNotFoundFault))
+	}))
+	defer server.Close()
+
+	_, err = ticketSession(server, &Config{}).InventoryPath(ctx, vm)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "VirtualMachine:vm-42 no longer exists")
+	}
+}
+
+func TestInventoryPath(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:        env.URL(t),
+		Insecure:       true,
+		DatacenterPath: "/ha-datacenter",
+		DatastorePath:  "/ha-datacenter/datastore/*",
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	p, err := session.InventoryPath(ctx, session.Datastore)
+	if assert.NoError(t, err) {
+		assert.Equal(t, session.Datastore.InventoryPath, p)
+	}
+
+	p, err = session.InventoryPath(ctx, session.Datacenter)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/ha-datacenter", p)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+)
+
+// Resolvers replace individual lookups made by Populate. Each that is set is
+// called in place of the finder lookup for its resource, whether or not the
+// Config has a path for it, and is given a finder scoped to the datacenter if
+// one was resolved. Any error is reported by Populate as the lookup's would be.
+type Resolvers struct {
+	DatacenterResolver func(ctx context.Context, finder *find.Finder) (*object.Datacenter, error)
+	ClusterResolver    func(ctx context.Context, finder *find.Finder) (*object.ComputeResource, error)
+	HostResolver       func(ctx context.Context, finder *find.Finder) (*object.HostSystem, error)
+	PoolResolver       func(ctx context.Context, finder *find.Finder) (*object.ResourcePool, error)
+	FolderResolver     func(ctx context.Context, finder *find.Finder) (*object.Folder, error)
+
+	// The resolved datastore or network is also the only one of Datastores or
+	// Networks, DatastorePaths and NetworkPaths being ignored
+	DatastoreResolver func(ctx context.Context, finder *find.Finder) (*object.Datastore, error)
+	NetworkResolver   func(ctx context.Context, finder *find.Finder) (object.NetworkReference, error)
+}
+
+// resolvers returns the configured Resolvers, or an empty set if there are none
+func (c *Config) resolvers() *Resolvers {
+	if c.Resolvers == nil {
+		return &Resolvers{}
+	}
+	return c.Resolvers
+}
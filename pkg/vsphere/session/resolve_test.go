@@ -0,0 +1,68 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestResolvers(t *testing.T) {
+	server := serviceContentServer()
+	defer server.Close()
+
+	ctx := context.Background()
+
+	var chosen *object.Datastore
+	config := &Config{
+		Service:  "root:pass@" + strings.TrimPrefix(server.URL, "https://") + "/sdk",
+		Insecure: true,
+		// ignored in favour of the resolver
+		DatastorePaths: []string{"ds1", "ds2"},
+		Resolvers: &Resolvers{
+			DatacenterResolver: func(ctx context.Context, finder *find.Finder) (*object.Datacenter, error) {
+				return nil, errors.New("no datacenter for you")
+			},
+			DatastoreResolver: func(ctx context.Context, finder *find.Finder) (*object.Datastore, error) {
+				return chosen, nil
+			},
+		},
+	}
+
+	s, err := NewSession(config).Connect(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	chosen = object.NewDatastore(s.Vim25(), types.ManagedObjectReference{Type: "Datastore", Value: "datastore-1"})
+
+	_, err = s.Populate(ctx)
+	perr, ok := err.(*PopulateError)
+	if assert.True(t, ok, "expected a PopulateError, got %v", err) {
+		assert.Contains(t, perr.Error(), "no datacenter for you")
+		assert.NotContains(t, perr.Error(), "datastore")
+	}
+
+	assert.Equal(t, chosen, s.GetDatastore())
+	assert.Equal(t, []*object.Datastore{chosen}, s.GetDatastores())
+	assert.Nil(t, s.GetDatacenter())
+}
@@ -0,0 +1,330 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+const (
+	restPath          = "/rest"
+	restSessionPath   = "/com/vmware/cis/session"
+	restSessionHeader = "vmware-api-session-id"
+)
+
+// RestClient is a client of the vSphere REST API, which serves features that
+// the SOAP API doesn't, such as tagging. It logs in with the credentials of
+// the session it was created from and logs in again should its own session
+// expire. It is safe for concurrent use.
+type RestClient struct {
+	u      *url.URL
+	client *http.Client
+	user   *url.Userinfo
+
+	// readOnly rejects the calls that aren't restQueries, as for ReadOnly sessions
+	readOnly bool
+
+	// mu guards id, the REST session
+	mu sync.Mutex
+	id string
+}
+
+// restQueries are the actions of the REST API that only read, which read only
+// clients allow along with GET requests. All other calls are rejected.
+var restQueries = map[string]bool{
+	"list-attached-tags":    true,
+	"list-attached-objects": true,
+}
+
+// restQuery returns whether the call of method on path only reads
+func restQuery(method, path string) bool {
+	if method == http.MethodGet || method == http.MethodHead {
+		return true
+	}
+
+	i := strings.Index(path, "?~action=")
+	return i >= 0 && restQueries[path[i+len("?~action="):]]
+}
+
+// restError is the body of a failed REST call
+type restError struct {
+	Type  string `json:"type"`
+	Value struct {
+		Messages []struct {
+			DefaultMessage string `json:"default_message"`
+		} `json:"messages"`
+	} `json:"value"`
+}
+
+func newRestClient(u *url.URL, transport http.RoundTripper, user *url.Userinfo) *RestClient {
+	return &RestClient{
+		u:      u,
+		client: &http.Client{Transport: transport},
+		user:   user,
+	}
+}
+
+// RestClient returns a REST client logged in with the credentials in the
+// service URL, over a connection configured as that of the SOAP client. The
+// REST API cannot adopt the SOAP session, so it has its own, but the
+// credentials are not asked for again. The client is created on first use and
+// again if the SOAP client is replaced by Reconnect, which logs out of the
+// REST session of the replaced client. Only VC serves the REST API, and token
+// and certificate logins are not supported. The clients of ReadOnly sessions
+// reject calls that would change anything with ErrReadOnly.
+func (s *Session) RestClient(ctx context.Context) (*RestClient, error) {
+	client := s.client()
+	if client == nil {
+		return nil, ErrSessionExpired
+	}
+
+	s.rcl.Lock()
+	defer s.rcl.Unlock()
+
+	if s.rc != nil {
+		if s.rcc == client {
+			return s.rc, nil
+		}
+
+		// created for a client that was replaced without Reconnect
+		s.rc.Logout(ctx)
+		s.rc = nil
+		s.rcc = nil
+	}
+
+	if !client.IsVC() {
+		return nil, errors.New("The REST API is only served by VC")
+	}
+	if s.Token != "" || s.HasCertificate() {
+		return nil, errors.New("REST login requires the credentials in the service URL")
+	}
+
+	s.l.RLock()
+	service := s.ActiveService
+	s.l.RUnlock()
+	if service == "" {
+		service = s.Service
+	}
+
+	soapURL, err := parseService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	u := client.Client.Client.URL()
+	u.User = nil
+	u.Path = restPath
+	u.RawQuery = ""
+
+	// the debug output is for SOAP, and its redaction doesn't cover REST sessions
+	rc := newRestClient(u, withoutDebug(client.Client.Client.Transport), soapURL.User)
+	rc.readOnly = s.ReadOnly
+	if err = rc.Login(ctx); err != nil {
+		return nil, err
+	}
+
+	s.rc = rc
+	s.rcc = client
+	return rc, nil
+}
+
+// logoutRest logs out of the REST session, if one was created
+func (s *Session) logoutRest(ctx context.Context) {
+	s.rcl.Lock()
+	rc := s.rc
+	s.rc = nil
+	s.rcc = nil
+	s.rcl.Unlock()
+
+	if rc != nil {
+		// the REST session expires by itself if this fails
+		rc.Logout(ctx)
+	}
+}
+
+// retireRest logs out of the REST session created with client, if any, now that
+// client has been replaced
+func (s *Session) retireRest(ctx context.Context, client *govmomi.Client) {
+	s.rcl.Lock()
+	rc := s.rc
+	if rc == nil || s.rcc != client {
+		s.rcl.Unlock()
+		return
+	}
+	s.rc = nil
+	s.rcc = nil
+	s.rcl.Unlock()
+
+	if err := rc.Logout(ctx); err != nil {
+		log.Debugf("Failed to log out of the replaced REST session: %s", err)
+	}
+}
+
+// Login creates a REST session with the client's credentials
+func (c *RestClient) Login(ctx context.Context) error {
+	req, err := c.request(http.MethodPost, restSessionPath, nil)
+	if err != nil {
+		return err
+	}
+
+	if c.user != nil {
+		password, _ := c.user.Password()
+		req.SetBasicAuth(c.user.Username(), password)
+	}
+
+	var id string
+	if err = c.send(ctx, req, &id); err != nil {
+		if err == errRestUnauthenticated {
+			return errors.New("REST login failed: the credentials were rejected")
+		}
+		return errors.Errorf("REST login failed: %s", err)
+	}
+
+	c.mu.Lock()
+	c.id = id
+	c.mu.Unlock()
+	return nil
+}
+
+// Logout ends the REST session
+func (c *RestClient) Logout(ctx context.Context) error {
+	c.mu.Lock()
+	id := c.id
+	c.id = ""
+	c.mu.Unlock()
+
+	if id == "" {
+		return nil
+	}
+
+	req, err := c.request(http.MethodDelete, restSessionPath, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(restSessionHeader, id)
+
+	return c.send(ctx, req, nil)
+}
+
+// Do calls the REST API method at path, relative to /rest, sending in as the
+// JSON body if not nil and decoding the value of the response into out if not
+// nil. Should the REST session have expired it logs in again and retries once.
+func (c *RestClient) Do(ctx context.Context, method, path string, in, out interface{}) error {
+	if c.readOnly && !restQuery(method, path) {
+		return ErrReadOnly
+	}
+
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		c.mu.Lock()
+		id := c.id
+		c.mu.Unlock()
+
+		req, err := c.request(method, path, body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(restSessionHeader, id)
+
+		err = c.send(ctx, req, out)
+		if err != errRestUnauthenticated || attempt > 0 {
+			return err
+		}
+
+		if err = c.Login(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// errRestUnauthenticated is returned by send for a 401, so that Do can log in again
+var errRestUnauthenticated = errors.New("REST session is not authenticated")
+
+func (c *RestClient) request(method, path string, body []byte) (*http.Request, error) {
+	u := *c.u
+	u.Path += path
+
+	// the action of a POST is given as a query, e.g. ?~action=attach
+	if i := strings.Index(u.Path, "?"); i >= 0 {
+		u.RawQuery = u.Path[i+1:]
+		u.Path = u.Path[:i]
+	}
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// send sends req, decoding the value of the response into out if not nil
+func (c *RestClient) send(ctx context.Context, req *http.Request, out interface{}) error {
+	res, err := ctxhttp.Do(ctx, c.client, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized:
+		return errRestUnauthenticated
+	case res.StatusCode >= http.StatusBadRequest:
+		var rerr restError
+		if json.NewDecoder(res.Body).Decode(&rerr) == nil && len(rerr.Value.Messages) > 0 {
+			return errors.Errorf("%s %s: %s", req.Method, req.URL.Path, rerr.Value.Messages[0].DefaultMessage)
+		}
+		return errors.Errorf("%s %s: %s", req.Method, req.URL.Path, res.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	// every response is an object holding the result as its value
+	value := struct {
+		Value interface{} `json:"value"`
+	}{out}
+	return json.NewDecoder(res.Body).Decode(&value)
+}
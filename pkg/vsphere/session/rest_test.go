@@ -0,0 +1,199 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// restServer fakes enough of the tagging API to exercise RestClient and TagManager
+type restServer struct {
+	mu       sync.Mutex
+	logins   int
+	sessions map[string]bool
+	attached map[string][]string
+}
+
+func (r *restServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reply := func(v interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": v})
+	}
+
+	if req.URL.Path == "/rest/com/vmware/cis/session" && req.Method == http.MethodPost {
+		if user, password, ok := req.BasicAuth(); !ok || user != "user" || password != "pass" {
+			http.Error(w, "bad credentials", http.StatusUnauthorized)
+			return
+		}
+		r.logins++
+		id := fmt.Sprintf("session-%d", r.logins)
+		r.sessions[id] = true
+		reply(id)
+		return
+	}
+
+	id := req.Header.Get("vmware-api-session-id")
+	if !r.sessions[id] {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	var spec struct {
+		ObjectID tagObject `json:"object_id"`
+	}
+	json.NewDecoder(req.Body).Decode(&spec)
+
+	switch {
+	case req.Method == http.MethodDelete && req.URL.Path == "/rest/com/vmware/cis/session":
+		delete(r.sessions, id)
+	case req.URL.Path == "/rest/com/vmware/cis/tagging/tag/id:urn:tag-1" && req.Method == http.MethodGet:
+		reply(Tag{ID: "urn:tag-1", Name: "gold", CategoryID: "urn:cat-1"})
+	case req.URL.Path == "/rest/com/vmware/cis/tagging/tag-association/id:urn:tag-1" && req.URL.RawQuery == "~action=attach":
+		r.attached[spec.ObjectID.ID] = append(r.attached[spec.ObjectID.ID], "urn:tag-1")
+	case req.URL.Path == "/rest/com/vmware/cis/tagging/tag-association" && req.URL.RawQuery == "~action=list-attached-tags":
+		reply(r.attached[spec.ObjectID.ID])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type":  "com.vmware.vapi.std.errors.not_found",
+			"value": map[string]interface{}{"messages": []map[string]string{{"default_message": "Not found"}}},
+		})
+	}
+}
+
+func TestTagManager(t *testing.T) {
+	ctx := context.Background()
+
+	fake := &restServer{sessions: map[string]bool{}, attached: map[string][]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/rest")
+	c := newRestClient(u, http.DefaultTransport, url.UserPassword("user", "pass"))
+	if !assert.NoError(t, c.Login(ctx)) {
+		return
+	}
+	m := &TagManager{c: c}
+
+	tag, err := m.GetTag(ctx, "urn:tag-1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "gold", tag.Name)
+	}
+
+	vm := types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-42"}
+	assert.NoError(t, m.AttachTag(ctx, "urn:tag-1", vm))
+
+	// an expired REST session is replaced transparently
+	fake.mu.Lock()
+	fake.sessions = map[string]bool{}
+	fake.mu.Unlock()
+
+	ids, err := m.ListAttachedTags(ctx, vm)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"urn:tag-1"}, ids)
+	assert.Equal(t, 2, fake.logins)
+
+	_, err = m.GetTag(ctx, "urn:tag-2")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Not found")
+	}
+
+	assert.NoError(t, c.Logout(ctx))
+	assert.Empty(t, fake.sessions)
+}
+
+func TestRestLoginFailure(t *testing.T) {
+	server := httptest.NewServer(&restServer{sessions: map[string]bool{}})
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/rest")
+	err := newRestClient(u, http.DefaultTransport, url.UserPassword("user", "wrong")).Login(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "rejected")
+	}
+}
+
+func TestRestClientUnconnected(t *testing.T) {
+	_, err := NewSession(&Config{}).RestClient(context.Background())
+	assert.Equal(t, ErrSessionExpired, err)
+}
+
+func TestRestClientReadOnly(t *testing.T) {
+	ctx := context.Background()
+
+	fake := &restServer{sessions: map[string]bool{}, attached: map[string][]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/rest")
+	c := newRestClient(u, http.DefaultTransport, url.UserPassword("user", "pass"))
+	c.readOnly = true
+	if !assert.NoError(t, c.Login(ctx)) {
+		return
+	}
+	m := &TagManager{c: c}
+
+	vm := types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-42"}
+	assert.Equal(t, ErrReadOnly, m.AttachTag(ctx, "urn:tag-1", vm))
+	assert.Equal(t, ErrReadOnly, m.DetachTag(ctx, "urn:tag-1", vm))
+	assert.Empty(t, fake.attached)
+
+	// queries are still allowed, POST or not
+	_, err := m.GetTag(ctx, "urn:tag-1")
+	assert.NoError(t, err)
+	_, err = m.ListAttachedTags(ctx, vm)
+	assert.NoError(t, err)
+}
+
+func TestRetireRest(t *testing.T) {
+	ctx := context.Background()
+
+	fake := &restServer{sessions: map[string]bool{}, attached: map[string][]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/rest")
+	c := newRestClient(u, http.DefaultTransport, url.UserPassword("user", "pass"))
+	if !assert.NoError(t, c.Login(ctx)) {
+		return
+	}
+
+	old := &govmomi.Client{Client: &vim25.Client{}}
+	s := NewSessionFromClient(old, nil)
+	s.rc, s.rcc = c, old
+
+	// replacing the SOAP client logs out of the REST session created with it
+	s.swap(ctx, &Session{Client: &govmomi.Client{Client: &vim25.Client{}}})
+	assert.Nil(t, s.rc)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Empty(t, fake.sessions)
+}
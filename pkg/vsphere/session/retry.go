@@ -0,0 +1,102 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// isNotAuthenticated returns whether err is a NotAuthenticated fault, as
+// returned once the server session has expired
+func isNotAuthenticated(err error) bool {
+	var fault interface{}
+
+	switch {
+	case soap.IsSoapFault(err):
+		fault = soap.ToSoapFault(err).VimFault()
+	case soap.IsVimFault(err):
+		fault = soap.ToVimFault(err)
+	default:
+		return false
+	}
+
+	switch fault.(type) {
+	case types.NotAuthenticated, *types.NotAuthenticated:
+		return true
+	}
+	return false
+}
+
+// WithRetry calls fn, and if it fails because the session has expired logs in
+// again with the configured credentials and calls it once more. If either the
+// login or the retry fails the original error is returned. Unlike Reconnect the
+// existing client is kept, along with the cached resources.
+func (s *Session) WithRetry(ctx context.Context, fn func(context.Context) error) error {
+	err := fn(ctx)
+	if !isNotAuthenticated(err) {
+		return err
+	}
+
+	if lerr := s.relogin(ctx); lerr != nil {
+		log.Debugf("Unable to log in again after %s: %s", err, lerr)
+		return err
+	}
+
+	if rerr := fn(ctx); rerr != nil {
+		return err
+	}
+	return nil
+}
+
+// relogin logs the existing client in again. Concurrent callers are serialized
+// and only the first logs in, the others finding the session active again.
+func (s *Session) relogin(ctx context.Context) error {
+	// a request failing while we log in mustn't log in again in turn
+	ctx = context.WithValue(ctx, reloginKey{}, true)
+
+	s.ll.Lock()
+	defer s.ll.Unlock()
+
+	// an explicit Logout isn't undone
+	s.l.RLock()
+	client := s.Client
+	loggedOut := s.loggedOut
+	service := s.ActiveService
+	s.l.RUnlock()
+
+	if client == nil || loggedOut {
+		return ErrSessionExpired
+	}
+
+	if s.Ping(ctx) == nil {
+		return nil
+	}
+
+	// the credentials are those of the service we're connected to
+	if service == "" {
+		service = s.Service
+	}
+
+	soapURL, err := parseService(service)
+	if err != nil {
+		return err
+	}
+
+	return s.login(ctx, client, soapURL.User)
+}
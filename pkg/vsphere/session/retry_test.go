@@ -0,0 +1,94 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/vsphere/test/env"
+)
+
+func TestIsNotAuthenticated(t *testing.T) {
+	assert.True(t, isNotAuthenticated(soap.WrapVimFault(&types.NotAuthenticated{})))
+	assert.False(t, isNotAuthenticated(soap.WrapVimFault(&types.InvalidLogin{})))
+	assert.False(t, isNotAuthenticated(errors.New("NotAuthenticated")))
+	assert.False(t, isNotAuthenticated(nil))
+}
+
+func TestWithRetry(t *testing.T) {
+	ctx := context.Background()
+	s := NewSession(&Config{})
+
+	calls := 0
+	other := errors.New("not found")
+	err := s.WithRetry(ctx, func(context.Context) error {
+		calls++
+		return other
+	})
+	assert.Equal(t, other, err)
+	assert.Equal(t, 1, calls, "Only NotAuthenticated should be retried")
+
+	// without a client there's nothing to log in again, so the fault is returned
+	calls = 0
+	expired := soap.WrapVimFault(&types.NotAuthenticated{})
+	err = s.WithRetry(ctx, func(context.Context) error {
+		calls++
+		return expired
+	})
+	assert.Equal(t, expired, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestWithRetryRelogin(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:  env.URL(t),
+		Insecure: true,
+	}
+
+	session, err := NewSession(config).Connect(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer session.Logout(ctx)
+
+	us, err := session.UserSession(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// expire the session behind the client's back, from another session as
+	// the current session cannot be terminated
+	admin, err := NewSession(config).Connect(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer admin.Logout(ctx)
+
+	assert.NoError(t, admin.SessionManager.TerminateSession(ctx, []string{us.Key}))
+
+	err = session.WithRetry(ctx, func(ctx context.Context) error {
+		_, err := session.GetFinder().DefaultDatacenter(ctx)
+		return err
+	})
+	assert.NoError(t, err)
+}
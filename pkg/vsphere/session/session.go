@@ -26,16 +26,26 @@ package session
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"golang.org/x/net/context"
 
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/list"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
 	"github.com/vmware/govmomi/session"
 	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/soap"
 	"github.com/vmware/govmomi/vim25/types"
 	"github.com/vmware/vic/pkg/errors"
@@ -44,21 +54,245 @@ import (
 // Config contains the configuration used to create a Session.
 type Config struct {
 	// SDK URL or proxy
-	Service string
+	Service string `json:"service"`
+
+	// Further SDK URLs to fail over to, in order, should Service be unavailable.
+	// Service, if set, is tried first.
+	Services []string `json:"services,omitempty"`
 	// Allow insecure connection to Service
-	Insecure bool
+	Insecure bool `json:"insecure,omitempty"`
+	// SHA-1 or SHA-256 thumbprint of the certificate Service must present, overrides Insecure
+	Thumbprint string `json:"thumbprint,omitempty"`
+	// PEM encoded CAs trusted to sign the certificate of Service, in addition to or
+	// instead of a file. These replace the system roots. Insecure would skip the
+	// verification they're for, so cannot be combined with them.
+	CAFile string `json:"caFile,omitempty"`
+	CAData []byte `json:"caData,omitempty"`
 	// Keep alive duration
-	Keepalive time.Duration
+	Keepalive time.Duration `json:"keepalive,omitempty"`
+	// Invoked when a keepalive request fails, for example because the session has
+	// expired server side. Returning an error stops further keepalive requests.
+	KeepaliveHandler func(error) error `json:"-"`
+
+	// Inventory paths of the resources to cache. Other than DVSPath, each may
+	// instead be a managed object reference such as "Datastore:datastore-42",
+	// which is resolved directly rather than searched for, as may the entries of
+	// DatastorePaths and NetworkPaths.
+	ClusterPath    string `json:"clusterPath,omitempty"`
+	DatacenterPath string `json:"datacenterPath,omitempty"`
+	DatastorePath  string `json:"datastorePath,omitempty"`
+	HostPath       string `json:"hostPath,omitempty"`
+	NetworkPath    string `json:"networkPath,omitempty"`
+	PoolPath       string `json:"poolPath,omitempty"`
+	FolderPath     string `json:"folderPath,omitempty"`
+	DVSPath        string `json:"dvsPath,omitempty"`
+
+	// Datastore cluster for Storage DRS placement via RecommendedDatastore. This
+	// doesn't alter how DatastorePath is resolved, so if both are set Datastore is
+	// the datastore named by DatastorePath rather than a member of the cluster.
+	StoragePodPath string `json:"storagePodPath,omitempty"`
+
+	// vApp to place workloads in, as an alternative to PoolPath
+	VirtualAppPath string `json:"virtualAppPath,omitempty"`
+
+	// Datastores to cache, mutually exclusive with DatastorePath
+	DatastorePaths []string `json:"datastorePaths,omitempty"`
+
+	// Networks to cache, mutually exclusive with NetworkPath
+	NetworkPaths []string `json:"networkPaths,omitempty"`
+
+	// Datacenter to take relative paths from, and to cache if DatacenterPath
+	// isn't set. If set, Populate first makes the paths absolute as described
+	// by NormalizePaths.
+	DefaultDatacenter string `json:"defaultDatacenter,omitempty"`
+
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+
+	// File in which session cookies are cached, keyed by service URL and user,
+	// so that a later Connect can reuse an active session rather than log in.
+	// The vendored keepalive only starts on login, so it has no effect on a
+	// reused session.
+	SessionCacheFile string `json:"sessionCacheFile,omitempty"`
+
+	// SAML bearer token, as issued by an STS, to log in with instead of the
+	// credentials in Service. Only supported by VC. The vendored keepalive only
+	// starts on password or certificate login, so Keepalive has no effect.
+	Token string `json:"token,omitempty"`
+
+	// Ticket from AcquireCloneTicket on another session, to join that session's
+	// identity instead of logging in with the credentials in Service. Tickets
+	// are single use, so a session that expires cannot log in again with it, and
+	// as with Token the vendored keepalive doesn't start.
+	SessionTicket string `json:"sessionTicket,omitempty"`
+
+	// Obtain a SAML bearer token from the STS with the credentials in Service
+	// and log in with that, rather than with the credentials directly. The token
+	// is reused by later logins of the session, as by WithRetry and Reconnect,
+	// until it's about to expire, when another is issued. Only supported by VC,
+	// and as with Token the vendored keepalive doesn't start.
+	STSIssueToken bool `json:"stsIssueToken,omitempty"`
+
+	// URL of the STS to obtain tokens from, that of the vsphere.local domain on
+	// the host of Service if empty
+	STSURL string `json:"stsURL,omitempty"`
+
+	// Reconnect backoff - zero values select the package defaults
+	ReconnectBaseDelay   time.Duration `json:"reconnectBaseDelay,omitempty"`
+	ReconnectMaxDelay    time.Duration `json:"reconnectMaxDelay,omitempty"`
+	ReconnectMaxAttempts int           `json:"reconnectMaxAttempts,omitempty"`
+
+	// HTTP or HTTPS proxy to connect through, honoring NO_PROXY. If empty
+	// the proxy environment variables are used.
+	Proxy string `json:"proxy,omitempty"`
+
+	// Dials the connections to Service, or to Proxy if set, in place of the
+	// default dialer. TLS is negotiated over the returned connection as usual.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error) `json:"-"`
+
+	// Wraps the round tripper of each client, outside the keepalive, so that
+	// every SOAP call made through the client passes through it, such as for
+	// tracing. Keepalive requests and token logins bypass it. It is called again
+	// on Logout, as the keepalive is removed.
+	RoundTripperWrapper func(soap.RoundTripper) soap.RoundTripper `json:"-"`
+
+	// Records connects, populates and the number of active sessions, if set
+	Metrics Metrics `json:"-"`
+
+	// Replacements for the lookups Populate makes, if set
+	Resolvers *Resolvers `json:"-"`
+
+	// User-Agent header sent with every request, identifying the client in the
+	// server's session list and logs. The Go default is used if empty.
+	UserAgent string `json:"userAgent,omitempty"`
+
+	// Write the body of every request made by the client, and of its response,
+	// to DebugWriter, or to stderr if that's nil. Passwords, tokens and session
+	// tickets are redacted. Unlike the vendored soap debug this covers only the
+	// session's SOAP client, keepalives and token logins included, and not the
+	// REST client.
+	DebugSOAP   bool      `json:"debugSOAP,omitempty"`
+	DebugWriter io.Writer `json:"-"`
+
+	// vim25 namespace and API version, e.g. "urn:vim25" and "5.5", the client
+	// speaks in place of the govmomi defaults, if set. Connect fails if the
+	// server's API version is older than VimVersion.
+	VimNamespace string `json:"vimNamespace,omitempty"`
+	VimVersion   string `json:"vimVersion,omitempty"`
+
+	// Batches of events WatchEvents buffers for a slow handler, a package
+	// default if zero, and whether it drops batches once the buffer is full
+	// rather than waiting for the handler
+	EventBufferSize int  `json:"eventBufferSize,omitempty"`
+	DropEvents      bool `json:"dropEvents,omitempty"`
+
+	// Share the authenticated client with the other sessions in this process
+	// that connect to the same service with the same credentials and connection
+	// settings, rather than log in again. The server session is only logged out
+	// once all of them have logged out. The client keeps the keepalive and
+	// RoundTripperWrapper of the session that created it. Sessions with a
+	// DialContext never share, while Resolvers only affect the session's own
+	// Populate.
+	ShareClient bool `json:"shareClient,omitempty"`
+
+	// Reject the MutatingMethods with ErrReadOnly, as a safety net for tools that
+	// should only inspect the inventory. The REST client and datastore uploads are
+	// held to the same.
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// Whether the Finder retrieves all properties of the objects it lists, true
+	// if nil. When false only the name (and resource pool of compute resources)
+	// is retrieved, which is considerably cheaper in large inventories. Path
+	// matching is the same either way, but objects returned by the Finder have
+	// less cached state, so callers relying on it must fetch properties directly.
+	FinderAllFlag *bool `json:"finderAllFlag,omitempty"`
+
+	// Whether Populate leaves the Finder scoped to the datacenter it resolves,
+	// true if nil. Scoped, relative paths and the Finder's defaults resolve
+	// within that datacenter. Unscoped, the Finder searches the whole inventory,
+	// so relative paths resolve from the root folder and its defaults fail
+	// if there are several datacenters, but objects in any datacenter can be
+	// found by their absolute paths. Populate and the helpers that list the
+	// cached datacenter's contents are scoped to it either way.
+	ScopeFinderToDatacenter *bool `json:"scopeFinderToDatacenter,omitempty"`
+
+	// Resolve the default for every resource whose path is empty, rather than
+	// skipping it. The default lookups fail if there are several candidates,
+	// such as multiple clusters on VC. The network, DVS, storage pod and vApp are
+	// only ever resolved when a path is given.
+	RequireAll bool `json:"requireAll,omitempty"`
+
+	// Leave a resource unset, rather than fail, when its path is empty and the
+	// default lookup finds several candidates. Only find.DefaultMultipleFoundError
+	// becomes soft: resources that are not found at all, or an explicit path
+	// matching several, still fail, as does an ambiguous datacenter since the
+	// other resources are resolved within it. As defaults are only looked up
+	// with RequireAll, this has no effect without it, which Warnings reports.
+	TolerateAmbiguous bool `json:"tolerateAmbiguous,omitempty"`
+
+	// Bound on each individual login and resource lookup, none if zero
+	OperationTimeout time.Duration `json:"operationTimeout,omitempty"`
+
+	// Bound on establishing each connection to Service, before login, none if zero
+	ConnectTimeout time.Duration `json:"connectTimeout,omitempty"`
+
+	// Further attempts at establishing each connection should it fail in a way
+	// that may be transient, as while the server is starting, and the delay
+	// before the first of them, doubling for each after, a package default if zero.
+	// Login failures aren't retried.
+	ConnectRetries    int           `json:"connectRetries,omitempty"`
+	ConnectRetryDelay time.Duration `json:"connectRetryDelay,omitempty"`
 
-	ClusterPath    string
-	DatacenterPath string
-	DatastorePath  string
-	HostPath       string
-	NetworkPath    string
-	PoolPath       string
+	// Whether Service reliably routes every request of a session to the same
+	// server, as it does unless it's a load balancer fronting several vCenter
+	// nodes without session affinity. Defaults to true. When false, a
+	// NotAuthenticated fault straight after login, or on any later request, is
+	// taken to mean the request reached a node that doesn't know the session,
+	// and the client logs in again and retries it once. That costs Connect a
+	// round trip to confirm the login, and means an expired session is logged
+	// in again rather than reported by Ping and UserSession. Keepalive requests
+	// bypass this, so with a load balancer that isn't sticky they keep alive
+	// only the node they reach, and a NotAuthenticated keepalive is reported to
+	// KeepaliveHandler as usual.
+	StickySession *bool `json:"stickySession,omitempty"`
+}
+
+const (
+	defaultReconnectBaseDelay   = time.Second
+	defaultReconnectMaxDelay    = 30 * time.Second
+	defaultReconnectMaxAttempts = 5
+
+	// cleanupTimeout bounds the logout made when Create fails
+	cleanupTimeout = 10 * time.Second
+)
+
+// services returns Service followed by Services, without blanks or duplicates
+func (c *Config) services() []string {
+	var services []string
+	seen := make(map[string]bool)
+
+	for _, service := range append([]string{c.Service}, c.Services...) {
+		if service != "" && !seen[service] {
+			seen[service] = true
+			services = append(services, service)
+		}
+	}
+	return services
+}
+
+// finderAll returns the all flag to create the Finder with
+func (c *Config) finderAll() bool {
+	return c.FinderAllFlag == nil || *c.FinderAllFlag
+}
+
+// stickySession returns whether every request of a session reaches the same server
+func (c *Config) stickySession() bool {
+	return c.StickySession == nil || *c.StickySession
+}
 
-	CertFile string
-	KeyFile  string
+// scopeFinder returns whether Populate scopes the Finder to the datacenter
+func (c *Config) scopeFinder() bool {
+	return c.ScopeFinderToDatacenter == nil || *c.ScopeFinderToDatacenter
 }
 
 // HasCertificate checks for presence of a certificate and keyfile
@@ -66,7 +300,109 @@ func (c *Config) HasCertificate() bool {
 	return c.CertFile != "" && c.KeyFile != ""
 }
 
+// Validate checks the configuration for problems that can be detected without
+// contacting Service, returning a single error describing all that were found.
+// Settings that are valid but ignored are reported by Warnings instead.
+func (c *Config) Validate() error {
+	var errs []string
+
+	if len(c.services()) == 0 {
+		errs = append(errs, "SDK URL (Service or Services) must be specified")
+	}
+
+	if c.CertFile != "" && c.KeyFile == "" {
+		errs = append(errs, "Certificate file specified without a key file")
+	}
+	if c.KeyFile != "" && c.CertFile == "" {
+		errs = append(errs, "Key file specified without a certificate file")
+	}
+
+	if c.Token != "" && (c.CertFile != "" || c.KeyFile != "") {
+		errs = append(errs, "Token cannot be combined with certificate authentication")
+	}
+	if c.SessionTicket != "" && (c.Token != "" || c.CertFile != "" || c.KeyFile != "") {
+		errs = append(errs, "Session ticket cannot be combined with token or certificate authentication")
+	}
+	if c.STSIssueToken && (c.Token != "" || c.SessionTicket != "" || c.CertFile != "" || c.KeyFile != "") {
+		errs = append(errs, "Issuing a token cannot be combined with token, session ticket or certificate authentication")
+	}
+	if c.STSURL != "" {
+		if u, err := url.Parse(c.STSURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, "STS URL must be an http or https URL")
+		}
+	}
+
+	if c.Thumbprint != "" && !validThumbprint(c.Thumbprint) {
+		errs = append(errs, "Thumbprint must be a SHA-1 or SHA-256 hex digest")
+	}
+	if c.Insecure && (c.CAFile != "" || len(c.CAData) > 0) {
+		errs = append(errs, "CA file or data cannot be combined with insecure")
+	}
+
+	if _, _, ok := parseAPIVersion(c.VimVersion); c.VimVersion != "" && !ok {
+		errs = append(errs, "Vim version must be of the form major.minor")
+	}
+
+	if c.Proxy != "" {
+		if _, err := c.parseProxy(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if c.Keepalive < 0 {
+		errs = append(errs, "Keepalive must not be negative")
+	}
+	if c.OperationTimeout < 0 {
+		errs = append(errs, "Operation timeout must not be negative")
+	}
+	if c.ConnectTimeout < 0 {
+		errs = append(errs, "Connect timeout must not be negative")
+	}
+	if c.ConnectRetries < 0 || c.ConnectRetryDelay < 0 {
+		errs = append(errs, "Connect retry settings must not be negative")
+	}
+	if c.EventBufferSize < 0 {
+		errs = append(errs, "Event buffer size must not be negative")
+	}
+	if c.ReconnectBaseDelay < 0 || c.ReconnectMaxDelay < 0 || c.ReconnectMaxAttempts < 0 {
+		errs = append(errs, "Reconnect backoff settings must not be negative")
+	}
+
+	if c.DatastorePath != "" && len(c.DatastorePaths) > 0 {
+		errs = append(errs, "Only one of datastore path and datastore paths may be specified")
+	}
+	if c.NetworkPath != "" && len(c.NetworkPaths) > 0 {
+		errs = append(errs, "Only one of network path and network paths may be specified")
+	}
+
+	if len(errs) > 0 {
+		return errors.Errorf("Invalid configuration:\n%s", strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
+// Warnings returns the settings of the configuration that are valid but will be
+// ignored in favour of others, for display to the user. Connect logs them too.
+func (c *Config) Warnings() []string {
+	var warnings []string
+
+	if c.Insecure && c.Thumbprint != "" {
+		warnings = append(warnings, "Both insecure and thumbprint specified, ignoring insecure in favour of the thumbprint")
+	}
+	if c.TolerateAmbiguous && !c.RequireAll {
+		warnings = append(warnings, "Tolerating ambiguous defaults has no effect as they're only resolved when all resources are required")
+	}
+
+	return warnings
+}
+
 // Session caches vSphere objects obtained by querying the SDK.
+//
+// The cached resources may be read concurrently via the Get accessors. Populate
+// and Reconnect take the write lock only to swap in a complete set of resources,
+// after resolving them without it held. Direct access to the exported fields
+// is not synchronized and should be confined to single goroutine use.
 type Session struct {
 	*govmomi.Client
 
@@ -75,48 +411,369 @@ type Session struct {
 	Cluster    *object.ComputeResource
 	Datacenter *object.Datacenter
 	Datastore  *object.Datastore
+	Datastores []*object.Datastore
 	Host       *object.HostSystem
 	Network    object.NetworkReference
+	Networks   []object.NetworkReference
 	Pool       *object.ResourcePool
+	VMFolder   *object.Folder
+	DVS        *object.DistributedVirtualSwitch
+	StoragePod *object.StoragePod
+	VirtualApp *object.VirtualApp
 
 	Finder *find.Finder
+
+	// ActiveService is the service that Connect succeeded with
+	ActiveService string
+
+	// ServerCertificates is the chain, leaf first, that the server presented
+	// when Connect succeeded, recorded even if Insecure is set so that it can be
+	// displayed or its thumbprint pinned for later connections
+	ServerCertificates []*x509.Certificate
+
+	// kind is the ServerKind of Client, derived once it's created, under l
+	kind ServerKind
+
+	// caps guards isVC and isVSAN, cached on first use or by refreshCapabilities
+	caps   sync.Mutex
+	isVC   *bool
+	isVSAN *bool
+
+	// l guards the cached resources while they are swapped by Reconnect
+	l sync.RWMutex
+
+	// loggedOut is set by Logout, and stopKeepalive closed, under l
+	loggedOut     bool
+	stopKeepalive chan struct{}
+
+	// keepalive is the connection state observed by the client's keepalive, if
+	// it has one, under l
+	keepalive *connection
+
+	// anonymous is set while the client is connected but not logged in, between
+	// ConnectAnonymous and Authenticate
+	anonymous bool
+
+	// owner is the clientOwner of a client that logs in again by itself, if not
+	// StickySession, under l
+	owner *clientOwner
+
+	// metered is whether the session is counted as active by Metrics, under l
+	metered bool
+
+	// shared is the registered client in use if ShareClient is set, under l
+	shared *sharedClient
+
+	// issued is the token last obtained from the STS if STSIssueToken, under l
+	issued *issuedToken
+
+	// folders are the cached DatacenterFolders of foldersDC, under l
+	folders   *object.DatacenterFolders
+	foldersDC *object.Datacenter
+
+	// rl guards reconnecting, the in-flight Reconnect shared by concurrent callers
+	rl           sync.Mutex
+	reconnecting *reconnectCall
+
+	// ll serializes the logins made by WithRetry
+	ll sync.Mutex
+
+	// pcl guards pc, the property collector for the client it was created with
+	pcl sync.Mutex
+	pc  *property.Collector
+	pcc *vim25.Client
+
+	// lcl guards lc, the licenses HasFeature queried by entity, for lcc
+	lcl sync.Mutex
+	lc  map[string]cachedLicenses
+	lcc *govmomi.Client
+
+	// rcl guards rc, the REST client for the client it was created with
+	rcl sync.Mutex
+	rc  *RestClient
+	rcc *govmomi.Client
+}
+
+// reconnectCall tracks a single in-flight reconnection
+type reconnectCall struct {
+	wg  sync.WaitGroup
+	err error
 }
 
 // NewSession creates a new Session struct. If config is nil,
-// it creates a Flags object from the command line arguments or
-// environment, and uses that instead to create a Session.
+// it uses the configuration from the govc environment variables
+// instead, as returned by ConfigFromEnv.
 func NewSession(config *Config) *Session {
+	if config == nil {
+		config = ConfigFromEnv()
+	}
 	return &Session{Config: config}
 }
 
+// NewSessionFromClient creates a Session that wraps an already authenticated
+// client. Populate can be called directly on the result; Connect is a no-op
+// until the session is logged out. If config is nil an empty Config is used.
+func NewSessionFromClient(client *govmomi.Client, config *Config) *Session {
+	if config == nil {
+		config = &Config{}
+	}
+
+	return &Session{
+		Client: client,
+		Config: config,
+		Finder: find.NewFinder(client.Client, config.finderAll()),
+		kind:   serverKind(client.ServiceContent.About),
+	}
+}
+
+// client returns the govmomi client, which may be replaced by Reconnect
+func (s *Session) client() *govmomi.Client {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.Client
+}
+
+// GetCluster returns the cached compute resource
+func (s *Session) GetCluster() *object.ComputeResource {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.Cluster
+}
+
+// GetDatacenter returns the cached datacenter
+func (s *Session) GetDatacenter() *object.Datacenter {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.Datacenter
+}
+
+// GetDatastore returns the cached datastore
+func (s *Session) GetDatastore() *object.Datastore {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.Datastore
+}
+
+// GetDatastores returns the cached datastores
+func (s *Session) GetDatastores() []*object.Datastore {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.Datastores
+}
+
+// GetHost returns the cached host
+func (s *Session) GetHost() *object.HostSystem {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.Host
+}
+
+// GetNetwork returns the cached network
+func (s *Session) GetNetwork() object.NetworkReference {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.Network
+}
+
+// GetNetworks returns the cached networks
+func (s *Session) GetNetworks() []object.NetworkReference {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.Networks
+}
+
+// GetPool returns the cached resource pool
+func (s *Session) GetPool() *object.ResourcePool {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.Pool
+}
+
+// GetVMFolder returns the cached VM folder
+func (s *Session) GetVMFolder() *object.Folder {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.VMFolder
+}
+
+// GetVirtualApp returns the cached vApp
+func (s *Session) GetVirtualApp() *object.VirtualApp {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.VirtualApp
+}
+
+// GetDVS returns the cached distributed virtual switch
+func (s *Session) GetDVS() *object.DistributedVirtualSwitch {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.DVS
+}
+
+// GetStoragePod returns the cached datastore cluster
+func (s *Session) GetStoragePod() *object.StoragePod {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.StoragePod
+}
+
+// GetFinder returns the finder, scoped to the cached datacenter once populated
+// unless ScopeFinderToDatacenter is false
+func (s *Session) GetFinder() *find.Finder {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.Finder
+}
+
+// scopedFinder returns a copy of the finder, which isn't safe for concurrent use,
+// scoped to the cached datacenter if there is one, or nil if there's no finder.
+// The finder itself is only scoped if ScopeFinderToDatacenter allows.
+func (s *Session) scopedFinder() *find.Finder {
+	s.l.RLock()
+	finder, dc := s.Finder, s.Datacenter
+	s.l.RUnlock()
+
+	if finder == nil {
+		return nil
+	}
+
+	f := *finder
+	if dc != nil && !s.scopeFinder() {
+		f.SetDatacenter(dc)
+	}
+	return &f
+}
+
 // Vim25 returns the vim25.Client to the caller
 func (s *Session) Vim25() *vim25.Client {
 	return s.Client.Client
 }
 
+// PropertyCollector returns the default property collector for the session's
+// client. It is created on first use, and again if the client is replaced by
+// Reconnect. The collector is safe for concurrent use. Nil is returned if the
+// session isn't connected.
+func (s *Session) PropertyCollector() *property.Collector {
+	client := s.client()
+	if client == nil {
+		return nil
+	}
+	c := client.Client
+
+	s.pcl.Lock()
+	defer s.pcl.Unlock()
+
+	if s.pc == nil || s.pcc != c {
+		s.pc = property.DefaultCollector(c)
+		s.pcc = c
+	}
+	return s.pc
+}
+
+// Properties retrieves the properties ps of ref into dst, which should be a
+// pointer to the matching mo type, using the session's property collector
+func (s *Session) Properties(ctx context.Context, ref types.ManagedObjectReference, ps []string, dst interface{}) error {
+	pc := s.PropertyCollector()
+	if pc == nil {
+		return ErrSessionExpired
+	}
+	return pc.RetrieveOne(ctx, ref, ps, dst)
+}
+
 // IsVC returns whether the session is backed by VC
 func (s *Session) IsVC() bool {
-	return s.Client.IsVC()
+	s.caps.Lock()
+	defer s.caps.Unlock()
+
+	if s.isVC == nil {
+		vc := s.client().IsVC()
+		s.isVC = &vc
+	}
+	return *s.isVC
 }
 
 // IsVSAN returns whether the datastore used in the session is backed by VSAN
 func (s *Session) IsVSAN(ctx context.Context) bool {
-	dsType, _ := s.Datastore.Type(ctx)
+	s.caps.Lock()
+	defer s.caps.Unlock()
+
+	if s.isVSAN == nil {
+		vsan, err := s.datastoreIsVSAN(ctx)
+		if err != nil {
+			// don't cache a transient failure
+			return false
+		}
+		s.isVSAN = &vsan
+	}
+	return *s.isVSAN
+}
+
+func (s *Session) datastoreIsVSAN(ctx context.Context) (bool, error) {
+	ds := s.GetDatastore()
+	if ds == nil {
+		return false, nil
+	}
+
+	dsType, err := ds.Type(ctx)
+	if err != nil {
+		return false, err
+	}
+	return dsType == types.HostFileSystemVolumeFileSystemTypeVsan, nil
+}
+
+// refreshCapabilities discards the cached IsVC and IsVSAN results and queries them
+// afresh, for use when the client or datastore has changed
+func (s *Session) refreshCapabilities(ctx context.Context) {
+	s.caps.Lock()
+	defer s.caps.Unlock()
+
+	s.isVC = nil
+	s.isVSAN = nil
+
+	client := s.client()
+	if client == nil {
+		return
+	}
+
+	vc := client.IsVC()
+	s.isVC = &vc
 
-	return dsType == types.HostFileSystemVolumeFileSystemTypeVsan
+	if vsan, err := s.datastoreIsVSAN(ctx); err == nil {
+		s.isVSAN = &vsan
+	}
 }
 
 // Create accepts a Config and returns a Session with the cached vSphere resources.
+// As with Connect, an invalid Config is rejected before any network I/O.
 func (s *Session) Create(ctx context.Context) (*Session, error) {
 	_, err := s.Connect(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// we're treating this as an atomic behaviour, so log out if we failed
+	// we're treating this as an atomic behaviour, so log out if we failed. The
+	// failure is often ctx being done, so the logout gets a context of its own
+	// lest the server session be left behind.
 	defer func() {
 		if err != nil {
-			s.Client.Logout(ctx)
+			lctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+			defer cancel()
+
+			s.Logout(lctx)
 		}
 	}()
 
@@ -128,110 +785,1524 @@ func (s *Session) Create(ctx context.Context) (*Session, error) {
 	return s, nil
 }
 
-// Connect establishes the connection for the session but nothing more
+// Connect establishes the connection for the session but nothing more.
+// The Config is validated before any connection is attempted. If the session
+// already holds a client, such as one from NewSessionFromClient, that has not
+// been logged out, it is reused as is.
+//
+// Each of the Config's services is tried in turn, starting from ActiveService
+// if set, until one succeeds. ActiveService is then set to that one. This is
+// ConnectAnonymous followed by Authenticate, and completes a session left
+// connected anonymously.
 func (s *Session) Connect(ctx context.Context) (*Session, error) {
-	soapURL, err := soap.ParseURL(s.Service)
-	if soapURL == nil || err != nil {
-		return nil, errors.Errorf("SDK URL (%s) could not be parsed: %s", s.Service, err)
+	if s.Client != nil && s.anonymous {
+		return s.Authenticate(ctx)
 	}
 
-	// we can't set a keep alive if we log in directly with client creation
-	user := soapURL.User
-	soapURL.User = nil
+	if s.Client != nil && !s.loggedOut {
+		if s.Finder == nil {
+			s.Finder = find.NewFinder(s.Vim25(), s.finderAll())
+		}
+		return s, nil
+	}
 
-	// 1st connect without any userinfo to get the API type
-	s.Client, err = govmomi.NewClient(ctx, soapURL, s.Insecure)
+	err := s.connectAny(ctx)
+	s.metrics().ObserveConnect(err)
 	if err != nil {
-		return nil, errors.Errorf("Failed to connect to %s: %s", soapURL.String(), err)
+		return nil, err
 	}
 
-	if s.HasCertificate() {
-		if !s.Client.IsVC() {
-			return nil, errors.Errorf("Certificate based authentication not yet supported with ESXi")
+	s.l.Lock()
+	s.metered = true
+	s.l.Unlock()
+	s.metrics().AddActiveSessions(1)
+
+	return s, nil
+}
+
+// connectAny connects to the first of the candidate services that succeeds
+func (s *Session) connectAny(ctx context.Context) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	// the CA configuration is checked here so that problems are reported before any network I/O
+	if _, err := s.rootCAs(); err != nil {
+		return err
+	}
+
+	services := s.candidates()
+
+	var errs []error
+	var msgs []string
+	for _, service := range services {
+		if s.shareable() && s.adopt(ctx, service) {
+			s.ActiveService = service
+			return nil
 		}
 
-		// load the certificates
-		cert, err2 := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
-		if err2 != nil {
-			return nil, errors.Errorf("Unable to load X509 key pair(%s,%s): %s", s.CertFile, s.KeyFile, err2)
+		err := s.connect(ctx, service)
+		if err == nil {
+			if s.shareable() {
+				s.share(service)
+			}
+			s.ActiveService = service
+			return nil
 		}
 
-		// create the new client
-		s.Client, err = govmomi.NewClientWithCertificate(ctx, soapURL, s.Insecure, cert)
-		if err != nil {
-			return nil, errors.Errorf("Failed to connect to %s: %s", soapURL.String(), err)
+		if len(services) == 1 {
+			return err
 		}
+		errs = append(errs, err)
+		msgs = append(msgs, err.Error())
 	}
 
-	if s.Keepalive != 0 {
-		// now that we've verified everything, enable keepalive
-		s.RoundTripper = session.KeepAlive(s.Client.RoundTripper, s.Keepalive)
+	return &connectErrors{
+		msg:  "Failed to connect to any of the services:\n" + strings.Join(msgs, "\n"),
+		errs: errs,
 	}
+}
 
-	// and now that the keepalive is registered we can log in to trigger it
-	if !s.HasCertificate() {
-		err = s.Client.Login(ctx, user)
-	} else {
-		err = s.LoginExtensionByCertificate(ctx, user.Username(), "")
-	}
-	if err != nil {
-		return nil, errors.Errorf("Failed to log in to %s: %s", soapURL.String(), err)
+// candidates returns the services for Connect to try, in order, starting from
+// ActiveService if that is one of them
+func (s *Session) candidates() []string {
+	services := s.services()
+
+	for i, service := range services {
+		if service == s.ActiveService {
+			return append(append([]string{}, services[i:]...), services[:i]...)
+		}
 	}
+	return services
+}
 
-	s.Finder = find.NewFinder(s.Vim25(), true)
+// connect establishes the connection to service, leaving no client behind if
+// it fails
+func (s *Session) connect(ctx context.Context, service string) error {
+	if err := s.connectAnonymous(ctx, service); err != nil {
+		return err
+	}
 
-	return s, nil
+	if err := s.authenticate(ctx, service); err != nil {
+		// don't leave a half connected client behind, or a retry would reuse it
+		s.disconnect()
+		return err
+	}
+	return nil
 }
 
-// Populate resolves the set of cached resources that should be presented
-// This returns accumulated error detail if there is ambiguity, but sets all
-// unambiguous or correct resources.
-func (s *Session) Populate(ctx context.Context) (*Session, error) {
-	// Populate s
-	var errs []string
-	var err error
+// disconnect drops the client of a connection that failed
+func (s *Session) disconnect() {
+	if s.stopKeepalive != nil {
+		close(s.stopKeepalive)
+		s.stopKeepalive = nil
+	}
+	s.Client = nil
+	s.anonymous = false
 
-	finder := s.Finder
+	s.l.Lock()
+	s.kind = ServerUnknown
+	s.ServerCertificates = nil
+	s.l.Unlock()
+}
 
-	s.Datacenter, err = finder.DatacenterOrDefault(ctx, s.DatacenterPath)
-	if err != nil {
-		errs = append(errs, err.Error())
-	} else {
-		finder.SetDatacenter(s.Datacenter)
+// ConnectAnonymous connects to the first of the Config's services that it can,
+// as Connect does, but doesn't log in. The server's kind, version and
+// certificates can then be inspected, and the Config's credentials chosen
+// accordingly, before Authenticate logs in. Until then the client can only
+// retrieve the ServiceContent, and Finder is nil. A session that's logged in
+// must be logged out first, as its server session would otherwise be lost.
+func (s *Session) ConnectAnonymous(ctx context.Context) (*Session, error) {
+	s.l.RLock()
+	authenticated := s.Client != nil && !s.loggedOut && !s.anonymous
+	s.l.RUnlock()
+	if authenticated {
+		return nil, errors.New("Session is already logged in")
 	}
 
-	s.Cluster, err = finder.ComputeResourceOrDefault(ctx, s.ClusterPath)
-	if err != nil {
-		errs = append(errs, err.Error())
+	if err := s.Validate(); err != nil {
+		return nil, err
 	}
 
-	s.Datastore, err = finder.DatastoreOrDefault(ctx, s.DatastorePath)
-	if err != nil {
-		errs = append(errs, err.Error())
+	if _, err := s.rootCAs(); err != nil {
+		return nil, err
 	}
 
-	s.Host, err = finder.HostSystemOrDefault(ctx, s.HostPath)
-	if err != nil {
-		if _, ok := err.(*find.DefaultMultipleFoundError); !ok || !s.IsVC() {
-			errs = append(errs, err.Error())
+	services := s.candidates()
+
+	var errs []error
+	var msgs []string
+	for _, service := range services {
+		err := s.connectAnonymous(ctx, service)
+		if err == nil {
+			s.ActiveService = service
+			return s, nil
 		}
-	}
 
-	if s.NetworkPath != "" {
-		s.Network, err = finder.NetworkOrDefault(ctx, s.NetworkPath)
-		if err != nil {
-			errs = append(errs, err.Error())
+		if len(services) == 1 {
+			return nil, err
 		}
+		errs = append(errs, err)
+		msgs = append(msgs, err.Error())
 	}
 
-	s.Pool, err = finder.ResourcePoolOrDefault(ctx, s.PoolPath)
-	if err != nil {
-		errs = append(errs, err.Error())
+	return nil, &connectErrors{
+		msg:  "Failed to connect to any of the services:\n" + strings.Join(msgs, "\n"),
+		errs: errs,
 	}
+}
 
-	if len(errs) > 0 {
-		return nil, errors.New(strings.Join(errs, "\n"))
+// Authenticate logs in the client of ConnectAnonymous with the Config's
+// credentials, completing the connection as Connect would have. Should that
+// fail the session is left connected anonymously, so that Authenticate can be
+// tried again, perhaps with different credentials.
+func (s *Session) Authenticate(ctx context.Context) (*Session, error) {
+	if s.Client == nil || !s.anonymous {
+		return nil, errors.New("Session is not connected anonymously")
 	}
 
-	return s, nil
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	err := s.authenticate(ctx, s.ActiveService)
+	s.metrics().ObserveConnect(err)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.shareable() {
+		s.share(s.ActiveService)
+	}
+
+	s.l.Lock()
+	s.metered = true
+	s.l.Unlock()
+	s.metrics().AddActiveSessions(1)
+
+	return s, nil
+}
+
+// connectAnonymous creates a client for service without logging in, leaving no
+// client behind if it fails
+func (s *Session) connectAnonymous(ctx context.Context, service string) (err error) {
+	defer func() {
+		if err != nil {
+			s.disconnect()
+		}
+	}()
+
+	soapURL, err := parseService(service)
+	if soapURL == nil || err != nil {
+		// the parse error repeats the URL, so only its cause is reported
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return withKind(ErrURLParse, errors.Errorf("SDK URL (%s) could not be parsed: %s", redactService(service), err))
+	}
+
+	// we can't set a keep alive if we log in directly with client creation
+	soapURL.User = nil
+
+	// the chain is taken from the handshake
+	capture := &certCapture{}
+
+	// connect without any userinfo to get the API type
+	s.Client, err = s.dial(ctx, soapURL, nil, capture)
+	if err != nil {
+		return err
+	}
+	s.RoundTripper = s.wrapRoundTripper(s.Client.Client.Client)
+
+	s.l.Lock()
+	s.kind = serverKind(s.Client.ServiceContent.About)
+	s.ServerCertificates = capture.chain()
+	s.l.Unlock()
+
+	s.anonymous = true
+	s.loggedOut = false
+	s.stopKeepalive = nil
+	s.keepalive = nil
+
+	return nil
+}
+
+// authenticate logs in the anonymous client for service, replacing it with one
+// presenting the certificate if the Config has one. The anonymous client is
+// restored if it fails.
+func (s *Session) authenticate(ctx context.Context, service string) (err error) {
+	anonymous := s.Client
+	defer func() {
+		if err != nil {
+			if s.stopKeepalive != nil {
+				close(s.stopKeepalive)
+				s.stopKeepalive = nil
+			}
+			s.keepalive = nil
+			s.Client = anonymous
+			s.RoundTripper = s.wrapRoundTripper(anonymous.Client.Client)
+		}
+	}()
+
+	soapURL, err := parseService(service)
+	if soapURL == nil || err != nil {
+		// the parse error repeats the URL, so only its cause is reported
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return withKind(ErrURLParse, errors.Errorf("SDK URL (%s) could not be parsed: %s", redactService(service), err))
+	}
+
+	user := soapURL.User
+	soapURL.User = nil
+
+	if s.HasCertificate() {
+		if !s.Client.IsVC() {
+			return ErrCertAuthUnsupportedOnESXi
+		}
+
+		// load the certificates
+		cert, err2 := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err2 != nil {
+			return withKind(ErrCertLoad, errors.Errorf("Unable to load X509 key pair(%s,%s): %s", s.CertFile, s.KeyFile, err2))
+		}
+
+		// create the new client
+		capture := &certCapture{}
+		s.Client, err = s.dial(ctx, soapURL, &cert, capture)
+		if err != nil {
+			return err
+		}
+
+		if certs := capture.chain(); len(certs) > 0 {
+			s.l.Lock()
+			s.ServerCertificates = certs
+			s.l.Unlock()
+		}
+	}
+
+	if (s.Token != "" || s.STSIssueToken) && !s.Client.IsVC() {
+		return ErrTokenAuthUnsupportedOnESXi
+	}
+
+	// the round tripper is rebuilt from the soap client
+	s.RoundTripper = s.Client.Client.Client
+	s.stopKeepalive = nil
+	s.keepalive = nil
+	if s.Keepalive != 0 {
+		// now that we've verified everything, enable keepalive
+		s.stopKeepalive = make(chan struct{})
+		s.keepalive = &connection{}
+		s.RoundTripper = session.KeepAliveHandler(s.Client.RoundTripper, s.Keepalive, keepAlive(s.stopKeepalive, s.keepalive, s.Client.ServiceContent, s.KeepaliveHandler))
+	}
+	if !s.stickySession() {
+		s.owner = &clientOwner{s: s}
+		s.RoundTripper = reauth{RoundTripper: s.RoundTripper, owner: s.owner}
+	}
+	s.RoundTripper = s.wrapRoundTripper(s.RoundTripper)
+
+	// reuse a cached session if the server still considers it active
+	if s.SessionCacheFile == "" || !s.restoreSession(ctx, soapURL, user) {
+		// and now that the keepalive is registered we can log in to trigger it
+		if err = s.login(ctx, s.Client, user); err != nil {
+			return withKind(ErrLoginFailed, errors.Errorf("Failed to log in to %s: %w", redactURL(soapURL), err))
+		}
+
+		if !s.stickySession() {
+			if err = s.confirmLogin(ctx, s.Client, user); err != nil {
+				return withKind(ErrLoginFailed, errors.Errorf("Failed to log in to %s: %w", redactURL(soapURL), err))
+			}
+		}
+
+		if s.SessionCacheFile != "" {
+			// failing to cache the session doesn't affect this one
+			if err2 := s.saveSession(soapURL, user); err2 != nil {
+				log.Warnf("Unable to cache session in %s: %s", s.SessionCacheFile, err2)
+			}
+		}
+	}
+
+	s.anonymous = false
+	s.Finder = find.NewFinder(s.Vim25(), s.finderAll())
+
+	// drop anything cached from a previous client
+	s.caps.Lock()
+	s.isVC = nil
+	s.isVSAN = nil
+	s.caps.Unlock()
+
+	return nil
+}
+
+// wrapRoundTripper applies the read only check, if ReadOnly, and then
+// RoundTripperWrapper, if set, to rt
+func (s *Session) wrapRoundTripper(rt soap.RoundTripper) soap.RoundTripper {
+	if s.ReadOnly {
+		rt = readOnly{rt}
+	}
+
+	if s.RoundTripperWrapper == nil {
+		return rt
+	}
+	return s.RoundTripperWrapper(rt)
+}
+
+// dial creates a client for u, retrying up to ConnectRetries times should that
+// fail transiently. The arguments are those of newClient.
+func (s *Session) dial(ctx context.Context, u *url.URL, cert *tls.Certificate, capture *certCapture) (*govmomi.Client, error) {
+	for attempt := 0; ; attempt++ {
+		client, transient, err := s.dialOnce(ctx, u, cert, capture)
+		if err == nil || !transient || attempt >= s.ConnectRetries {
+			return client, err
+		}
+
+		log.Debugf("Retrying connection: %s", err)
+
+		select {
+		case <-time.After(s.connectRetryDelay(attempt)):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+// dialOnce creates a client for u within ConnectTimeout, if set, distinguishing
+// a connection that timed out from one that failed, and returning whether the
+// failure may be transient
+func (s *Session) dialOnce(ctx context.Context, u *url.URL, cert *tls.Certificate, capture *certCapture) (*govmomi.Client, bool, error) {
+	dctx := ctx
+	if s.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		dctx, cancel = context.WithTimeout(ctx, s.ConnectTimeout)
+		defer cancel()
+	}
+
+	client, err := s.newClient(dctx, u, cert, capture)
+	if err != nil {
+		// only our own deadline counts, the caller's is reported as any other failure
+		if dctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			return nil, true, errors.Errorf("Timed out connecting to %s after %s", redactURL(u), s.ConnectTimeout)
+		}
+		return nil, ctx.Err() == nil && isTransient(err), errors.Errorf("Failed to connect to %s: %s", redactURL(u), err)
+	}
+	return client, false, nil
+}
+
+// login authenticates client with the session ticket, token, certificate or
+// credentials in user, whichever the Config selects
+func (s *Session) login(ctx context.Context, client *govmomi.Client, user *url.Userinfo) error {
+	ctx = context.WithValue(ctx, reloginKey{}, true)
+
+	return s.bounded(ctx, "login", func(ctx context.Context) error {
+		switch {
+		case s.SessionTicket != "":
+			return s.cloneSession(ctx, client)
+		case s.Token != "":
+			return s.loginByToken(ctx, client, s.Token)
+		case s.STSIssueToken:
+			token, err := s.stsToken(ctx, client, user)
+			if err != nil {
+				return err
+			}
+			return s.loginByToken(ctx, client, token)
+		case s.HasCertificate():
+			return client.SessionManager.LoginExtensionByCertificate(ctx, user.Username(), "")
+		default:
+			return client.Login(ctx, user)
+		}
+	})
+}
+
+// connection records whether the latest keepalive request succeeded
+type connection struct {
+	// lost is set atomically, as the keepalive goroutine writes it
+	lost int32
+}
+
+func (c *connection) set(connected bool) {
+	var lost int32
+	if !connected {
+		lost = 1
+	}
+	atomic.StoreInt32(&c.lost, lost)
+}
+
+func (c *connection) connected() bool {
+	return atomic.LoadInt32(&c.lost) == 0
+}
+
+// keepAlive returns a keepalive handler that pings the server until stop is closed,
+// recording the outcome in conn and passing any failure to handler if not nil. The
+// returned function never returns an error as the vendored keepalive loop cannot
+// stop itself cleanly, so once stopped, whether by stop or handler, it simply idles.
+//
+// The ping retrieves the current session of the session manager in content, as an
+// unauthenticated request such as CurrentTime would succeed even once the session
+// has expired. A session the server no longer knows fails with ErrSessionExpired.
+func keepAlive(stop chan struct{}, conn *connection, content types.ServiceContent, handler func(error) error) func(soap.RoundTripper) error {
+	// only ever accessed from the keepalive goroutine
+	stopped := false
+
+	return func(rt soap.RoundTripper) error {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		if stopped {
+			return nil
+		}
+
+		err := currentSession(context.Background(), rt, content)
+		conn.set(err == nil)
+		if err != nil && handler != nil && handler(err) != nil {
+			stopped = true
+		}
+		return nil
+	}
+}
+
+// currentSession checks with rt that the server still has an authenticated session,
+// returning ErrSessionExpired if the session manager in content reports none
+func currentSession(ctx context.Context, rt soap.RoundTripper, content types.ServiceContent) error {
+	if content.SessionManager == nil {
+		return ErrSessionExpired
+	}
+
+	// UserSession returns a nil session when we're no longer authenticated
+	us, err := session.NewManager(&vim25.Client{RoundTripper: rt, ServiceContent: content}).UserSession(ctx)
+	if err != nil {
+		return err
+	}
+	if us == nil {
+		return ErrSessionExpired
+	}
+	return nil
+}
+
+// Logout ends the server session, stops the keepalive if one was installed, and
+// releases the Finder and cached resources, which would otherwise fail with
+// confusing faults from the dead client. This applies equally to sessions that
+// logged in by certificate, as the extension session is torn down by the same
+// request. Only the first call has any effect, subsequent calls return nil.
+func (s *Session) Logout(ctx context.Context) error {
+	s.l.Lock()
+	if s.loggedOut || s.Client == nil {
+		s.l.Unlock()
+		return nil
+	}
+
+	s.loggedOut = true
+	anonymous := s.anonymous
+	s.anonymous = false
+	metered := s.metered
+	s.metered = false
+	client := s.Client
+	stop := s.stopKeepalive
+	s.stopKeepalive = nil
+	s.keepalive = nil
+	shared := s.shared
+	s.shared = nil
+	s.copyResources(&Session{})
+	s.l.Unlock()
+
+	if metered {
+		s.metrics().AddActiveSessions(-1)
+	}
+
+	if anonymous {
+		// never logged in, so there's nothing to end
+		return nil
+	}
+
+	s.logoutRest(ctx)
+
+	if shared != nil {
+		if !sharedClients.release(shared) {
+			// other sessions are still using the client
+			return nil
+		}
+		stop = shared.stop
+	}
+
+	// a successful logout passes through the keepalive round tripper, stopping it
+	err := client.Logout(ctx)
+
+	if stop != nil {
+		// silence the keepalive even if the logout didn't make it to the server
+		close(stop)
+
+		// and uninstall the keepalive round tripper, leaving the plain soap client
+		client.RoundTripper = s.wrapRoundTripper(client.Client.Client)
+	}
+
+	return err
+}
+
+// newClient creates a client for u without logging in, presenting cert to the
+// server if not nil, and recording the server's certificates in capture if not
+// nil. This is the equivalent of govmomi.NewClient and NewClientWithCertificate
+// but with the transport configured from Config.
+func (s *Session) newClient(ctx context.Context, u *url.URL, cert *tls.Certificate, capture *certCapture) (*govmomi.Client, error) {
+	sc := soap.NewClient(u, s.Insecure)
+	if s.VimNamespace != "" {
+		sc.Namespace = s.VimNamespace
+	}
+	if s.VimVersion != "" {
+		sc.Version = s.VimVersion
+	}
+	if cert != nil {
+		sc.SetCertificate(*cert)
+	}
+
+	if err := s.configureTLS(sc); err != nil {
+		return nil, err
+	}
+
+	if capture != nil {
+		captureCertificates(sc, capture)
+	}
+
+	if err := s.configureProxy(sc); err != nil {
+		return nil, err
+	}
+
+	s.configureDial(sc)
+	s.configureUserAgent(sc)
+	s.configureDebug(sc)
+
+	vc, err := vim25.NewClient(ctx, sc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkVimVersion(vc.ServiceContent.About); err != nil {
+		return nil, err
+	}
+
+	return &govmomi.Client{
+		Client:         vc,
+		SessionManager: session.NewManager(vc),
+	}, nil
+}
+
+// Populate resolves the set of cached resources that should be presented
+// This returns accumulated error detail if there is ambiguity, but sets all
+// unambiguous or correct resources. The error is a *PopulateError, so the
+// resources that failed can be inspected. Resources without a path in the
+// Config are left unset unless RequireAll is set. A session that has been
+// logged out has no finder to resolve them with, and fails with ErrSessionExpired.
+func (s *Session) Populate(ctx context.Context) (*Session, error) {
+	start := time.Now()
+	perr := &PopulateError{}
+
+	// resolve into a scratch session that is swapped in once complete, so that
+	// readers never see a half populated session. The finder is copied for the
+	// same reason as it's rescoped to the datacenter below. Unless the session's
+	// finder is to be scoped too it keeps a copy of its own.
+	s.l.RLock()
+	if s.Finder == nil {
+		s.l.RUnlock()
+		return nil, ErrSessionExpired
+	}
+	scoped := *s.Finder
+	finder := &scoped
+	r := &Session{
+		Client: s.Client,
+		Config: s.Config,
+		Finder: finder,
+	}
+	if !s.scopeFinder() {
+		global := *s.Finder
+		r.Finder = &global
+	}
+	s.l.RUnlock()
+
+	if s.DefaultDatacenter != "" {
+		if err := s.NormalizePaths(); err != nil {
+			perr.add("paths", err)
+			s.metrics().ObservePopulate(time.Since(start), perr)
+			return nil, perr
+		}
+	}
+
+	// each lookup is retried should the session have expired since Connect
+	lookup := func(op string, fn func(context.Context) error) error {
+		return s.WithRetry(ctx, func(ctx context.Context) error {
+			return s.bounded(ctx, op, fn)
+		})
+	}
+
+	// resources without a path are skipped unless the defaults are required
+	wanted := func(path string) bool {
+		return path != "" || s.RequireAll
+	}
+
+	resolvers := s.moRefResolvers(s.resolvers())
+
+	// the datacenter scopes the finder for the other paths, so the default is
+	// resolved whenever any of them is set
+	if wanted(s.DatacenterPath) || s.scopedPaths() || resolvers.DatacenterResolver != nil {
+		err := lookup("datacenter lookup", func(ctx context.Context) (err error) {
+			if resolvers.DatacenterResolver != nil {
+				r.Datacenter, err = resolvers.DatacenterResolver(ctx, finder)
+				return
+			}
+			r.Datacenter, err = finder.DatacenterOrDefault(ctx, s.DatacenterPath)
+			return
+		})
+		if err != nil {
+			perr.add("datacenter", err)
+		} else if r.Datacenter != nil {
+			finder.SetDatacenter(r.Datacenter)
+		}
+	}
+
+	// the remaining resources are scoped to the datacenter so can be resolved
+	// concurrently now that it's set. Errors are collected by position so that
+	// they're reported in a deterministic order.
+	lookups := []struct {
+		kind string
+		fn   func(*find.Finder) error
+	}{
+		{"cluster", func(finder *find.Finder) error {
+			if resolvers.ClusterResolver != nil {
+				return lookup("cluster lookup", func(ctx context.Context) (err error) {
+					r.Cluster, err = resolvers.ClusterResolver(ctx, finder)
+					return
+				})
+			}
+			if !wanted(s.ClusterPath) {
+				return nil
+			}
+			return lookup("cluster lookup", func(ctx context.Context) (err error) {
+				r.Cluster, err = finder.ComputeResourceOrDefault(ctx, s.ClusterPath)
+				return
+			})
+		}},
+		{"datastore", func(finder *find.Finder) error {
+			if resolvers.DatastoreResolver != nil {
+				err := lookup("datastore lookup", func(ctx context.Context) (err error) {
+					r.Datastore, err = resolvers.DatastoreResolver(ctx, finder)
+					return
+				})
+				if err == nil && r.Datastore != nil {
+					r.Datastores = []*object.Datastore{r.Datastore}
+				}
+				return err
+			}
+
+			if len(s.DatastorePaths) == 0 {
+				if !wanted(s.DatastorePath) {
+					return nil
+				}
+
+				err := lookup("datastore lookup", func(ctx context.Context) (err error) {
+					r.Datastore, err = finder.DatastoreOrDefault(ctx, s.DatastorePath)
+					return
+				})
+				if err == nil {
+					r.Datastores = []*object.Datastore{r.Datastore}
+				}
+				return err
+			}
+
+			var errs []string
+			r.Datastores = nil
+			for _, path := range s.DatastorePaths {
+				var ds *object.Datastore
+				err := lookup("datastore lookup", func(ctx context.Context) (err error) {
+					ds, err = s.datastoreByPath(ctx, finder, path)
+					return
+				})
+				if err != nil {
+					errs = append(errs, err.Error())
+					continue
+				}
+				r.Datastores = append(r.Datastores, ds)
+			}
+
+			// Datastore is the first of Datastores for those who only care about one
+			if len(r.Datastores) > 0 {
+				r.Datastore = r.Datastores[0]
+			}
+
+			if len(errs) > 0 {
+				return errors.New(strings.Join(errs, "\n"))
+			}
+			return nil
+		}},
+		{"host", func(finder *find.Finder) error {
+			if resolvers.HostResolver != nil {
+				return lookup("host lookup", func(ctx context.Context) (err error) {
+					r.Host, err = resolvers.HostResolver(ctx, finder)
+					return
+				})
+			}
+			if !wanted(s.HostPath) {
+				return nil
+			}
+			err := lookup("host lookup", func(ctx context.Context) (err error) {
+				r.Host, err = finder.HostSystemOrDefault(ctx, s.HostPath)
+				return
+			})
+			if isDefaultMultipleFound(err) && s.IsVC() {
+				// multiple hosts are expected on VC, leave it to the caller to choose
+				return nil
+			}
+			return err
+		}},
+		{"network", func(finder *find.Finder) error {
+			if resolvers.NetworkResolver != nil {
+				err := lookup("network lookup", func(ctx context.Context) (err error) {
+					r.Network, err = resolvers.NetworkResolver(ctx, finder)
+					return
+				})
+				if err == nil && r.Network != nil {
+					r.Networks = []object.NetworkReference{r.Network}
+				}
+				return err
+			}
+
+			if len(s.NetworkPaths) == 0 {
+				if s.NetworkPath == "" {
+					return nil
+				}
+
+				err := lookup("network lookup", func(ctx context.Context) (err error) {
+					r.Network, err = finder.NetworkOrDefault(ctx, s.NetworkPath)
+					return
+				})
+				if err == nil {
+					r.Networks = []object.NetworkReference{r.Network}
+				}
+				return err
+			}
+
+			var errs []string
+			r.Networks = nil
+			for _, path := range s.NetworkPaths {
+				var network object.NetworkReference
+				err := lookup("network lookup", func(ctx context.Context) (err error) {
+					network, err = s.networkByPath(ctx, finder, path)
+					return
+				})
+				if err != nil {
+					errs = append(errs, err.Error())
+					continue
+				}
+				r.Networks = append(r.Networks, network)
+			}
+
+			// Network is the first of Networks for those who only care about one
+			if len(r.Networks) > 0 {
+				r.Network = r.Networks[0]
+			}
+
+			if len(errs) > 0 {
+				return errors.New(strings.Join(errs, "\n"))
+			}
+			return nil
+		}},
+		{"pool", func(finder *find.Finder) error {
+			if resolvers.PoolResolver != nil {
+				return lookup("resource pool lookup", func(ctx context.Context) (err error) {
+					r.Pool, err = resolvers.PoolResolver(ctx, finder)
+					return
+				})
+			}
+			if !wanted(s.PoolPath) {
+				return nil
+			}
+			return lookup("resource pool lookup", func(ctx context.Context) (err error) {
+				r.Pool, err = finder.ResourcePoolOrDefault(ctx, s.PoolPath)
+				return
+			})
+		}},
+		{"folder", func(finder *find.Finder) error {
+			if resolvers.FolderResolver != nil {
+				return lookup("folder lookup", func(ctx context.Context) (err error) {
+					r.VMFolder, err = resolvers.FolderResolver(ctx, finder)
+					return
+				})
+			}
+			if !wanted(s.FolderPath) {
+				return nil
+			}
+			return lookup("folder lookup", func(ctx context.Context) (err error) {
+				r.VMFolder, err = finder.FolderOrDefault(ctx, s.FolderPath)
+				return
+			})
+		}},
+		{"dvs", func(finder *find.Finder) error {
+			if s.DVSPath == "" {
+				return nil
+			}
+			return lookup("dvs lookup", func(ctx context.Context) (err error) {
+				r.DVS, err = findDVS(ctx, finder, s.DVSPath)
+				return
+			})
+		}},
+		{"storage pod", func(finder *find.Finder) error {
+			if s.StoragePodPath == "" {
+				return nil
+			}
+			return lookup("storage pod lookup", func(ctx context.Context) (err error) {
+				r.StoragePod, err = finder.DatastoreClusterOrDefault(ctx, s.StoragePodPath)
+				return
+			})
+		}},
+		{"vapp", func(finder *find.Finder) error {
+			if s.VirtualAppPath == "" {
+				return nil
+			}
+			return lookup("vapp lookup", func(ctx context.Context) (err error) {
+				r.VirtualApp, err = finder.VirtualApp(ctx, s.VirtualAppPath)
+				return
+			})
+		}},
+	}
+
+	if r.Datacenter != nil {
+		// the finder caches the datacenter folders on first use, so prime that here
+		// rather than have the lookups race to do it. Any failure will resurface below.
+		lookup("folder lookup", func(ctx context.Context) error {
+			_, err := finder.DefaultFolder(ctx)
+			return err
+		})
+	}
+
+	results := make([]error, len(lookups))
+	var wg sync.WaitGroup
+	for i := range lookups {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			// each lookup gets its own copy of the finder as it isn't safe for concurrent use
+			f := *finder
+			results[i] = lookups[i].fn(&f)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range results {
+		if err == nil {
+			continue
+		}
+
+		if s.TolerateAmbiguous && isDefaultMultipleFound(err) {
+			log.Debugf("Leaving %s unset as the default is ambiguous: %s", lookups[i].kind, err)
+			continue
+		}
+		perr.add(lookups[i].kind, err)
+	}
+
+	r.refreshCapabilities(ctx)
+	s.swapResources(r)
+
+	if len(perr.Failures) > 0 {
+		s.metrics().ObservePopulate(time.Since(start), perr)
+		return nil, perr
+	}
+
+	s.metrics().ObservePopulate(time.Since(start), nil)
+	return s, nil
+}
+
+// Valid returns whether the session is connected and hasn't been logged out, so
+// that its client and cached resources are usable. The server isn't contacted,
+// so a session that has expired server side is still valid; use Ping for that.
+func (s *Session) Valid() bool {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.Client != nil && s.Finder != nil && !s.loggedOut
+}
+
+// Refresh re-resolves the cached resources, picking up changes to the
+// inventory since they were last resolved, and replaces them atomically. The
+// connection is left as is, so a session that has expired should be
+// reconnected instead. Any error is a *PopulateError, as with Populate.
+func (s *Session) Refresh(ctx context.Context) error {
+	if !s.Valid() {
+		return ErrSessionExpired
+	}
+
+	_, err := s.Populate(ctx)
+	return err
+}
+
+// Datacenters returns every datacenter visible to the session, leaving the
+// cached Datacenter as is. The result is empty rather than nil if there are none.
+func (s *Session) Datacenters(ctx context.Context) ([]*object.Datacenter, error) {
+	finder := s.GetFinder()
+	if finder == nil {
+		return nil, ErrSessionExpired
+	}
+
+	// the finder isn't safe for concurrent use, so work on a copy
+	f := *finder
+
+	var dcs []*object.Datacenter
+	err := s.bounded(ctx, "datacenter list", func(ctx context.Context) (err error) {
+		dcs, err = f.DatacenterList(ctx, "*")
+		return
+	})
+	if _, ok := err.(*find.NotFoundError); ok {
+		return []*object.Datacenter{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dcs, nil
+}
+
+// Hosts returns the cached Host if one was resolved, otherwise the hosts of the
+// cached Cluster, or failing that those of the compute resources anywhere in
+// the cached Datacenter's host folder, nested folders included. The latter is
+// needed on VC where Populate leaves Host unset if there are several to choose
+// from. The result is empty rather than nil if there are none.
+func (s *Session) Hosts(ctx context.Context) ([]*object.HostSystem, error) {
+	if host := s.GetHost(); host != nil {
+		return []*object.HostSystem{host}, nil
+	}
+
+	var hosts []*object.HostSystem
+	if cluster := s.GetCluster(); cluster != nil {
+		err := s.bounded(ctx, "host list", func(ctx context.Context) (err error) {
+			hosts, err = cluster.Hosts(ctx)
+			return
+		})
+		return hosts, err
+	}
+
+	dc := s.GetDatacenter()
+	if dc == nil {
+		return nil, errors.New("Neither a host, cluster nor datacenter is cached in this session")
+	}
+
+	hosts = []*object.HostSystem{}
+	err := s.bounded(ctx, "host list", func(ctx context.Context) error {
+		crs, err := s.computeResources(ctx, dc)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range crs {
+			cr := object.NewComputeResource(dc.Client(), e.Object.Reference())
+			cr.InventoryPath = e.Path
+
+			found, err := cr.Hosts(ctx)
+			if err != nil {
+				return err
+			}
+			hosts = append(hosts, found...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// computeResources returns the compute resources, clusters included, in the host
+// folder of dc and the folders beneath it, with their inventory paths set. The
+// finder's patterns only match a single level of the tree, so the folders are
+// listed one at a time instead, in a round trip each.
+func (s *Session) computeResources(ctx context.Context, dc *object.Datacenter) ([]list.Element, error) {
+	pc := s.PropertyCollector()
+	if pc == nil {
+		return nil, ErrSessionExpired
+	}
+
+	folders, err := dc.Folders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var crs []list.Element
+	pending := []list.Lister{{Collector: pc, Reference: folders.HostFolder.Reference(), Prefix: folders.HostFolder.InventoryPath}}
+	for len(pending) > 0 {
+		l := pending[0]
+		pending = pending[1:]
+
+		es, err := l.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range es {
+			switch e.Object.(type) {
+			case mo.Folder:
+				pending = append(pending, list.Lister{Collector: pc, Reference: e.Object.Reference(), Prefix: e.Path})
+			case mo.ComputeResource, mo.ClusterComputeResource:
+				crs = append(crs, e)
+			}
+		}
+	}
+	return crs, nil
+}
+
+// Clusters returns the clusters anywhere in the cached Datacenter's host folder,
+// nested folders included, and if standalone is set the compute resources of
+// standalone hosts alongside them. Each keeps the reference type it has on the
+// server, so clusters are those of type ClusterComputeResource, which can be
+// wrapped with object.NewClusterComputeResource for the cluster methods. The
+// result is empty rather than nil if there are none.
+func (s *Session) Clusters(ctx context.Context, standalone bool) ([]*object.ComputeResource, error) {
+	dc := s.GetDatacenter()
+	if dc == nil {
+		return nil, errors.New("No datacenter is cached in this session")
+	}
+
+	clusters := []*object.ComputeResource{}
+	err := s.bounded(ctx, "cluster list", func(ctx context.Context) error {
+		crs, err := s.computeResources(ctx, dc)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range crs {
+			if _, ok := e.Object.(mo.ClusterComputeResource); !ok && !standalone {
+				continue
+			}
+
+			cr := object.NewComputeResource(dc.Client(), e.Object.Reference())
+			cr.InventoryPath = e.Path
+			clusters = append(clusters, cr)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clusters, nil
+}
+
+// NetworkByName returns the cached network with the given name
+func (s *Session) NetworkByName(name string) (object.NetworkReference, error) {
+	for _, network := range s.GetNetworks() {
+		if n, ok := network.(interface {
+			Name() string
+		}); ok && n.Name() == name {
+			return network, nil
+		}
+	}
+
+	return nil, errors.Errorf("Network %s is not cached in this session", name)
+}
+
+// DatastoreByName returns the cached datastore with the given name
+func (s *Session) DatastoreByName(name string) (*object.Datastore, error) {
+	for _, ds := range s.GetDatastores() {
+		if ds.Name() == name {
+			return ds, nil
+		}
+	}
+
+	return nil, errors.Errorf("Datastore %s is not cached in this session", name)
+}
+
+// ResourcePoolOrVApp returns the resource pool to place workloads in: that of
+// the cached vApp if there is one, otherwise the cached pool
+func (s *Session) ResourcePoolOrVApp() *object.ResourcePool {
+	if vapp := s.GetVirtualApp(); vapp != nil {
+		return vapp.ResourcePool
+	}
+	return s.GetPool()
+}
+
+// VMFolderOrRoot returns the cached VM folder if FolderPath was specified, otherwise
+// the VM folder of the cached datacenter
+func (s *Session) VMFolderOrRoot(ctx context.Context) (*object.Folder, error) {
+	if folder := s.GetVMFolder(); s.FolderPath != "" && folder != nil {
+		return folder, nil
+	}
+
+	folders, err := s.DatacenterFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return folders.VmFolder, nil
+}
+
+// DatacenterFolders returns the standard folders of the cached Datacenter. They
+// are fetched on first use and cached until the resources are next resolved,
+// as by Refresh.
+func (s *Session) DatacenterFolders(ctx context.Context) (*object.DatacenterFolders, error) {
+	s.l.RLock()
+	dc := s.Datacenter
+	folders := s.folders
+	foldersDC := s.foldersDC
+	s.l.RUnlock()
+
+	if dc == nil {
+		return nil, errors.New("No datacenter is cached in this session")
+	}
+
+	// the datacenter may have been replaced directly
+	if folders != nil && foldersDC == dc {
+		return folders, nil
+	}
+
+	err := s.bounded(ctx, "datacenter folders lookup", func(ctx context.Context) (err error) {
+		folders, err = dc.Folders(ctx)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.l.Lock()
+	// unless the resources were resolved again meanwhile
+	if s.Datacenter == dc {
+		s.folders = folders
+		s.foldersDC = dc
+	}
+	s.l.Unlock()
+
+	return folders, nil
+}
+
+// Clone returns a new Session populated according to config, that shares the
+// authenticated client of s rather than logging in again. The clone has its own
+// Finder and cached resources, leaving s untouched, but shares the server
+// session: logging out of either ends it for both. As the client is reused,
+// config must specify the same Service and credentials as the original.
+func (s *Session) Clone(ctx context.Context, config *Config) (*Session, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Service != s.Service || config.CertFile != s.CertFile || config.KeyFile != s.KeyFile {
+		return nil, errors.New("Cannot clone a session with a different service or credentials")
+	}
+
+	client := s.client()
+	if client == nil {
+		return nil, errors.New("Cannot clone a session that is not connected")
+	}
+
+	clone := &Session{
+		Client: client,
+		Config: config,
+		Finder: find.NewFinder(client.Client, config.finderAll()),
+	}
+
+	return clone.Populate(ctx)
+}
+
+// WithDatacenter returns a shallow copy of s whose Finder is scoped to dc, for
+// lookups in a datacenter other than the cached one. The copy shares the
+// client, Config and server session with s, and its cached resources are the
+// very same pointers as those of s, which still belong to the original
+// datacenter, bar Datacenter which is dc. Only the Finder is its own, and s is
+// left untouched. Logging out of the copy ends the server session for both.
+func (s *Session) WithDatacenter(ctx context.Context, dc *object.Datacenter) *Session {
+	s.l.RLock()
+	c := &Session{
+		Client:             s.Client,
+		Config:             s.Config,
+		ActiveService:      s.ActiveService,
+		ServerCertificates: s.ServerCertificates,
+		kind:               s.kind,
+	}
+	c.copyResources(s)
+	s.l.RUnlock()
+
+	c.copyCaps(s)
+
+	if c.Finder != nil {
+		f := *c.Finder
+		c.Finder = &f
+	} else if c.Client != nil {
+		c.Finder = find.NewFinder(c.Client.Client, c.finderAll())
+	}
+
+	if c.Finder != nil {
+		c.Finder.SetDatacenter(dc)
+	}
+	c.Datacenter = dc
+
+	return c
+}
+
+// bounded invokes fn with a context limited by OperationTimeout, if one is set.
+// Should that deadline expire the returned error names the operation that timed out.
+func (s *Session) bounded(ctx context.Context, op string, fn func(context.Context) error) error {
+	if s.OperationTimeout <= 0 {
+		return fn(ctx)
+	}
+
+	octx, cancel := context.WithTimeout(ctx, s.OperationTimeout)
+	defer cancel()
+
+	err := fn(octx)
+	// only claim the timeout as ours if the caller's context is still live
+	if err != nil && octx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return errors.Errorf("%s exceeded %s", op, s.OperationTimeout)
+	}
+	return err
+}
+
+// Reconnect re-establishes the connection to Service if the SOAP session is no
+// longer usable, using the original Config, and re-populates the cached resources.
+// Failed attempts are retried with exponential backoff. Concurrent callers share
+// a single in-flight reconnection rather than each opening a new client.
+func (s *Session) Reconnect(ctx context.Context) (*Session, error) {
+	s.rl.Lock()
+	if c := s.reconnecting; c != nil {
+		s.rl.Unlock()
+
+		c.wg.Wait()
+		if c.err != nil {
+			return nil, c.err
+		}
+		return s, nil
+	}
+
+	c := &reconnectCall{}
+	c.wg.Add(1)
+	s.reconnecting = c
+	s.rl.Unlock()
+
+	c.err = s.reconnect(ctx)
+
+	s.rl.Lock()
+	s.reconnecting = nil
+	s.rl.Unlock()
+	c.wg.Done()
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	return s, nil
+}
+
+func (s *Session) reconnect(ctx context.Context) error {
+	if s.active(ctx) {
+		return nil
+	}
+
+	var err error
+	attempts := s.reconnectAttempts()
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(s.reconnectDelay(attempt - 1)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		// build the replacement off to the side so readers never see a partial session
+		fresh := NewSession(s.Config)
+
+		// retry the service we were using first, then fall through the rest
+		s.l.RLock()
+		fresh.ActiveService = s.ActiveService
+		fresh.issued = s.issued
+		s.l.RUnlock()
+
+		if _, err = fresh.Create(ctx); err == nil {
+			s.swap(ctx, fresh)
+			return nil
+		}
+	}
+
+	return errors.Errorf("Failed to reconnect after %d attempts: %s", attempts, err)
+}
+
+// active returns whether the session still holds an authenticated SOAP session
+func (s *Session) active(ctx context.Context) bool {
+	return s.Ping(ctx) == nil
+}
+
+// Ping checks that the server session is still valid with a single round trip,
+// returning ErrSessionExpired if it is not. Sessions with StickySession false log
+// in again instead should the server reject the request as NotAuthenticated.
+func (s *Session) Ping(ctx context.Context) error {
+	_, err := s.UserSession(ctx)
+	return err
+}
+
+// IsConnected returns whether the session is connected as far as is known without
+// a round trip to the server, for polling by health checks. It is false before
+// Connect and after Logout, and while the latest request of the keepalive, if
+// Keepalive is set, has failed. It turns true again once a keepalive request
+// succeeds or Reconnect replaces the client. Use Ping to check with the server.
+func (s *Session) IsConnected() bool {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	if s.Client == nil || s.loggedOut {
+		return false
+	}
+	return s.keepalive == nil || s.keepalive.connected()
+}
+
+// UserSession returns the server's view of the current session, including the
+// authenticated principal and login time. ErrSessionExpired is returned if no
+// session is active, other than for sessions with StickySession false, which
+// log in again should the server reject the request as NotAuthenticated.
+func (s *Session) UserSession(ctx context.Context) (*types.UserSession, error) {
+	client := s.client()
+	if client == nil {
+		return nil, ErrSessionExpired
+	}
+
+	// UserSession returns a nil session when we're no longer authenticated
+	us, err := client.SessionManager.UserSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if us == nil {
+		return nil, ErrSessionExpired
+	}
+	return us, nil
+}
+
+// swap replaces the client and cached resources with those of fresh while
+// holding the write lock
+func (s *Session) swap(ctx context.Context, fresh *Session) {
+	s.l.Lock()
+	// the replaced connection no longer counts as an active session
+	replaced := s.metered
+	old, stop := s.Client, s.stopKeepalive
+	owned := !s.loggedOut && !s.anonymous
+	s.Client = fresh.Client
+	s.ActiveService = fresh.ActiveService
+	s.ServerCertificates = fresh.ServerCertificates
+	s.kind = fresh.kind
+	s.loggedOut = fresh.loggedOut
+	s.anonymous = fresh.anonymous
+	s.stopKeepalive = fresh.stopKeepalive
+	s.keepalive = fresh.keepalive
+	s.metered = fresh.metered
+	if fresh.owner != nil {
+		fresh.owner.set(s)
+	}
+	s.owner = fresh.owner
+	shared := s.shared
+	s.shared = fresh.shared
+	s.copyResources(fresh)
+	s.l.Unlock()
+
+	s.copyCaps(fresh)
+
+	if shared != nil {
+		// the keepalive belongs to the shared client, stopped with its last reference
+		s.releaseShared(shared)
+	} else {
+		if owned && old != nil && old != fresh.Client {
+			s.retire(ctx, old)
+		}
+		if stop != nil {
+			close(stop)
+		}
+	}
+
+	if old != fresh.Client {
+		s.retireRest(ctx, old)
+	}
+
+	if replaced {
+		s.metrics().AddActiveSessions(-1)
+	}
+}
+
+// retire logs out of client, replaced by a new connection. The client has
+// usually expired, so this is best effort and mustn't log in again to do it.
+// Clients wrapped without a session manager have nothing to log out of.
+func (s *Session) retire(ctx context.Context, client *govmomi.Client) {
+	if client.SessionManager == nil {
+		return
+	}
+
+	ctx = context.WithValue(ctx, reloginKey{}, true)
+	err := s.bounded(ctx, "logout", func(ctx context.Context) error {
+		return client.Logout(ctx)
+	})
+	if err != nil {
+		log.Debugf("Failed to log out of the replaced session: %s", err)
+	}
+}
+
+// swapResources replaces the cached resources with those of fresh while
+// holding the write lock, leaving the connection as is
+func (s *Session) swapResources(fresh *Session) {
+	s.l.Lock()
+	s.copyResources(fresh)
+	s.l.Unlock()
+
+	s.copyCaps(fresh)
+}
+
+// copyResources copies the cached resources and finder from fresh, and must
+// be called with the write lock held
+func (s *Session) copyResources(fresh *Session) {
+	s.Cluster = fresh.Cluster
+	s.Datacenter = fresh.Datacenter
+	s.Datastore = fresh.Datastore
+	s.Datastores = fresh.Datastores
+	s.Host = fresh.Host
+	s.Network = fresh.Network
+	s.Networks = fresh.Networks
+	s.Pool = fresh.Pool
+	s.VMFolder = fresh.VMFolder
+	s.DVS = fresh.DVS
+	s.StoragePod = fresh.StoragePod
+	s.VirtualApp = fresh.VirtualApp
+
+	s.Finder = fresh.Finder
+
+	// the folders are fetched again for whichever datacenter was resolved
+	s.folders = nil
+	s.foldersDC = nil
+}
+
+// copyCaps copies the cached capabilities from fresh. caps is never taken
+// while holding l, so this must be called without it.
+func (s *Session) copyCaps(fresh *Session) {
+	fresh.caps.Lock()
+	s.caps.Lock()
+	s.isVC = fresh.isVC
+	s.isVSAN = fresh.isVSAN
+	s.caps.Unlock()
+	fresh.caps.Unlock()
+}
+
+func (s *Session) reconnectAttempts() int {
+	if s.ReconnectMaxAttempts > 0 {
+		return s.ReconnectMaxAttempts
+	}
+	return defaultReconnectMaxAttempts
+}
+
+// reconnectDelay returns the backoff to wait after the given (zero based) failed attempt
+func (s *Session) reconnectDelay(attempt int) time.Duration {
+	base := s.ReconnectBaseDelay
+	if base <= 0 {
+		base = defaultReconnectBaseDelay
+	}
+
+	max := s.ReconnectMaxDelay
+	if max <= 0 {
+		max = defaultReconnectMaxDelay
+	}
+
+	delay := base
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		delay = max
+	}
+	return delay
 }
@@ -15,12 +15,28 @@
 package session
 
 import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"golang.org/x/net/context"
 
+	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/session"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
 	"github.com/vmware/vic/pkg/vsphere/test/env"
 )
 
@@ -28,15 +44,16 @@ func TestSessionDefaults(t *testing.T) {
 	ctx := context.Background()
 
 	config := &Config{
-		Service:  env.URL(t),
-		Insecure: true,
+		Service:    env.URL(t),
+		Insecure:   true,
+		RequireAll: true,
 	}
 
 	session, err := NewSession(config).Create(ctx)
 	if err != nil {
 		t.Logf("%+v", err.Error())
 		if _, ok := err.(*find.DefaultMultipleFoundError); !ok {
-			t.Errorf(err.Error())
+			t.Error(err.Error())
 		} else {
 			t.SkipNow()
 		}
@@ -64,7 +81,7 @@ func TestSession(t *testing.T) {
 	if err != nil {
 		t.Logf("%+v", err.Error())
 		if _, ok := err.(*find.MultipleFoundError); !ok {
-			t.Errorf(err.Error())
+			t.Error(err.Error())
 		} else {
 			t.SkipNow()
 		}
@@ -76,3 +93,1673 @@ func TestSession(t *testing.T) {
 	t.Logf("IsVC: %t", session.IsVC())
 	t.Logf("IsVSAN: %t", session.IsVSAN(ctx))
 }
+
+func TestReconnect(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:              env.URL(t),
+		Insecure:             true,
+		ReconnectBaseDelay:   10 * time.Millisecond,
+		ReconnectMaxAttempts: 3,
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		if _, ok := err.(*find.DefaultMultipleFoundError); !ok {
+			t.Error(err.Error())
+		}
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	// drop the server session out from under the cached client
+	if err = session.Client.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = session.Reconnect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !session.active(ctx) {
+		t.Errorf("Session is not active after reconnect")
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	s := NewSession(&Config{
+		ReconnectBaseDelay: 100 * time.Millisecond,
+		ReconnectMaxDelay:  time.Second,
+	})
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+
+	for i, e := range expected {
+		if d := s.reconnectDelay(i); d != e {
+			t.Errorf("attempt %d: expected delay %s, got %s", i, e, d)
+		}
+	}
+
+	s = NewSession(&Config{})
+	if d := s.reconnectDelay(0); d != defaultReconnectBaseDelay {
+		t.Errorf("expected default delay %s, got %s", defaultReconnectBaseDelay, d)
+	}
+	if n := s.reconnectAttempts(); n != defaultReconnectMaxAttempts {
+		t.Errorf("expected default attempts %d, got %d", defaultReconnectMaxAttempts, n)
+	}
+}
+
+func TestBounded(t *testing.T) {
+	ctx := context.Background()
+
+	hang := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	s := NewSession(&Config{OperationTimeout: 10 * time.Millisecond})
+	err := s.bounded(ctx, "datastore lookup", hang)
+	if err == nil || err.Error() != "datastore lookup exceeded 10ms" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// errors other than our own deadline pass through untouched
+	s = NewSession(&Config{})
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err = s.bounded(cctx, "datastore lookup", hang); err != context.Canceled {
+		t.Errorf("expected %s, got %v", context.Canceled, err)
+	}
+}
+
+func TestDatastoreByName(t *testing.T) {
+	s := NewSession(&Config{})
+
+	for _, name := range []string{"datastore1", "datastore2"} {
+		ds := object.NewDatastore(nil, types.ManagedObjectReference{Type: "Datastore", Value: name})
+		ds.InventoryPath = "/ha-datacenter/datastore/" + name
+		s.Datastores = append(s.Datastores, ds)
+	}
+
+	ds, err := s.DatastoreByName("datastore2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds != s.Datastores[1] {
+		t.Errorf("expected %s, got %s", s.Datastores[1], ds)
+	}
+
+	if _, err = s.DatastoreByName("datastore3"); err == nil {
+		t.Errorf("expected error for uncached datastore")
+	}
+}
+
+func TestNetworkByName(t *testing.T) {
+	s := NewSession(&Config{})
+
+	for _, name := range []string{"VM Network", "bridge"} {
+		network := object.NewNetwork(nil, types.ManagedObjectReference{Type: "Network", Value: name})
+		network.InventoryPath = "/ha-datacenter/network/" + name
+		s.Networks = append(s.Networks, network)
+	}
+
+	network, err := s.NetworkByName("bridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if network != s.Networks[1] {
+		t.Errorf("expected %s, got %s", s.Networks[1], network)
+	}
+
+	if _, err = s.NetworkByName("external"); err == nil {
+		t.Errorf("expected error for uncached network")
+	}
+}
+
+func TestResourcePoolOrVApp(t *testing.T) {
+	s := NewSession(&Config{})
+	if s.ResourcePoolOrVApp() != nil {
+		t.Errorf("Expected no placement target without a pool or vApp")
+	}
+
+	s.Pool = object.NewResourcePool(nil, types.ManagedObjectReference{Type: "ResourcePool", Value: "resgroup-1"})
+	if s.ResourcePoolOrVApp() != s.Pool {
+		t.Errorf("Expected the pool without a vApp")
+	}
+
+	s.VirtualApp = &object.VirtualApp{
+		ResourcePool: object.NewResourcePool(nil, types.ManagedObjectReference{Type: "VirtualApp", Value: "resgroup-v2"}),
+	}
+	if s.ResourcePoolOrVApp() != s.VirtualApp.ResourcePool {
+		t.Errorf("Expected the vApp in preference to the pool")
+	}
+}
+
+func TestCapabilitiesCached(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:  env.URL(t),
+		Insecure: true,
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	vc := session.IsVC()
+	vsan := session.IsVSAN(ctx)
+
+	if session.isVC == nil || session.isVSAN == nil {
+		t.Fatalf("Capabilities were not cached by Populate")
+	}
+
+	session.refreshCapabilities(ctx)
+
+	if session.IsVC() != vc || session.IsVSAN(ctx) != vsan {
+		t.Errorf("Capabilities changed across refresh")
+	}
+}
+
+// hammer reads the cached resources from several goroutines until stop is closed
+func hammer(s *Session, stop chan struct{}) *sync.WaitGroup {
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				s.GetCluster()
+				s.GetDatacenter()
+				s.GetDatastore()
+				s.GetDatastores()
+				s.GetHost()
+				s.GetNetwork()
+				s.GetPool()
+				s.GetVMFolder()
+				s.GetFinder()
+			}
+		}()
+	}
+	return wg
+}
+
+func TestConcurrentSwap(t *testing.T) {
+	s := NewSession(&Config{})
+
+	stop := make(chan struct{})
+	wg := hammer(s, stop)
+
+	for i := 0; i < 100; i++ {
+		ref := types.ManagedObjectReference{Type: "Datastore", Value: "datastore1"}
+		ds := object.NewDatastore(nil, ref)
+
+		s.swap(context.Background(), &Session{
+			Datastore:  ds,
+			Datastores: []*object.Datastore{ds},
+			Pool:       object.NewResourcePool(nil, types.ManagedObjectReference{Type: "ResourcePool", Value: "pool"}),
+		})
+	}
+
+	close(stop)
+	wg.Wait()
+
+	if s.GetDatastore() == nil || s.GetPool() == nil {
+		t.Errorf("Expected resources to be swapped in")
+	}
+}
+
+// logoutRoundTripper counts the logouts passed to it
+type logoutRoundTripper struct {
+	logouts int
+}
+
+func (f *logoutRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	if res, ok := res.(*methods.LogoutBody); ok {
+		f.logouts++
+		res.Res = &types.LogoutResponse{}
+	}
+	return nil
+}
+
+func TestSwapRetiresReplaced(t *testing.T) {
+	rt := &logoutRoundTripper{}
+	ref := types.ManagedObjectReference{Type: "SessionManager", Value: "SessionManager"}
+	vc := &vim25.Client{
+		Client:         soap.NewClient(&url.URL{Scheme: "https", Host: "localhost"}, true),
+		RoundTripper:   rt,
+		ServiceContent: types.ServiceContent{SessionManager: &ref},
+	}
+
+	s := NewSessionFromClient(&govmomi.Client{Client: vc, SessionManager: session.NewManager(vc)}, nil)
+	stop := make(chan struct{})
+	s.stopKeepalive = stop
+
+	s.swap(context.Background(), &Session{Client: &govmomi.Client{Client: &vim25.Client{}}})
+
+	if rt.logouts != 1 {
+		t.Errorf("Expected the replaced client to be logged out, got %d logouts", rt.logouts)
+	}
+
+	select {
+	case <-stop:
+	default:
+		t.Errorf("Expected the replaced keepalive to be stopped")
+	}
+}
+
+func TestConcurrentPopulate(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:  env.URL(t),
+		Insecure: true,
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	stop := make(chan struct{})
+	wg := hammer(session, stop)
+
+	for i := 0; i < 10; i++ {
+		if _, err = session.Populate(ctx); err != nil {
+			t.Error(err)
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestLogoutIdempotent(t *testing.T) {
+	ctx := context.Background()
+
+	// never connected
+	if err := NewSession(&Config{}).Logout(ctx); err != nil {
+		t.Errorf("Logout of an unconnected session returned %s", err)
+	}
+	if NewSession(&Config{}).Valid() {
+		t.Errorf("Unconnected session reported as valid")
+	}
+
+	config := &Config{
+		Service:   env.URL(t),
+		Insecure:  true,
+		Keepalive: time.Minute,
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+
+	if !session.Valid() {
+		t.Errorf("Connected session reported as invalid")
+	}
+
+	if err = session.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if session.GetFinder() != nil {
+		t.Errorf("Finder was not released by Logout")
+	}
+	if session.GetDatacenter() != nil || session.GetDatastore() != nil || session.GetHost() != nil {
+		t.Errorf("Cached resources were not released by Logout")
+	}
+	if session.Valid() {
+		t.Errorf("Logged out session reported as valid")
+	}
+
+	if err = session.Logout(ctx); err != nil {
+		t.Errorf("Second Logout returned %s", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (&Config{Service: "https://localhost/sdk"}).Validate(); err != nil {
+		t.Errorf("Valid config rejected: %s", err)
+	}
+
+	config := &Config{
+		CertFile:       "cert.pem",
+		Keepalive:      -time.Second,
+		DatastorePath:  "datastore1",
+		DatastorePaths: []string{"datastore2"},
+		NetworkPath:    "VM Network",
+		NetworkPaths:   []string{"bridge"},
+		Token:          "<saml2:Assertion/>",
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatalf("Invalid config accepted")
+	}
+
+	// all problems are reported rather than just the first
+	for _, problem := range []string{"Service", "key file", "Token", "Keepalive", "datastore paths", "network paths"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("Expected %q to be reported in: %s", problem, err)
+		}
+	}
+
+	// and Connect shouldn't get as far as the network
+	if _, err = NewSession(config).Connect(context.Background()); err == nil {
+		t.Errorf("Connect accepted an invalid config")
+	}
+}
+
+// failingRoundTripper fails every request, counting them
+type failingRoundTripper struct {
+	requests int
+}
+
+func (f *failingRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	f.requests++
+	return errors.New("session expired")
+}
+
+func TestKeepaliveHandler(t *testing.T) {
+	rt := &failingRoundTripper{}
+	stop := make(chan struct{})
+
+	var failures []error
+	handler := func(err error) error {
+		failures = append(failures, err)
+		if len(failures) == 2 {
+			return err
+		}
+		return nil
+	}
+
+	conn := &connection{}
+	ka := keepAlive(stop, conn, keepaliveContent, handler)
+	for i := 0; i < 4; i++ {
+		if err := ka(rt); err != nil {
+			t.Errorf("keepalive returned %s", err)
+		}
+	}
+
+	if conn.connected() {
+		t.Errorf("Expected the failed keepalive to be recorded")
+	}
+
+	// the handler asked to stop after the second failure
+	if rt.requests != 2 || len(failures) != 2 {
+		t.Errorf("Expected 2 requests and failures, got %d and %d", rt.requests, len(failures))
+	}
+
+	// without a handler failures are ignored, and stop silences it
+	rt = &failingRoundTripper{}
+	ka = keepAlive(stop, &connection{}, keepaliveContent, nil)
+	ka(rt)
+	close(stop)
+	ka(rt)
+
+	if rt.requests != 1 {
+		t.Errorf("Expected 1 request, got %d", rt.requests)
+	}
+
+	// an expired session is a failure even though the request succeeded
+	failures = nil
+	ka = keepAlive(make(chan struct{}), &connection{}, keepaliveContent, handler)
+	ka(expiredRoundTripper{})
+	if len(failures) != 1 || failures[0] != ErrSessionExpired {
+		t.Errorf("Expected the expired session to be reported, got %v", failures)
+	}
+}
+
+// keepaliveContent is the service content keepalives find the session manager in
+var keepaliveContent = types.ServiceContent{
+	SessionManager: &types.ManagedObjectReference{Type: "SessionManager", Value: "SessionManager"},
+}
+
+// succeedingRoundTripper answers keepalive requests with an authenticated session
+type succeedingRoundTripper struct{}
+
+func (succeedingRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	res.(*methods.RetrievePropertiesBody).Res = &types.RetrievePropertiesResponse{
+		Returnval: []types.ObjectContent{{
+			Obj:     *keepaliveContent.SessionManager,
+			PropSet: []types.DynamicProperty{{Name: "currentSession", Val: types.UserSession{UserName: "root"}}},
+		}},
+	}
+	return nil
+}
+
+// expiredRoundTripper answers keepalive requests as a server that no longer knows
+// the session, which is to say successfully but without a current session
+type expiredRoundTripper struct{}
+
+func (expiredRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	res.(*methods.RetrievePropertiesBody).Res = &types.RetrievePropertiesResponse{
+		Returnval: []types.ObjectContent{{Obj: *keepaliveContent.SessionManager}},
+	}
+	return nil
+}
+
+func TestIsConnected(t *testing.T) {
+	s := NewSession(&Config{})
+	if s.IsConnected() {
+		t.Errorf("Expected a session that never connected to be disconnected")
+	}
+
+	s = NewSessionFromClient(&govmomi.Client{Client: &vim25.Client{}}, nil)
+	if !s.IsConnected() {
+		t.Errorf("Expected a session without keepalive to be connected")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	s.keepalive = &connection{}
+	ka := keepAlive(stop, s.keepalive, keepaliveContent, nil)
+
+	ka(&failingRoundTripper{})
+	if s.IsConnected() {
+		t.Errorf("Expected a failed keepalive to disconnect the session")
+	}
+
+	ka(succeedingRoundTripper{})
+	if !s.IsConnected() {
+		t.Errorf("Expected a successful keepalive to reconnect the session")
+	}
+
+	// a server that answers without a current session has expired it
+	ka(expiredRoundTripper{})
+	if s.IsConnected() {
+		t.Errorf("Expected an expired session to disconnect the session")
+	}
+
+	// and the next successful one to reconnect it
+	ka(succeedingRoundTripper{})
+	if !s.IsConnected() {
+		t.Errorf("Expected a successful keepalive to reconnect the session")
+	}
+
+	s.loggedOut = true
+	if s.IsConnected() {
+		t.Errorf("Expected a logged out session to be disconnected")
+	}
+}
+
+// countingRoundTripper counts the requests passed on to the wrapped round tripper
+type countingRoundTripper struct {
+	soap.RoundTripper
+	requests int
+}
+
+func (c *countingRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	c.requests++
+	return c.RoundTripper.RoundTrip(ctx, req, res)
+}
+
+func TestRoundTripperWrapper(t *testing.T) {
+	ctx := context.Background()
+
+	counter := &countingRoundTripper{}
+	config := &Config{
+		Service:   env.URL(t),
+		Insecure:  true,
+		Keepalive: time.Minute,
+		RoundTripperWrapper: func(rt soap.RoundTripper) soap.RoundTripper {
+			counter.RoundTripper = rt
+			return counter
+		},
+	}
+
+	session, err := NewSession(config).Connect(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	// at least the login went through the wrapper
+	login := counter.requests
+	if login == 0 {
+		t.Fatalf("Login did not pass through the wrapper")
+	}
+
+	if err = session.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if counter.requests == login {
+		t.Errorf("Ping did not pass through the wrapper")
+	}
+}
+
+func TestWithDatacenter(t *testing.T) {
+	ctx := context.Background()
+
+	s := NewSessionFromClient(&govmomi.Client{Client: &vim25.Client{}}, nil)
+	s.Datacenter = object.NewDatacenter(nil, types.ManagedObjectReference{Type: "Datacenter", Value: "dc-1"})
+	s.Datastore = object.NewDatastore(nil, types.ManagedObjectReference{Type: "Datastore", Value: "ds-1"})
+	finder := s.Finder
+
+	dc := object.NewDatacenter(nil, types.ManagedObjectReference{Type: "Datacenter", Value: "dc-2"})
+	c := s.WithDatacenter(ctx, dc)
+
+	if c.Datacenter != dc {
+		t.Errorf("Expected the copy to have datacenter %s, got %s", dc, c.Datacenter)
+	}
+	if c.Finder == nil || c.Finder == finder {
+		t.Errorf("Expected the copy to have its own Finder")
+	}
+	if c.Client != s.Client || c.Datastore != s.Datastore {
+		t.Errorf("Expected the copy to share the client and cached resources")
+	}
+
+	// the original is untouched
+	if s.Datacenter.Reference().Value != "dc-1" || s.Finder != finder {
+		t.Errorf("WithDatacenter modified the original session")
+	}
+}
+
+func TestClone(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:    env.URL(t),
+		Insecure:   true,
+		RequireAll: true,
+	}
+
+	if _, err := NewSession(config).Clone(ctx, &Config{Service: "https://elsewhere/sdk"}); err == nil {
+		t.Errorf("Clone accepted a different service")
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	clone, err := session.Clone(ctx, &Config{
+		Service:       config.Service,
+		Insecure:      true,
+		DatastorePath: session.Datastore.InventoryPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if clone.Client != session.Client {
+		t.Errorf("Clone did not reuse the client")
+	}
+	if clone.Finder == session.Finder {
+		t.Errorf("Clone shares the finder")
+	}
+	if clone.Datastore.Reference() != session.Datastore.Reference() {
+		t.Errorf("Clone resolved a different datastore")
+	}
+}
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+
+	if err := NewSession(&Config{}).Ping(ctx); err != ErrSessionExpired {
+		t.Errorf("Expected %s for an unconnected session, got %v", ErrSessionExpired, err)
+	}
+
+	config := &Config{
+		Service:  env.URL(t),
+		Insecure: true,
+	}
+
+	session, err := NewSession(config).Connect(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+
+	if err = session.Ping(ctx); err != nil {
+		t.Errorf("Ping failed on a live session: %s", err)
+	}
+
+	us, err := session.UserSession(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if us.UserName == "" {
+		t.Errorf("UserSession returned an empty user name")
+	}
+
+	session.Logout(ctx)
+
+	if err = session.Ping(ctx); err != ErrSessionExpired {
+		t.Errorf("Expected %s after logout, got %v", ErrSessionExpired, err)
+	}
+}
+
+func TestNewSessionFromClient(t *testing.T) {
+	ctx := context.Background()
+
+	client := &govmomi.Client{Client: &vim25.Client{}}
+	session := NewSessionFromClient(client, nil)
+	if session.Finder == nil {
+		t.Fatal("Expected a Finder on the wrapped session")
+	}
+
+	// the empty Config would fail validation if Connect didn't reuse the client
+	s, err := session.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Client != client {
+		t.Errorf("Connect replaced the injected client")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+
+	if err := NewSession(&Config{}).Refresh(ctx); err != ErrSessionExpired {
+		t.Errorf("Expected %s refreshing an unconnected session, got %v", ErrSessionExpired, err)
+	}
+
+	// refreshing must leave the connection and its keepalive alone
+	client := &govmomi.Client{}
+	stop := make(chan struct{})
+	s := &Session{Client: client, stopKeepalive: stop}
+	s.swapResources(&Session{Datastore: &object.Datastore{}})
+
+	if s.Client != client || s.stopKeepalive != stop {
+		t.Errorf("swapResources replaced the connection")
+	}
+	if s.Datastore == nil {
+		t.Errorf("swapResources didn't replace the resources")
+	}
+
+	config := &Config{
+		Service:       env.URL(t),
+		Insecure:      true,
+		Keepalive:     time.Duration(5) * time.Minute,
+		DatastorePath: "/ha-datacenter/datastore/*",
+		HostPath:      "/ha-datacenter/host/*/*",
+		PoolPath:      "/ha-datacenter/host/*/Resources",
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	before := session.GetDatastore()
+	if err = session.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if session.GetDatastore().Reference() != before.Reference() {
+		t.Errorf("Refresh resolved a different datastore")
+	}
+	if session.stopKeepalive == nil {
+		t.Errorf("Refresh dropped the keepalive")
+	}
+}
+
+func TestPropertyCollector(t *testing.T) {
+	s := NewSessionFromClient(&govmomi.Client{Client: &vim25.Client{}}, nil)
+
+	var wg sync.WaitGroup
+	collectors := make([]*property.Collector, 10)
+	for i := range collectors {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			collectors[i] = s.PropertyCollector()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, pc := range collectors {
+		if pc != collectors[0] {
+			t.Fatalf("Expected the collector to be shared")
+		}
+	}
+
+	// a new client, as from Reconnect, gets a new collector
+	s.swap(context.Background(), &Session{Client: &govmomi.Client{Client: &vim25.Client{}}})
+	if s.PropertyCollector() == collectors[0] {
+		t.Errorf("Expected a new collector for the new client")
+	}
+
+	// an unconnected session has no collector, and its users fail cleanly
+	s = NewSession(&Config{})
+	if s.PropertyCollector() != nil {
+		t.Errorf("Expected no collector without a client")
+	}
+
+	ctx := context.Background()
+	ref := types.ManagedObjectReference{Type: "Task", Value: "task-1"}
+	if err := s.Properties(ctx, ref, []string{"info"}, &mo.Task{}); err != ErrSessionExpired {
+		t.Errorf("Expected Properties to fail with ErrSessionExpired, got %v", err)
+	}
+	if _, err := s.WaitForTask(ctx, object.NewTask(nil, ref)); err != ErrSessionExpired {
+		t.Errorf("Expected WaitForTask to fail with ErrSessionExpired, got %v", err)
+	}
+}
+
+func TestDatacenters(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:  env.URL(t),
+		Insecure: true,
+	}
+
+	session, err := NewSession(config).Connect(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	dcs, err := session.Datacenters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dcs) == 0 {
+		t.Errorf("Expected at least one datacenter")
+	}
+	if session.GetDatacenter() != nil {
+		t.Errorf("Datacenters changed the cached datacenter")
+	}
+}
+
+func TestPopulateSkipsUnconfigured(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:  env.URL(t),
+		Insecure: true,
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	// nothing was configured so nothing should have been resolved
+	if session.Datacenter != nil || session.Cluster != nil || session.Datastore != nil ||
+		session.Host != nil || session.Pool != nil || session.VMFolder != nil {
+		t.Errorf("Populate resolved resources without a path: %+v", session)
+	}
+}
+
+func TestPopulateDefaultDatacenter(t *testing.T) {
+	ctx := context.Background()
+
+	// a relative path needs the default datacenter to scope the finder
+	config := &Config{
+		Service:       env.URL(t),
+		Insecure:      true,
+		DatastorePath: "*",
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	if session.Datacenter == nil {
+		t.Errorf("Expected the default datacenter to be resolved for the datastore")
+	}
+	if session.Datastore == nil {
+		t.Errorf("Expected the relative datastore path to resolve")
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	// a server that never answers
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	config := &Config{
+		Service:        server.URL + "/sdk",
+		ConnectTimeout: 50 * time.Millisecond,
+	}
+
+	_, err := NewSession(config).Connect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Timed out connecting") {
+		t.Errorf("Expected a connection timeout, got %v", err)
+	}
+
+	// the caller's own deadline is reported as a plain connection failure
+	config.ConnectTimeout = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = NewSession(config).Connect(ctx)
+	if err == nil || !strings.Contains(err.Error(), "Failed to connect") {
+		t.Errorf("Expected a connection failure, got %v", err)
+	}
+}
+
+func TestFinderAllFlag(t *testing.T) {
+	all := false
+
+	if !(&Config{}).finderAll() {
+		t.Errorf("Expected the all flag to default to true")
+	}
+	if (&Config{FinderAllFlag: &all}).finderAll() {
+		t.Errorf("Expected the all flag to be disabled")
+	}
+}
+
+func TestWaitForTask(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:        env.URL(t),
+		Insecure:       true,
+		DatacenterPath: "/ha-datacenter",
+		DatastorePath:  "/ha-datacenter/datastore/*",
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	// deleting a file that doesn't exist is a cheap way to get a failing task
+	fm := object.NewFileManager(session.Vim25())
+	task, err := fm.DeleteDatastoreFile(ctx, session.Datastore.Path("does-not-exist"), session.Datacenter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := session.WaitForTask(ctx, task)
+	if err == nil {
+		t.Errorf("Expected the task to fail")
+	}
+	if info == nil || info.State != types.TaskInfoStateError {
+		t.Errorf("Expected the failed TaskInfo, got %+v", info)
+	}
+
+	// a cancelled context stops the wait
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = session.WaitForTask(cctx, task); err == nil {
+		t.Errorf("Expected the wait to be cancelled")
+	}
+
+	tm, err := session.TaskManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mgr mo.TaskManager
+	if err = tm.Properties(ctx, tm.Reference(), []string{"description"}, &mgr); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServicesFailover(t *testing.T) {
+	s := NewSession(&Config{
+		Service:  "https://vc1/sdk",
+		Services: []string{"https://vc2/sdk", "", "https://vc1/sdk", "https://vc3/sdk"},
+	})
+
+	// Service leads, with blanks and duplicates dropped
+	expected := []string{"https://vc1/sdk", "https://vc2/sdk", "https://vc3/sdk"}
+	if got := s.candidates(); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// a reconnect starts from the active service and falls through the rest
+	s.ActiveService = "https://vc2/sdk"
+	expected = []string{"https://vc2/sdk", "https://vc3/sdk", "https://vc1/sdk"}
+	if got := s.candidates(); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// every service is tried, and every failure reported
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	broken := httptest.NewServer(http.NotFoundHandler())
+	defer broken.Close()
+
+	_, err := NewSession(&Config{Services: []string{down.URL, broken.URL}}).Connect(context.Background())
+	if err == nil {
+		t.Fatal("Expected Connect to fail")
+	}
+	for _, u := range []string{down.URL, broken.URL} {
+		if !strings.Contains(err.Error(), u) {
+			t.Errorf("Expected the failure for %s to be reported in: %s", u, err)
+		}
+	}
+}
+
+func TestResourcePools(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := NewSession(&Config{}).ChildResourcePools(ctx); err == nil {
+		t.Errorf("Expected an error without a cached pool")
+	}
+
+	config := &Config{
+		Service:  env.URL(t),
+		Insecure: true,
+		PoolPath: "/ha-datacenter/host/*/Resources",
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	children, err := session.ChildResourcePools(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := session.DescendantResourcePools(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) < len(children) {
+		t.Errorf("Expected at least the %d children among the descendants, got %d", len(children), len(all))
+	}
+
+	for _, child := range children {
+		pool, err := session.ResourcePoolByPath(ctx, child.InventoryPath)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if pool.Reference() != child.Reference() {
+			t.Errorf("Resolved %s to a different pool", child.InventoryPath)
+		}
+	}
+}
+
+func TestHosts(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := NewSession(&Config{}).Hosts(ctx); err == nil {
+		t.Errorf("Expected an error with nothing cached")
+	}
+
+	host := &object.HostSystem{}
+	hosts, err := (&Session{Host: host}).Hosts(ctx)
+	if err != nil || len(hosts) != 1 || hosts[0] != host {
+		t.Errorf("Expected the cached host, got %v: %v", hosts, err)
+	}
+
+	config := &Config{
+		Service:        env.URL(t),
+		Insecure:       true,
+		DatacenterPath: "/ha-datacenter",
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	hosts, err = session.Hosts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) == 0 {
+		t.Errorf("Expected the datacenter's hosts")
+	}
+}
+
+// inventoryRoundTripper answers property collector requests from a fake inventory,
+// with the properties of each object asked for, or for a traversal the children
+type inventoryRoundTripper struct {
+	props    map[types.ManagedObjectReference][]types.DynamicProperty
+	children map[types.ManagedObjectReference][]types.ManagedObjectReference
+}
+
+func (f *inventoryRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	if _, ok := req.(*methods.LogoutBody); ok {
+		return nil
+	}
+
+	var contents []types.ObjectContent
+	for _, spec := range req.(*methods.RetrievePropertiesBody).Req.SpecSet {
+		for _, os := range spec.ObjectSet {
+			refs := []types.ManagedObjectReference{os.Obj}
+			if len(os.SelectSet) > 0 {
+				refs = f.children[os.Obj]
+			}
+			for _, ref := range refs {
+				contents = append(contents, types.ObjectContent{Obj: ref, PropSet: f.props[ref]})
+			}
+		}
+	}
+
+	res.(*methods.RetrievePropertiesBody).Res = &types.RetrievePropertiesResponse{Returnval: contents}
+	return nil
+}
+
+// inventorySession returns a session with dc1 cached, whose host folder has a
+// standalone host and a cluster at the top, and another standalone host in a
+// folder. The vm folder has a containers folder, the network folder a
+// portgroup of dvs1, and the datastore folder nothing at all.
+func inventorySession() *Session {
+	ref := func(kind, value string) types.ManagedObjectReference {
+		return types.ManagedObjectReference{Type: kind, Value: value}
+	}
+	name := func(name string) types.DynamicProperty {
+		return types.DynamicProperty{Name: "name", Val: name}
+	}
+	hosts := func(refs ...types.ManagedObjectReference) types.DynamicProperty {
+		return types.DynamicProperty{Name: "host", Val: types.ArrayOfManagedObjectReference{ManagedObjectReference: refs}}
+	}
+
+	root, dc := ref("Folder", "group-d1"), ref("Datacenter", "dc1")
+	vm, containers := ref("Folder", "group-v1"), ref("Folder", "group-v2")
+	host, rack := ref("Folder", "group-h1"), ref("Folder", "group-h2")
+	datastore, network := ref("Folder", "group-s1"), ref("Folder", "group-n1")
+	esx1, esx2, cluster := ref("ComputeResource", "domain-s1"), ref("ComputeResource", "domain-s2"), ref("ClusterComputeResource", "domain-c1")
+	host1, host2, host3 := ref("HostSystem", "host-1"), ref("HostSystem", "host-2"), ref("HostSystem", "host-3")
+	dvs, pg := ref("VmwareDistributedVirtualSwitch", "dvs-1"), ref("DistributedVirtualPortgroup", "dvportgroup-1")
+
+	rt := &inventoryRoundTripper{
+		props: map[types.ManagedObjectReference][]types.DynamicProperty{
+			root:       {name("Datacenters")},
+			dc:         {name("dc1"), {Name: "vmFolder", Val: vm}, {Name: "hostFolder", Val: host}, {Name: "datastoreFolder", Val: datastore}, {Name: "networkFolder", Val: network}},
+			vm:         {name("vm")},
+			containers: {name("containers")},
+			host:       {name("host")},
+			rack:       {name("rack")},
+			datastore:  {name("datastore")},
+			network:    {name("network")},
+			esx1:       {name("esx1"), hosts(host1)},
+			esx2:       {name("esx2"), hosts(host2)},
+			cluster:    {name("cluster1"), hosts(host3)},
+			host1:      {name("esx1")},
+			host2:      {name("esx2")},
+			host3:      {name("esx3")},
+			dvs:        {name("dvs1")},
+			pg:         {name("pg1"), {Name: "config.distributedVirtualSwitch", Val: dvs}},
+		},
+		children: map[types.ManagedObjectReference][]types.ManagedObjectReference{
+			root:    {dc},
+			dc:      {vm, host, datastore, network},
+			vm:      {containers},
+			host:    {esx1, rack, cluster},
+			rack:    {esx2},
+			esx1:    {host1},
+			esx2:    {host2},
+			cluster: {host3},
+			network: {dvs, pg},
+		},
+	}
+
+	client := &vim25.Client{RoundTripper: rt, ServiceContent: types.ServiceContent{RootFolder: root}}
+	s := NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+	s.Datacenter = object.NewDatacenter(client, dc)
+	return s
+}
+
+func TestHostsNested(t *testing.T) {
+	hosts, err := inventorySession().Hosts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, host := range hosts {
+		paths = append(paths, host.InventoryPath)
+	}
+
+	// the host in the folder is found along with those at the top
+	expected := []string{"/dc1/host/esx1/esx1", "/dc1/host/cluster1/esx3", "/dc1/host/rack/esx2/esx2"}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected hosts %v, got %v", expected, paths)
+	}
+}
+
+func TestClustersNested(t *testing.T) {
+	ctx := context.Background()
+	s := inventorySession()
+
+	describe := func(crs []*object.ComputeResource) []string {
+		var found []string
+		for _, cr := range crs {
+			found = append(found, cr.Reference().Type+" "+cr.InventoryPath)
+		}
+		return found
+	}
+
+	clusters, err := s.Clusters(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := describe(clusters); strings.Join(found, ",") != "ClusterComputeResource /dc1/host/cluster1" {
+		t.Errorf("Expected only the cluster, got %v", found)
+	}
+
+	// standalone hosts keep their own type, wherever they are
+	clusters, err = s.Clusters(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"ComputeResource /dc1/host/esx1",
+		"ClusterComputeResource /dc1/host/cluster1",
+		"ComputeResource /dc1/host/rack/esx2",
+	}
+	if found := describe(clusters); strings.Join(found, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, found)
+	}
+}
+
+func TestClusters(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := NewSession(&Config{}).Clusters(ctx, false); err == nil {
+		t.Errorf("Expected an error with nothing cached")
+	}
+
+	config := &Config{
+		Service:        env.URL(t),
+		Insecure:       true,
+		DatacenterPath: "/ha-datacenter",
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	// ESX has no clusters, only its own standalone compute resource
+	clusters, err := session.Clusters(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clusters == nil || len(clusters) != 0 {
+		t.Errorf("Expected an empty list of clusters, got %v", clusters)
+	}
+
+	clusters, err = session.Clusters(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 1 {
+		t.Errorf("Expected the standalone compute resource, got %v", clusters)
+	}
+}
+
+func TestPopulateVMFolder(t *testing.T) {
+	ctx := context.Background()
+
+	s := inventorySession()
+	s.DatacenterPath = "/dc1"
+	s.FolderPath = "/dc1/vm/containers"
+	if _, err := s.Populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.VMFolder == nil || s.VMFolder.Reference().Value != "group-v2" {
+		t.Fatalf("Expected the containers folder, got %v", s.VMFolder)
+	}
+	if s.VMFolder.InventoryPath != "/dc1/vm/containers" {
+		t.Errorf("Expected the folder's path, got %s", s.VMFolder.InventoryPath)
+	}
+
+	folder, err := s.VMFolderOrRoot(ctx)
+	if err != nil || folder != s.VMFolder {
+		t.Errorf("Expected the configured folder, got %v: %s", folder, err)
+	}
+
+	// without a path the datacenter's vm folder stands in
+	s = inventorySession()
+	s.DatacenterPath = "/dc1"
+	if _, err = s.Populate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	folder, err = s.VMFolderOrRoot(ctx)
+	if err != nil || folder.Reference().Value != "group-v1" {
+		t.Errorf("Expected the datacenter's vm folder, got %v: %s", folder, err)
+	}
+
+	// and a missing folder is a failure of its own
+	s = inventorySession()
+	s.DatacenterPath = "/dc1"
+	s.FolderPath = "/dc1/vm/missing"
+	_, err = s.Populate(ctx)
+	if perr, ok := err.(*PopulateError); !ok || len(perr.Failures) != 1 || perr.Failures["folder"] == nil {
+		t.Errorf("Expected only the folder to fail, got %v", err)
+	}
+}
+
+func TestPopulateAfterLogout(t *testing.T) {
+	ctx := context.Background()
+
+	// a logout needs a session manager to call and connections to close
+	s := inventorySession()
+	s.Client.ServiceContent.SessionManager = &types.ManagedObjectReference{Type: "SessionManager", Value: "SessionManager"}
+	s.Client.Client.Client = soap.NewClient(&url.URL{Scheme: "https", Host: "localhost"}, true)
+	s.Client.SessionManager = session.NewManager(s.Vim25())
+	s.DatacenterPath = "/dc1"
+	if err := s.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the finder went with the logout, so there's nothing to resolve with
+	if _, err := s.Populate(ctx); err != ErrSessionExpired {
+		t.Errorf("Expected %s populating after logout, got %v", ErrSessionExpired, err)
+	}
+}
+
+func TestPopulateConcurrently(t *testing.T) {
+	ctx := context.Background()
+
+	// the lookups finish in whatever order, but fail in that of the resources
+	expected := []string{"cluster", "datastore", "host", "network", "pool"}
+	for i := 0; i < 10; i++ {
+		s := inventorySession()
+		s.Datacenter = nil
+		s.DatacenterPath = "/dc1"
+		s.ClusterPath = "/dc1/host/missing"
+		s.DatastorePath = "/dc1/datastore/missing"
+		s.HostPath = "/dc1/host/esx1/missing"
+		s.NetworkPath = "/dc1/network/missing"
+		s.PoolPath = "/dc1/host/missing/Resources"
+		s.FolderPath = "/dc1/vm/containers"
+
+		_, err := s.Populate(ctx)
+		perr, ok := err.(*PopulateError)
+		if !ok {
+			t.Fatalf("Expected a PopulateError, got %v", err)
+		}
+		if strings.Join(perr.kinds, ",") != strings.Join(expected, ",") {
+			t.Fatalf("Expected failures in the order %v, got %v", expected, perr.kinds)
+		}
+
+		// while the resources that were found are set, scoped to the datacenter
+		if s.Datacenter == nil || s.VMFolder == nil || s.VMFolder.Reference().Value != "group-v2" {
+			t.Fatalf("Expected the datacenter and folder to be resolved, got %v and %v", s.Datacenter, s.VMFolder)
+		}
+	}
+}
+
+func TestPopulateTolerateAmbiguous(t *testing.T) {
+	ctx := context.Background()
+
+	failures := func(tolerate bool) []string {
+		s := inventorySession()
+		s.Datacenter = nil
+		s.DatacenterPath = "/dc1"
+		s.RequireAll = true
+		s.TolerateAmbiguous = tolerate
+
+		_, err := s.Populate(ctx)
+		perr, ok := err.(*PopulateError)
+		if !ok {
+			t.Fatalf("Expected a PopulateError, got %v", err)
+		}
+		return perr.kinds
+	}
+
+	// the defaults of the cluster and host are ambiguous, the others missing
+	if kinds := failures(false); strings.Join(kinds, ",") != "cluster,datastore,host,pool" {
+		t.Errorf("Expected every default to fail, got %v", kinds)
+	}
+	if kinds := failures(true); strings.Join(kinds, ",") != "datastore,pool" {
+		t.Errorf("Expected only the missing defaults to fail, got %v", kinds)
+	}
+
+	// without RequireAll there are no defaults to tolerate
+	if warnings := (&Config{TolerateAmbiguous: true}).Warnings(); len(warnings) != 1 {
+		t.Errorf("Expected a warning for TolerateAmbiguous alone, got %v", warnings)
+	}
+	if warnings := (&Config{TolerateAmbiguous: true, RequireAll: true}).Warnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+}
+
+func TestDatacenterFolders(t *testing.T) {
+	ctx := context.Background()
+
+	s := NewSession(&Config{})
+	if _, err := s.DatacenterFolders(ctx); err == nil {
+		t.Errorf("Expected an error with nothing cached")
+	}
+
+	// cached folders are returned without a round trip
+	s.Datacenter = object.NewDatacenter(nil, types.ManagedObjectReference{Type: "Datacenter", Value: "datacenter-2"})
+	cached := &object.DatacenterFolders{VmFolder: object.NewFolder(nil, types.ManagedObjectReference{Type: "Folder", Value: "group-v3"})}
+	s.folders = cached
+	s.foldersDC = s.Datacenter
+
+	folders, err := s.DatacenterFolders(ctx)
+	if err != nil || folders != cached {
+		t.Errorf("Expected the cached folders, got %v: %s", folders, err)
+	}
+
+	folder, err := s.VMFolderOrRoot(ctx)
+	if err != nil || folder != cached.VmFolder {
+		t.Errorf("Expected the cached VM folder, got %v: %s", folder, err)
+	}
+
+	// until the resources are resolved again
+	s.swapResources(NewSession(&Config{}))
+	if s.folders != nil || s.foldersDC != nil {
+		t.Errorf("Expected the cached folders to be dropped")
+	}
+
+	config := &Config{
+		Service:        env.URL(t),
+		Insecure:       true,
+		DatacenterPath: "/ha-datacenter",
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	folders, err = session.DatacenterFolders(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if folders.VmFolder == nil || folders.HostFolder == nil {
+		t.Errorf("Expected the datacenter's folders, got %+v", folders)
+	}
+
+	if again, _ := session.DatacenterFolders(ctx); again != folders {
+		t.Errorf("Expected the folders to be cached")
+	}
+}
+
+func TestCreateCancelledLogsOut(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	loggedOut := false
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		w.Header().Set("Content-Type", "text/xml")
+		switch {
+		case strings.Contains(string(body), "<RetrieveServiceContent "):
+			w.Write([]byte(serviceContentResponse))
+		case strings.Contains(string(body), "<Login "):
+			w.Write([]byte(loginResponse))
+		case strings.Contains(string(body), "<Logout "):
+			mu.Lock()
+			loggedOut = true
+			mu.Unlock()
+			w.Write([]byte(logoutResponse))
+		default:
+			// the caller gives up while Populate is waiting on the datacenter
+			cancel()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(notImplementedFault))
+		}
+	}))
+	defer server.Close()
+
+	config := &Config{
+		Service:        "root:pass@" + strings.TrimPrefix(server.URL, "https://") + "/sdk",
+		Insecure:       true,
+		DatacenterPath: "/dc1",
+	}
+
+	s := NewSession(config)
+	if _, err := s.Create(ctx); err == nil {
+		t.Fatal("Expected Create to fail once cancelled")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !loggedOut {
+		t.Errorf("Expected the server session to be logged out")
+	}
+	if s.Valid() {
+		t.Errorf("Expected the session to be invalid after the failed Create")
+	}
+}
+
+func TestUnscopedFinder(t *testing.T) {
+	ctx := context.Background()
+
+	scope := false
+	if !(&Config{}).scopeFinder() || (&Config{ScopeFinderToDatacenter: &scope}).scopeFinder() {
+		t.Errorf("Expected the finder to be scoped unless disabled")
+	}
+
+	config := &Config{
+		Service:                 env.URL(t),
+		Insecure:                true,
+		DatacenterPath:          "/ha-datacenter",
+		ScopeFinderToDatacenter: &scope,
+	}
+
+	session, err := NewSession(config).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+	defer session.Logout(ctx)
+
+	if session.Datacenter == nil {
+		t.Errorf("Expected the datacenter to be cached")
+	}
+
+	// absolute paths work from the whole inventory
+	if _, err = session.Finder.DatastoreList(ctx, "/ha-datacenter/datastore/*"); err != nil {
+		t.Errorf("Unable to list datastores by absolute path: %s", err)
+	}
+
+	// and the helpers listing the datacenter's contents still work
+	hosts, err := session.Hosts(ctx)
+	if err != nil || len(hosts) == 0 {
+		t.Errorf("Expected the datacenter's hosts, got %v: %v", hosts, err)
+	}
+}
+
+const poolOwnerResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<soapenv:Body><RetrievePropertiesResponse xmlns="urn:vim25"><returnval><obj type="ResourcePool">resgroup-8</obj><propSet><name>owner</name><val type="ClusterComputeResource" xsi:type="ManagedObjectReference">domain-c7</val></propSet></returnval></RetrievePropertiesResponse></soapenv:Body>
+</soapenv:Envelope>`
+
+func TestResourcePoolOwner(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := NewSession(&Config{}).ResourcePoolOwner(ctx); err == nil {
+		t.Errorf("Expected an error without a cached pool")
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(poolOwnerResponse))
+	}))
+	defer server.Close()
+
+	s := ticketSession(server, &Config{})
+	s.Pool = object.NewResourcePool(s.Vim25(), types.ManagedObjectReference{Type: "ResourcePool", Value: "resgroup-8"})
+
+	owner := types.ManagedObjectReference{Type: "ClusterComputeResource", Value: "domain-c7"}
+	cr, err := s.ResourcePoolOwner(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cr.Reference() != owner {
+		t.Errorf("Expected the owner %v, got %v", owner, cr.Reference())
+	}
+
+	// the cached cluster is preferred when it's the owner
+	s.Cluster = object.NewComputeResource(s.Vim25(), owner)
+	cr, err = s.ResourcePoolOwner(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cr != s.Cluster {
+		t.Errorf("Expected the cached cluster, got %v", cr)
+	}
+
+	s.Cluster = object.NewComputeResource(s.Vim25(), types.ManagedObjectReference{Type: "ComputeResource", Value: "domain-s1"})
+	cr, err = s.ResourcePoolOwner(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cr == s.Cluster || cr.Reference() != owner {
+		t.Errorf("Expected a new owner rather than the unrelated cached cluster, got %v", cr)
+	}
+
+	if requests != 3 {
+		t.Errorf("Expected a single request per lookup, got %d", requests)
+	}
+}
+
+func TestConnectAnonymous(t *testing.T) {
+	ctx := context.Background()
+
+	logins := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		w.Header().Set("Content-Type", "text/xml")
+		switch {
+		case strings.Contains(string(body), "<RetrieveServiceContent "):
+			w.Write([]byte(serviceContentResponse))
+		case strings.Contains(string(body), "<Login "):
+			logins++
+			if strings.Contains(string(body), "wrong") {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(invalidLoginFault))
+				return
+			}
+			w.Write([]byte(loginResponse))
+		case strings.Contains(string(body), "<Logout "):
+			w.Write([]byte(logoutResponse))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(notImplementedFault))
+		}
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	if _, err := NewSession(&Config{Service: server.URL + "/sdk"}).Authenticate(ctx); err == nil {
+		t.Errorf("Expected Authenticate to require an anonymous connection")
+	}
+
+	config := &Config{Service: "root:wrong@" + host + "/sdk", Insecure: true}
+	s, err := NewSession(config).ConnectAnonymous(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server can be inspected before logging in
+	if logins != 0 || s.ServerKind() != ServerVCSA || s.APIVersion() != "6.0" || s.Valid() {
+		t.Errorf("Expected an anonymous connection to a VCSA, got %d logins to %s %s", logins, s.ServerKind(), s.APIVersion())
+	}
+
+	// a failed login leaves the session connected anonymously
+	if _, err = s.Authenticate(ctx); err == nil {
+		t.Errorf("Expected the login to fail")
+	}
+	if s.Client == nil || s.Valid() {
+		t.Errorf("Expected the session to remain connected anonymously")
+	}
+
+	// so that other credentials can be tried
+	s.Service = "root:pass@" + host + "/sdk"
+	s.ActiveService = s.Service
+	if _, err = s.Authenticate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Valid() || logins != 2 {
+		t.Errorf("Expected an authenticated session after %d logins", logins)
+	}
+
+	// the authenticated client isn't dropped for an anonymous one
+	authenticated := s.Client
+	if _, err = s.ConnectAnonymous(ctx); err == nil {
+		t.Errorf("Expected ConnectAnonymous to refuse a logged in session")
+	}
+	if s.Client != authenticated || !s.Valid() {
+		t.Errorf("Expected the authenticated client to be kept")
+	}
+
+	if err = s.Logout(ctx); err != nil {
+		t.Error(err)
+	}
+
+	// while a bad service is reported with the reason
+	s, err = NewSession(&Config{Service: server.URL + "/sdk", Insecure: true}).ConnectAnonymous(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ActiveService = "%zz"
+	_, err = s.Authenticate(ctx)
+	if err == nil || !strings.Contains(err.Error(), "could not be parsed: ") {
+		t.Errorf("Expected the parse failure and its cause, got %v", err)
+	}
+
+	// there's no server session to end for an anonymous one
+	s, err = NewSession(&Config{Service: server.URL + "/sdk", Insecure: true}).ConnectAnonymous(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Logout(ctx); err != nil {
+		t.Errorf("Expected no error logging out of an anonymous session, got %s", err)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sessiontest provides helpers for testing code that consumes a
+// session.Session. The vendored govmomi has no simulator, so the helpers
+// target the ESX or VC given by the environment, skipping the calling test
+// when none is defined.
+package sessiontest
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/vic/pkg/vsphere/session"
+	"github.com/vmware/vic/pkg/vsphere/test/env"
+)
+
+// Mode selects the kind of target a helper connects to
+type Mode int
+
+const (
+	// ESX targets the host named by VIC_ESX_TEST_URL
+	ESX Mode = iota
+	// VC targets the vCenter named by VIC_VC_TEST_URL
+	VC
+)
+
+// String returns the name of the mode
+func (m Mode) String() string {
+	if m == VC {
+		return "VC"
+	}
+	return "ESX"
+}
+
+// Config returns a session.Config for the target selected by mode, skipping
+// the calling test if that target isn't defined
+func Config(t *testing.T, mode Mode) *session.Config {
+	config := &session.Config{
+		Insecure:   true,
+		Keepalive:  time.Duration(5) * time.Minute,
+		RequireAll: true,
+	}
+
+	switch mode {
+	case VC:
+		config.Service = os.Getenv("VIC_VC_TEST_URL")
+		if config.Service == "" {
+			t.Skip("Skipping: No test VC URL defined")
+		}
+		// the defaults resolve the inventory of a single datacenter
+	default:
+		config.Service = env.URL(t)
+		config.DatastorePath = "/ha-datacenter/datastore/*"
+		config.HostPath = "/ha-datacenter/host/*/*"
+		config.NetworkPath = "/ha-datacenter/network/*"
+		config.PoolPath = "/ha-datacenter/host/*/Resources"
+	}
+
+	return config
+}
+
+// Session returns a populated session for the target selected by mode, along
+// with a teardown func that logs it out. The calling test is skipped if the
+// target isn't defined or the session cannot be created.
+func Session(ctx context.Context, t *testing.T, mode Mode) (*session.Session, func()) {
+	s, err := session.NewSession(Config(t, mode)).Create(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+
+	if s.IsVC() != (mode == VC) {
+		s.Logout(ctx)
+		t.Fatalf("Expected a %s target for %s", mode, s.Service)
+	}
+
+	return s, func() {
+		s.Logout(ctx)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessiontest
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// setenv sets the environment variable key to value until the returned func is called
+func setenv(key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// skipped returns whether fn skipped the test it was given, rather than failing it
+func skipped(t *testing.T, fn func(t *testing.T)) bool {
+	var skipped bool
+	passed := t.Run("helper", func(t *testing.T) {
+		defer func() { skipped = t.Skipped() }()
+		fn(t)
+	})
+	return passed && skipped
+}
+
+func TestConfigSkipsUndefined(t *testing.T) {
+	defer setenv("VIC_VC_TEST_URL", "")()
+
+	if !skipped(t, func(t *testing.T) { Config(t, VC) }) {
+		t.Errorf("Expected Config to skip without a VC URL")
+	}
+}
+
+func TestSessionSkipsUnreachable(t *testing.T) {
+	// nothing listens on the discard port
+	defer setenv("VIC_ESX_TEST_URL", "https://127.0.0.1:9/sdk")()
+
+	if !skipped(t, func(t *testing.T) {
+		Session(context.Background(), t, ESX)
+		t.Errorf("Expected Session to fail to connect")
+	}) {
+		t.Errorf("Expected Session to skip, not fail, when the session cannot be created")
+	}
+}
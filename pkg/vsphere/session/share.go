@@ -0,0 +1,187 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+)
+
+// sharedClient is an authenticated client shared by the sessions holding a
+// reference to it
+type sharedClient struct {
+	key    string
+	client *govmomi.Client
+
+	// stop silences the keepalive of the session that created the client,
+	// closed once the last reference is released
+	stop chan struct{}
+
+	// keepalive is the connection state observed by that keepalive, if any
+	keepalive *connection
+
+	// certs are the ServerCertificates of the session that created the client
+	certs []*x509.Certificate
+
+	// refs is guarded by the registry
+	refs int
+}
+
+// clientRegistry holds the clients shared by sessions with ShareClient set,
+// keyed by service, credentials and connection settings
+type clientRegistry struct {
+	mu      sync.Mutex
+	clients map[string]*sharedClient
+}
+
+var sharedClients = &clientRegistry{clients: make(map[string]*sharedClient)}
+
+// acquire returns a reference to the client registered under key, or nil
+func (r *clientRegistry) acquire(key string) *sharedClient {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := r.clients[key]
+	if e != nil {
+		e.refs++
+	}
+	return e
+}
+
+// add registers client under key, holding a single reference. Should another
+// session have registered a client under the same key since, it's replaced
+// for new sessions but left to those already holding it.
+func (r *clientRegistry) add(key string, client *govmomi.Client, stop chan struct{}) *sharedClient {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := &sharedClient{key: key, client: client, stop: stop, refs: 1}
+	r.clients[key] = e
+	return e
+}
+
+// forget stops e being handed out, such as once it's no longer authenticated
+func (r *clientRegistry) forget(e *sharedClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.clients[e.key] == e {
+		delete(r.clients, e.key)
+	}
+}
+
+// release drops a reference to e, returning whether it was the last, in which
+// case the caller is responsible for logging out
+func (r *clientRegistry) release(e *sharedClient) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e.refs--
+	if e.refs > 0 {
+		return false
+	}
+
+	if r.clients[e.key] == e {
+		delete(r.clients, e.key)
+	}
+	return true
+}
+
+// shareable returns whether the session may share its client. Those with a
+// DialContext don't, as there's no telling whether two dial the same way.
+func (c *Config) shareable() bool {
+	return c.ShareClient && c.DialContext == nil
+}
+
+// shareKey identifies the clients that sessions connecting to service may share.
+// The credentials are included, but only as part of a digest.
+func (c *Config) shareKey(service string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %q %q %q %t %q %q %q %q %t %q %q %q %t %q %d %d %d %t %t",
+		service, c.Token, c.SessionTicket, c.CertFile, c.KeyFile, c.Insecure,
+		c.Thumbprint, c.CAFile, c.CAData, c.Proxy, c.ReadOnly, c.UserAgent,
+		c.VimNamespace, c.VimVersion, c.STSIssueToken, c.STSURL,
+		c.ConnectTimeout, c.ConnectRetries, c.ConnectRetryDelay, c.DebugSOAP, c.stickySession())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// adopt takes a reference to the shared client for service, if there is one and
+// it's still authenticated, returning whether the session now uses it
+func (s *Session) adopt(ctx context.Context, service string) bool {
+	e := sharedClients.acquire(s.shareKey(service))
+	if e == nil {
+		return false
+	}
+
+	if us, err := e.client.SessionManager.UserSession(ctx); err != nil || us == nil {
+		// expired, so make way for a new one
+		sharedClients.forget(e)
+		s.releaseShared(e)
+		return false
+	}
+
+	s.l.Lock()
+	s.Client = e.client
+	s.shared = e
+	s.loggedOut = false
+	s.anonymous = false
+	s.stopKeepalive = nil
+	s.keepalive = e.keepalive
+	s.kind = serverKind(e.client.ServiceContent.About)
+	s.ServerCertificates = e.certs
+	s.l.Unlock()
+
+	s.Finder = find.NewFinder(s.Vim25(), s.finderAll())
+
+	s.caps.Lock()
+	s.isVC = nil
+	s.isVSAN = nil
+	s.caps.Unlock()
+
+	return true
+}
+
+// share registers the session's newly connected client for service so that
+// other sessions may adopt it, handing over the keepalive with it
+func (s *Session) share(service string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.shared = sharedClients.add(s.shareKey(service), s.Client, s.stopKeepalive)
+	s.shared.certs = s.ServerCertificates
+	s.shared.keepalive = s.keepalive
+	s.stopKeepalive = nil
+}
+
+// releaseShared drops the session's reference to e, stopping its keepalive if
+// it was the last, and returns whether it was
+func (s *Session) releaseShared(e *sharedClient) bool {
+	if !sharedClients.release(e) {
+		return false
+	}
+
+	if e.stop != nil {
+		close(e.stop)
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/vic/pkg/vsphere/test/env"
+)
+
+func TestClientRegistry(t *testing.T) {
+	r := &clientRegistry{clients: make(map[string]*sharedClient)}
+	client := &govmomi.Client{}
+
+	assert.Nil(t, r.acquire("key"))
+
+	e := r.add("key", client, nil)
+	assert.Equal(t, e, r.acquire("key"))
+	assert.Equal(t, 2, e.refs)
+
+	assert.False(t, r.release(e))
+	assert.True(t, r.release(e))
+
+	// the last release unregisters it
+	assert.Nil(t, r.acquire("key"))
+
+	// a forgotten client isn't handed out, but its holders keep it
+	e = r.add("key", client, nil)
+	r.forget(e)
+	assert.Nil(t, r.acquire("key"))
+	assert.True(t, r.release(e))
+}
+
+func TestShareKey(t *testing.T) {
+	c := &Config{}
+	assert.Equal(t, c.shareKey("https://user:pass@vc/sdk"), c.shareKey("https://user:pass@vc/sdk"))
+	assert.NotEqual(t, c.shareKey("https://user:pass@vc/sdk"), c.shareKey("https://user:other@vc/sdk"))
+	assert.NotEqual(t, c.shareKey("https://user:pass@vc/sdk"), (&Config{ReadOnly: true}).shareKey("https://user:pass@vc/sdk"))
+
+	// as do the dial options
+	assert.NotEqual(t, c.shareKey("https://user:pass@vc/sdk"), (&Config{ConnectTimeout: time.Second}).shareKey("https://user:pass@vc/sdk"))
+	assert.NotEqual(t, c.shareKey("https://user:pass@vc/sdk"), (&Config{ConnectRetries: 3}).shareKey("https://user:pass@vc/sdk"))
+	assert.NotEqual(t, c.shareKey("https://user:pass@vc/sdk"), (&Config{StickySession: new(bool)}).shareKey("https://user:pass@vc/sdk"))
+
+	// the credentials only appear digested
+	assert.NotContains(t, c.shareKey("https://user:pass@vc/sdk"), "pass")
+}
+
+func TestShareable(t *testing.T) {
+	assert.False(t, (&Config{}).shareable())
+	assert.True(t, (&Config{ShareClient: true}).shareable())
+
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return net.Dial(network, addr)
+	}
+	assert.False(t, (&Config{ShareClient: true, DialContext: dial}).shareable())
+}
+
+func TestShareClient(t *testing.T) {
+	ctx := context.Background()
+
+	config := &Config{
+		Service:     env.URL(t),
+		Insecure:    true,
+		ShareClient: true,
+	}
+
+	first, err := NewSession(config).Connect(ctx)
+	if err != nil {
+		t.Logf("%+v", err.Error())
+		t.SkipNow()
+	}
+
+	second, err := NewSession(config).Connect(ctx)
+	if !assert.NoError(t, err) {
+		first.Logout(ctx)
+		return
+	}
+	assert.Equal(t, first.Client, second.Client)
+
+	// the server session outlives the first logout as the second still holds it
+	assert.NoError(t, first.Logout(ctx))
+	assert.NoError(t, second.Ping(ctx))
+
+	client := second.Client
+	assert.NoError(t, second.Logout(ctx))
+
+	us, err := client.SessionManager.UserSession(ctx)
+	assert.True(t, err != nil || us == nil, "the last logout did not end the server session")
+}
@@ -0,0 +1,166 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// SnapshotRef is a managed object reference along with its inventory path,
+// where the object records one
+type SnapshotRef struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	Path  string `json:"path,omitempty"`
+}
+
+// SessionSnapshot records the resources cached by a session, as returned by
+// Snapshot, in a form that can be serialized as JSON. Resources that weren't
+// cached are nil.
+type SessionSnapshot struct {
+	// InstanceUUID identifies the vCenter the references belong to, and is
+	// empty for ESXi
+	InstanceUUID   string `json:"instanceUUID,omitempty"`
+	Product        string `json:"product,omitempty"`
+	ProductVersion string `json:"productVersion,omitempty"`
+	APIVersion     string `json:"apiVersion,omitempty"`
+
+	Datacenter *SnapshotRef `json:"datacenter,omitempty"`
+	Cluster    *SnapshotRef `json:"cluster,omitempty"`
+	Datastore  *SnapshotRef `json:"datastore,omitempty"`
+	Host       *SnapshotRef `json:"host,omitempty"`
+	Network    *SnapshotRef `json:"network,omitempty"`
+	Pool       *SnapshotRef `json:"pool,omitempty"`
+	VMFolder   *SnapshotRef `json:"vmFolder,omitempty"`
+}
+
+// Snapshot returns the references of the cached resources and the server's
+// product and version
+func (s *Session) Snapshot() SessionSnapshot {
+	about := s.about()
+
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	snap := SessionSnapshot{
+		InstanceUUID:   about.InstanceUuid,
+		Product:        about.FullName,
+		ProductVersion: about.Version,
+		APIVersion:     about.ApiVersion,
+	}
+
+	if s.Datacenter != nil {
+		// the vendored Datacenter doesn't record its path
+		snap.Datacenter = snapshotRef(s.Datacenter.Reference(), "")
+	}
+	if s.Cluster != nil {
+		snap.Cluster = snapshotRef(s.Cluster.Reference(), s.Cluster.InventoryPath)
+	}
+	if s.Datastore != nil {
+		snap.Datastore = snapshotRef(s.Datastore.Reference(), s.Datastore.InventoryPath)
+	}
+	if s.Host != nil {
+		snap.Host = snapshotRef(s.Host.Reference(), s.Host.InventoryPath)
+	}
+	if s.Network != nil {
+		snap.Network = snapshotRef(s.Network.Reference(), networkPath(s.Network))
+	}
+	if s.Pool != nil {
+		snap.Pool = snapshotRef(s.Pool.Reference(), s.Pool.InventoryPath)
+	}
+	if s.VMFolder != nil {
+		snap.VMFolder = snapshotRef(s.VMFolder.Reference(), s.VMFolder.InventoryPath)
+	}
+
+	return snap
+}
+
+// RestoreSnapshot returns a session wrapping client, as NewSessionFromClient
+// does, with the resources recorded in snap cached, skipping the lookups of
+// Populate. The references aren't checked, so any that no longer exist only
+// fail once used. An error is returned if snap was taken of another vCenter.
+func RestoreSnapshot(client *govmomi.Client, snap SessionSnapshot) (*Session, error) {
+	about := client.ServiceContent.About
+	if snap.InstanceUUID != "" && about.InstanceUuid != "" && snap.InstanceUUID != about.InstanceUuid {
+		return nil, errors.Errorf("Snapshot was taken of vCenter %s, not %s", snap.InstanceUUID, about.InstanceUuid)
+	}
+
+	s := NewSessionFromClient(client, nil)
+	c := client.Client
+
+	if r := snap.Datacenter; r != nil {
+		s.Datacenter = object.NewDatacenter(c, r.reference())
+		s.Finder.SetDatacenter(s.Datacenter)
+	}
+	if r := snap.Cluster; r != nil {
+		s.Cluster = object.NewComputeResource(c, r.reference())
+		s.Cluster.InventoryPath = r.Path
+	}
+	if r := snap.Datastore; r != nil {
+		s.Datastore = object.NewDatastore(c, r.reference())
+		s.Datastore.InventoryPath = r.Path
+		s.Datastores = []*object.Datastore{s.Datastore}
+	}
+	if r := snap.Host; r != nil {
+		s.Host = object.NewHostSystem(c, r.reference())
+		s.Host.InventoryPath = r.Path
+	}
+	if r := snap.Network; r != nil {
+		switch r.Type {
+		case "DistributedVirtualPortgroup":
+			pg := object.NewDistributedVirtualPortgroup(c, r.reference())
+			pg.InventoryPath = r.Path
+			s.Network = pg
+		default:
+			network := object.NewNetwork(c, r.reference())
+			network.InventoryPath = r.Path
+			s.Network = network
+		}
+		s.Networks = []object.NetworkReference{s.Network}
+	}
+	if r := snap.Pool; r != nil {
+		s.Pool = object.NewResourcePool(c, r.reference())
+		s.Pool.InventoryPath = r.Path
+	}
+	if r := snap.VMFolder; r != nil {
+		s.VMFolder = object.NewFolder(c, r.reference())
+		s.VMFolder.InventoryPath = r.Path
+	}
+
+	return s, nil
+}
+
+func snapshotRef(ref types.ManagedObjectReference, path string) *SnapshotRef {
+	return &SnapshotRef{Type: ref.Type, Value: ref.Value, Path: path}
+}
+
+func (r *SnapshotRef) reference() types.ManagedObjectReference {
+	return types.ManagedObjectReference{Type: r.Type, Value: r.Value}
+}
+
+// networkPath returns the inventory path of network, if it's one of the types
+// that records it
+func networkPath(network object.NetworkReference) string {
+	switch n := network.(type) {
+	case *object.Network:
+		return n.InventoryPath
+	case *object.DistributedVirtualPortgroup:
+		return n.InventoryPath
+	}
+	return ""
+}
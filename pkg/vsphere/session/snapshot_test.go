@@ -0,0 +1,79 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestSnapshot(t *testing.T) {
+	client := &govmomi.Client{Client: &vim25.Client{}}
+	client.ServiceContent.About = types.AboutInfo{
+		FullName:     "VMware vCenter Server 6.0.0 build-3339083",
+		Version:      "6.0.0",
+		ApiVersion:   "6.0",
+		ApiType:      "VirtualCenter",
+		OsType:       "linux-x64",
+		InstanceUuid: "0f3d5d2c-8e1a-4e2b-9a6f-4c1b7a0e3d21",
+	}
+
+	s := NewSessionFromClient(client, nil)
+	s.Datacenter = object.NewDatacenter(client.Client, types.ManagedObjectReference{Type: "Datacenter", Value: "datacenter-2"})
+	s.Pool = object.NewResourcePool(client.Client, types.ManagedObjectReference{Type: "ResourcePool", Value: "resgroup-8"})
+	s.Pool.InventoryPath = "/dc1/host/cluster1/Resources"
+	pg := object.NewDistributedVirtualPortgroup(client.Client, types.ManagedObjectReference{Type: "DistributedVirtualPortgroup", Value: "dvportgroup-11"})
+	pg.InventoryPath = "/dc1/network/pg1"
+	s.Network = pg
+
+	snap := s.Snapshot()
+	assert.Equal(t, "6.0", snap.APIVersion)
+	assert.Nil(t, snap.Host, "Resources that aren't cached should be nil")
+
+	// the snapshot survives serialization
+	b, err := json.Marshal(snap)
+	require.NoError(t, err)
+
+	var decoded SessionSnapshot
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, snap, decoded)
+
+	restored, err := RestoreSnapshot(client, decoded)
+	require.NoError(t, err)
+
+	assert.Equal(t, s.Datacenter.Reference(), restored.Datacenter.Reference())
+	assert.Equal(t, s.Pool.Reference(), restored.Pool.Reference())
+	assert.Equal(t, s.Pool.InventoryPath, restored.Pool.InventoryPath)
+	assert.Nil(t, restored.Host)
+
+	network, ok := restored.Network.(*object.DistributedVirtualPortgroup)
+	if assert.True(t, ok, "Expected a portgroup, got %T", restored.Network) {
+		assert.Equal(t, pg.Reference(), network.Reference())
+		assert.Equal(t, "pg1", network.Name())
+	}
+
+	// a snapshot of another vCenter is refused
+	decoded.InstanceUUID = "7a1e0c4b-3f2d-4d8e-b6a9-1e5c3f7d9b02"
+	_, err = RestoreSnapshot(client, decoded)
+	assert.Error(t, err)
+}
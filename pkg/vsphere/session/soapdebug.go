@@ -0,0 +1,131 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+// soapSecrets match the credentials that pass through the client: the first
+// group of each is kept and the rest replaced
+var soapSecrets = []*regexp.Regexp{
+	// Login and the UsernameToken of STS requests
+	regexp.MustCompile(`(?is)(<(?:\w+:)?password(?:\s[^>]*)?>).*?(?:</(?:\w+:)?password>)`),
+	// SAML tokens, in LoginByToken requests and STS responses
+	regexp.MustCompile(`(?s)(<(?:\w+:)?Assertion[\s>]).*?</(?:\w+:)?Assertion>`),
+	// CloneSession requests and AcquireCloneTicket responses
+	regexp.MustCompile(`(?s)(<cloneTicket>).*?</cloneTicket>`),
+	regexp.MustCompile(`(?s)(<AcquireCloneTicketResponse[^>]*>\s*<returnval>)[^<]*</returnval>`),
+}
+
+// redactSOAP returns body with the soapSecrets masked
+func redactSOAP(body []byte) []byte {
+	for _, re := range soapSecrets {
+		body = re.ReplaceAll(body, []byte("${1}"+redacted))
+	}
+	return body
+}
+
+// soapDebug writes the body of each request and its response to w, redacted,
+// before passing them on
+type soapDebug struct {
+	http.RoundTripper
+
+	// mu keeps the output of concurrent requests apart
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (d *soapDebug) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper mustn't modify the request it's given
+	r := new(http.Request)
+	*r = *req
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	d.write(fmt.Sprintf("--> %s %s", req.Method, req.URL), body)
+
+	res, err := d.RoundTripper.RoundTrip(r)
+	if err != nil {
+		d.write(fmt.Sprintf("<-- %s", err), nil)
+		return nil, err
+	}
+
+	body, err = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	d.write(fmt.Sprintf("<-- %s", res.Status), body)
+	return res, nil
+}
+
+func (d *soapDebug) write(line string, body []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fmt.Fprintln(d.w, line)
+	if len(body) > 0 {
+		d.w.Write(redactSOAP(body))
+		fmt.Fprintln(d.w)
+	}
+}
+
+// configureDebug writes the client's requests and responses to DebugWriter if
+// DebugSOAP is set. The transport is wrapped, so this must be the last
+// configuration of it.
+func (s *Session) configureDebug(sc *soap.Client) {
+	if !s.DebugSOAP {
+		return
+	}
+
+	w := s.DebugWriter
+	if w == nil {
+		w = os.Stderr
+	}
+
+	transport := sc.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	sc.Transport = &soapDebug{RoundTripper: transport, w: w}
+}
+
+// withoutDebug returns the transport rt wraps if it's a soapDebug, otherwise rt
+func withoutDebug(rt http.RoundTripper) http.RoundTripper {
+	if d, ok := rt.(*soapDebug); ok {
+		return d.RoundTripper
+	}
+	return rt
+}
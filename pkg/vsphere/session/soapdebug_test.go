@@ -0,0 +1,83 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestDebugSOAP(t *testing.T) {
+	server := serviceContentServer()
+	defer server.Close()
+
+	var out bytes.Buffer
+	config := &Config{
+		Service:     "root:s3cret@" + strings.TrimPrefix(server.URL, "https://") + "/sdk",
+		Insecure:    true,
+		DebugSOAP:   true,
+		DebugWriter: &out,
+	}
+
+	s, err := NewSession(config).Connect(context.Background())
+	require.NoError(t, err)
+	defer s.Logout(context.Background())
+
+	debug := out.String()
+	assert.Contains(t, debug, "--> POST "+server.URL+"/sdk")
+	assert.Contains(t, debug, "<RetrieveServiceContent")
+	assert.Contains(t, debug, "<-- 200 OK")
+	assert.Contains(t, debug, "VMware vCenter Server 6.0.0", "Responses should be captured")
+
+	// the login is captured, but not the password
+	assert.Contains(t, debug, "<Login")
+	assert.NotContains(t, debug, "s3cret")
+
+	// nothing is written without DebugSOAP
+	out.Reset()
+	config.DebugSOAP = false
+	s, err = NewSession(config).Connect(context.Background())
+	require.NoError(t, err)
+	defer s.Logout(context.Background())
+	assert.Empty(t, out.String())
+}
+
+func TestRedactSOAP(t *testing.T) {
+	tests := []struct {
+		body   string
+		secret string
+	}{
+		{`<Login xmlns="urn:vim25"><userName>root</userName><password>s3cret</password></Login>`, "s3cret"},
+		{`<wsse:UsernameToken><wsse:Username>root</wsse:Username><wsse:Password>s3cret</wsse:Password></wsse:UsernameToken>`, "s3cret"},
+		{`<wst:RequestedSecurityToken><saml2:Assertion xmlns:saml2="urn:oasis:names:tc:SAML:2.0:assertion" ID="_1">s3cret</saml2:Assertion></wst:RequestedSecurityToken>`, "s3cret"},
+		{`<CloneSession xmlns="urn:vim25"><_this>SessionManager</_this><cloneTicket>cst-s3cret</cloneTicket></CloneSession>`, "s3cret"},
+		{`<AcquireCloneTicketResponse xmlns="urn:vim25"><returnval>cst-s3cret</returnval></AcquireCloneTicketResponse>`, "s3cret"},
+	}
+
+	for _, test := range tests {
+		redacted := string(redactSOAP([]byte(test.body)))
+		assert.NotContains(t, redacted, test.secret)
+		assert.Contains(t, redacted, "xxxxx")
+	}
+
+	// the rest is left alone
+	body := `<RetrieveServiceContent xmlns="urn:vim25"><_this type="ServiceInstance">ServiceInstance</_this></RetrieveServiceContent>`
+	assert.Equal(t, body, string(redactSOAP([]byte(body))))
+}
@@ -0,0 +1,202 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/xml"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+const (
+	wstNamespace = "http://docs.oasis-open.org/ws-sx/ws-trust/200512"
+
+	// the STS of the default SSO domain, on the host of the SDK
+	defaultSTSPath = "/sts/STSService/vsphere.local"
+
+	// how long issued tokens are requested for, and how long before expiry
+	// they're replaced rather than reused
+	stsTokenLifetime = time.Hour
+	stsTokenMargin   = time.Minute
+)
+
+// issuedToken is a bearer token obtained from the STS
+type issuedToken struct {
+	token   string
+	expires time.Time
+}
+
+// stsResponse is the part of the STS response to an Issue request that we need,
+// the token being kept verbatim as it's signed
+type stsResponse struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    struct {
+		Fault    *soap.Fault `xml:"Fault"`
+		Response struct {
+			Expires string `xml:"Lifetime>Expires"`
+			Token   struct {
+				Assertion string `xml:",innerxml"`
+			} `xml:"RequestedSecurityToken"`
+		} `xml:"RequestSecurityTokenResponseCollection>RequestSecurityTokenResponse"`
+	} `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+}
+
+// IssuedTokenExpiry returns when the token last obtained from the STS expires,
+// or the zero time if none has been, as STSIssueToken isn't set
+func (s *Session) IssuedTokenExpiry() time.Time {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	if s.issued == nil {
+		return time.Time{}
+	}
+	return s.issued.expires
+}
+
+// stsToken returns the token last issued to the session, unless it's about to
+// expire, in which case another is obtained for user
+func (s *Session) stsToken(ctx context.Context, client *govmomi.Client, user *url.Userinfo) (string, error) {
+	s.l.RLock()
+	issued := s.issued
+	s.l.RUnlock()
+
+	if issued != nil && time.Now().Add(stsTokenMargin).Before(issued.expires) {
+		return issued.token, nil
+	}
+
+	issued, err := s.issueToken(ctx, client, user, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	s.l.Lock()
+	s.issued = issued
+	s.l.Unlock()
+
+	return issued.token, nil
+}
+
+// issueToken requests a bearer token for user from the STS, through the http
+// client of client so that the same TLS and proxy settings apply
+func (s *Session) issueToken(ctx context.Context, client *govmomi.Client, user *url.Userinfo, now time.Time) (*issuedToken, error) {
+	if user == nil {
+		return nil, errors.New("Issuing a token requires a user name and password in Service")
+	}
+
+	password, ok := user.Password()
+	if !ok {
+		return nil, errors.New("Issuing a token requires a user name and password in Service")
+	}
+
+	sc := client.Client.Client
+
+	stsURL := s.STSURL
+	if stsURL == "" {
+		u := *sc.URL()
+		u.Path = defaultSTSPath
+		u.User = nil
+		stsURL = u.String()
+	}
+
+	body := stsRequest(user.Username(), password, now)
+	req, err := http.NewRequest("POST", stsURL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(`Content-Type`, `text/xml; charset="utf-8"`)
+	req.Header.Set(`SOAPAction`, wstNamespace+"/RST/Issue")
+
+	res, err := ctxhttp.Do(ctx, &sc.Client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusInternalServerError:
+		// faults are returned with a 500 and decoded below
+	default:
+		return nil, errors.Errorf("Token issue failed: %s", res.Status)
+	}
+
+	var resBody stsResponse
+	if err = xml.NewDecoder(res.Body).Decode(&resBody); err != nil {
+		return nil, err
+	}
+
+	if f := resBody.Body.Fault; f != nil {
+		return nil, errors.Errorf("Token issue failed: %s", f.String)
+	}
+
+	token := strings.TrimSpace(resBody.Body.Response.Token.Assertion)
+	if token == "" {
+		return nil, errors.New("Token issue failed: the STS returned no token")
+	}
+
+	// the lifetime granted may be shorter than that requested
+	expires, err := time.Parse(time.RFC3339Nano, resBody.Body.Response.Expires)
+	if err != nil {
+		expires = now.Add(stsTokenLifetime)
+	}
+
+	return &issuedToken{token: token, expires: expires}, nil
+}
+
+// stsRequest returns the WS-Trust request for a bearer token, authenticated
+// with username and password
+func stsRequest(username, password string, now time.Time) string {
+	const stamp = "2006-01-02T15:04:05.000Z"
+
+	created := now.UTC().Format(stamp)
+
+	return fmt.Sprintf(`%s<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:wsse="%s" xmlns:wsu="%s" xmlns:wst="%s">`+
+		`<soapenv:Header><wsse:Security>`+
+		`<wsu:Timestamp><wsu:Created>%s</wsu:Created><wsu:Expires>%s</wsu:Expires></wsu:Timestamp>`+
+		`<wsse:UsernameToken><wsse:Username>%s</wsse:Username><wsse:Password>%s</wsse:Password></wsse:UsernameToken>`+
+		`</wsse:Security></soapenv:Header>`+
+		`<soapenv:Body><wst:RequestSecurityToken>`+
+		`<wst:TokenType>urn:oasis:names:tc:SAML:2.0:assertion</wst:TokenType>`+
+		`<wst:RequestType>%s/Issue</wst:RequestType>`+
+		`<wst:Lifetime><wsu:Created>%s</wsu:Created><wsu:Expires>%s</wsu:Expires></wst:Lifetime>`+
+		`<wst:Renewing Allow="false" OK="false"></wst:Renewing>`+
+		`<wst:Delegatable>false</wst:Delegatable>`+
+		`<wst:KeyType>%s/Bearer</wst:KeyType>`+
+		`</wst:RequestSecurityToken></soapenv:Body></soapenv:Envelope>`,
+		xml.Header, wsseNamespace, wsuNamespace, wstNamespace,
+		created, now.Add(tokenRequestLifetime).UTC().Format(stamp),
+		escapeXML(username), escapeXML(password),
+		wstNamespace,
+		created, now.Add(stsTokenLifetime).UTC().Format(stamp),
+		wstNamespace)
+}
+
+// escapeXML returns s escaped for use as XML character data
+func escapeXML(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,160 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+const (
+	stsAssertion = `<saml2:Assertion xmlns:saml2="urn:oasis:names:tc:SAML:2.0:assertion" ID="_issued"></saml2:Assertion>`
+
+	stsIssueResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<S:Envelope xmlns:S="http://schemas.xmlsoap.org/soap/envelope/">
+<S:Body><wst:RequestSecurityTokenResponseCollection xmlns:wst="http://docs.oasis-open.org/ws-sx/ws-trust/200512" xmlns:wsu="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">
+<wst:RequestSecurityTokenResponse><wst:TokenType>urn:oasis:names:tc:SAML:2.0:assertion</wst:TokenType>
+<wst:Lifetime><wsu:Created>2016-04-01T00:00:00.000Z</wsu:Created><wsu:Expires>2016-04-01T00:30:00.000Z</wsu:Expires></wst:Lifetime>
+<wst:RequestedSecurityToken>` + stsAssertion + `</wst:RequestedSecurityToken>
+</wst:RequestSecurityTokenResponse></wst:RequestSecurityTokenResponseCollection></S:Body>
+</S:Envelope>`
+
+	stsFault = `<?xml version="1.0" encoding="UTF-8"?>
+<S:Envelope xmlns:S="http://schemas.xmlsoap.org/soap/envelope/">
+<S:Body><S:Fault><faultcode>ns0:FailedAuthentication</faultcode><faultstring>Authentication failed</faultstring></S:Fault></S:Body>
+</S:Envelope>`
+)
+
+// stsServer serves the SDK and STS of a VC, counting the tokens issued and
+// the logins made with them
+type stsServer struct {
+	mu     sync.Mutex
+	issued int
+	logins int
+	esx    bool
+}
+
+func (f *stsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/xml")
+	switch {
+	case r.URL.Path == defaultSTSPath && strings.Contains(string(body), "<wsse:Password>pass</wsse:Password>"):
+		f.issued++
+		w.Write([]byte(stsIssueResponse))
+	case r.URL.Path == defaultSTSPath:
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(stsFault))
+	case strings.Contains(string(body), "<RetrieveServiceContent "):
+		if f.esx {
+			w.Write([]byte(strings.Replace(serviceContentResponse, "VirtualCenter", "HostAgent", 1)))
+			return
+		}
+		w.Write([]byte(serviceContentResponse))
+	case strings.Contains(string(body), "<LoginByToken ") && strings.Contains(string(body), stsAssertion):
+		f.logins++
+		w.Write([]byte(tokenResponse))
+	case strings.Contains(string(body), "<Logout "):
+		w.Write([]byte(logoutResponse))
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(notImplementedFault))
+	}
+}
+
+func (f *stsServer) counts() (issued, logins int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.issued, f.logins
+}
+
+func TestSTSIssueToken(t *testing.T) {
+	ctx := context.Background()
+
+	f := &stsServer{}
+	server := httptest.NewTLSServer(f)
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	config := &Config{Service: "root:pass@" + host + "/sdk", Insecure: true, STSIssueToken: true}
+
+	s, err := NewSession(config).Connect(ctx)
+	require.NoError(t, err)
+
+	issued, logins := f.counts()
+	assert.Equal(t, 1, issued)
+	assert.Equal(t, 1, logins)
+	assert.Equal(t, time.Date(2016, 4, 1, 0, 30, 0, 0, time.UTC), s.IssuedTokenExpiry())
+
+	// tokens that haven't expired are reused
+	s.issued.expires = time.Now().Add(time.Hour)
+	require.NoError(t, s.login(ctx, s.Client, nil))
+
+	issued, logins = f.counts()
+	assert.Equal(t, 1, issued)
+	assert.Equal(t, 2, logins)
+
+	// and expired ones replaced
+	s.issued.expires = time.Now()
+	require.NoError(t, s.login(ctx, s.Client, url.UserPassword("root", "pass")))
+
+	issued, logins = f.counts()
+	assert.Equal(t, 2, issued)
+	assert.Equal(t, 3, logins)
+
+	assert.NoError(t, s.Logout(ctx))
+
+	// the STS rejecting the credentials fails the login
+	config.Service = "root:wrong@" + host + "/sdk"
+	_, err = NewSession(config).Connect(ctx)
+	if assert.Error(t, err) {
+		assert.True(t, errors.Is(err, ErrLoginFailed), "%s", err)
+		assert.Contains(t, err.Error(), "Authentication failed")
+	}
+
+	// ESXi has no STS
+	f.mu.Lock()
+	f.esx = true
+	f.mu.Unlock()
+	config.Service = "root:pass@" + host + "/sdk"
+	_, err = NewSession(config).Connect(ctx)
+	assert.True(t, errors.Is(err, ErrTokenAuthUnsupportedOnESXi), "%s", err)
+}
+
+func TestSTSIssueTokenConfig(t *testing.T) {
+	assert.Error(t, (&Config{Service: "u:p@localhost", STSIssueToken: true, Token: "<token/>"}).Validate())
+	assert.Error(t, (&Config{Service: "u:p@localhost", STSIssueToken: true, STSURL: "localhost/sts"}).Validate())
+	assert.NoError(t, (&Config{Service: "u:p@localhost", STSIssueToken: true, STSURL: "https://psc/sts/STSService/corp.local"}).Validate())
+
+	// the STS requires a password
+	s := NewSession(&Config{STSIssueToken: true})
+	_, err := s.issueToken(context.Background(), nil, nil, time.Now())
+	assert.Error(t, err)
+}
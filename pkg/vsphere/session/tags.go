@@ -0,0 +1,143 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const (
+	tagCategoryPath    = "/com/vmware/cis/tagging/category"
+	tagPath            = "/com/vmware/cis/tagging/tag"
+	tagAssociationPath = "/com/vmware/cis/tagging/tag-association"
+)
+
+// TagCategory is a vSphere tag category
+type TagCategory struct {
+	ID              string   `json:"id,omitempty"`
+	Name            string   `json:"name,omitempty"`
+	Description     string   `json:"description,omitempty"`
+	Cardinality     string   `json:"cardinality,omitempty"`
+	AssociableTypes []string `json:"associable_types,omitempty"`
+}
+
+// Tag is a vSphere tag, which belongs to a TagCategory
+type Tag struct {
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	CategoryID  string `json:"category_id,omitempty"`
+}
+
+// tagObject identifies a managed object to the tagging API
+type tagObject struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+func newTagObject(ref types.ManagedObjectReference) tagObject {
+	return tagObject{ID: ref.Value, Type: ref.Type}
+}
+
+// TagManager queries and manages vSphere tags and their attachment to objects
+type TagManager struct {
+	c *RestClient
+}
+
+// TagManager returns a TagManager using the session's REST client
+func (s *Session) TagManager(ctx context.Context) (*TagManager, error) {
+	c, err := s.RestClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &TagManager{c: c}, nil
+}
+
+// ListCategories returns the IDs of all tag categories
+func (m *TagManager) ListCategories(ctx context.Context) ([]string, error) {
+	var ids []string
+	err := m.c.Do(ctx, http.MethodGet, tagCategoryPath, nil, &ids)
+	return ids, err
+}
+
+// GetCategory returns the tag category with the given ID
+func (m *TagManager) GetCategory(ctx context.Context, id string) (*TagCategory, error) {
+	category := &TagCategory{}
+	if err := m.c.Do(ctx, http.MethodGet, tagCategoryPath+"/id:"+id, nil, category); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// ListTags returns the IDs of all tags
+func (m *TagManager) ListTags(ctx context.Context) ([]string, error) {
+	var ids []string
+	err := m.c.Do(ctx, http.MethodGet, tagPath, nil, &ids)
+	return ids, err
+}
+
+// GetTag returns the tag with the given ID
+func (m *TagManager) GetTag(ctx context.Context, id string) (*Tag, error) {
+	tag := &Tag{}
+	if err := m.c.Do(ctx, http.MethodGet, tagPath+"/id:"+id, nil, tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// AttachTag attaches the tag with the given ID to ref
+func (m *TagManager) AttachTag(ctx context.Context, id string, ref types.ManagedObjectReference) error {
+	spec := struct {
+		ObjectID tagObject `json:"object_id"`
+	}{newTagObject(ref)}
+	return m.c.Do(ctx, http.MethodPost, tagAssociationPath+"/id:"+id+"?~action=attach", spec, nil)
+}
+
+// DetachTag detaches the tag with the given ID from ref
+func (m *TagManager) DetachTag(ctx context.Context, id string, ref types.ManagedObjectReference) error {
+	spec := struct {
+		ObjectID tagObject `json:"object_id"`
+	}{newTagObject(ref)}
+	return m.c.Do(ctx, http.MethodPost, tagAssociationPath+"/id:"+id+"?~action=detach", spec, nil)
+}
+
+// ListAttachedTags returns the IDs of the tags attached to ref
+func (m *TagManager) ListAttachedTags(ctx context.Context, ref types.ManagedObjectReference) ([]string, error) {
+	spec := struct {
+		ObjectID tagObject `json:"object_id"`
+	}{newTagObject(ref)}
+
+	var ids []string
+	err := m.c.Do(ctx, http.MethodPost, tagAssociationPath+"?~action=list-attached-tags", spec, &ids)
+	return ids, err
+}
+
+// ListAttachedObjects returns the objects the tag with the given ID is attached to
+func (m *TagManager) ListAttachedObjects(ctx context.Context, id string) ([]types.ManagedObjectReference, error) {
+	var objects []tagObject
+	if err := m.c.Do(ctx, http.MethodPost, tagAssociationPath+"/id:"+id+"?~action=list-attached-objects", nil, &objects); err != nil {
+		return nil, err
+	}
+
+	refs := make([]types.ManagedObjectReference, len(objects))
+	for i, o := range objects {
+		refs[i] = types.ManagedObjectReference{Type: o.Type, Value: o.ID}
+	}
+	return refs, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/task"
+	"github.com/vmware/govmomi/vim25/progress"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// TaskManager returns the server's TaskManager, through which recent tasks can
+// be read. The vendored govmomi has no TaskManager type, so it is returned as
+// an object.Common for use with Properties. ErrSessionExpired is returned if
+// the session isn't connected or the server has no TaskManager.
+func (s *Session) TaskManager() (object.Common, error) {
+	client := s.client()
+	if client == nil || client.ServiceContent.TaskManager == nil {
+		return object.Common{}, ErrSessionExpired
+	}
+	return object.NewCommon(client.Client, *client.ServiceContent.TaskManager), nil
+}
+
+// WaitForTask waits for t to complete, returning its final TaskInfo. If the
+// task fails the TaskInfo is returned along with the task's error. Waiting
+// stops with ctx's error if ctx is done first.
+func (s *Session) WaitForTask(ctx context.Context, t *object.Task) (*types.TaskInfo, error) {
+	return s.WaitForTaskWithProgress(ctx, t, nil)
+}
+
+// WaitForTaskWithProgress waits for t as WaitForTask does, calling fn
+// with the completion percentage each time it advances. The calls are made in
+// order and never concurrently, and have all been made by the time this
+// returns. The last call reports 100 if the task succeeded.
+func (s *Session) WaitForTaskWithProgress(ctx context.Context, t *object.Task, fn func(percent int)) (*types.TaskInfo, error) {
+	pc := s.PropertyCollector()
+	if pc == nil {
+		return nil, ErrSessionExpired
+	}
+
+	if fn == nil {
+		return task.Wait(ctx, t.Reference(), pc, nil)
+	}
+
+	// intermediate reports are dropped by the sender if we fall behind, the
+	// buffer just makes that less likely
+	reports := make(chan progress.Report, 16)
+	done := make(chan struct{})
+
+	last := -1
+	go func() {
+		defer close(done)
+
+		// task.Wait closes reports when it returns, whatever the outcome
+		for r := range reports {
+			// the server resets progress once the task completes, so only report advances
+			if percent := int(r.Percentage()); percent > last {
+				last = percent
+				fn(percent)
+			}
+		}
+	}()
+
+	sink := progress.SinkFunc(func() chan<- progress.Report { return reports })
+	info, err := task.Wait(ctx, t.Reference(), pc, sink)
+	<-done
+
+	if err == nil && last != 100 {
+		fn(100)
+	}
+	return info, err
+}
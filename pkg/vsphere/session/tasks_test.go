@@ -0,0 +1,124 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// taskRoundTripper answers the property collector calls made while waiting on
+// a task, reporting each of infos in turn and then blocking until cancelled
+type taskRoundTripper struct {
+	infos []types.TaskInfo
+}
+
+func (f *taskRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	pc := types.ManagedObjectReference{Type: "PropertyCollector", Value: "session[1]"}
+
+	switch res := res.(type) {
+	case *methods.CreatePropertyCollectorBody:
+		res.Res = &types.CreatePropertyCollectorResponse{Returnval: pc}
+	case *methods.CreateFilterBody:
+		res.Res = &types.CreateFilterResponse{}
+	case *methods.DestroyPropertyCollectorBody:
+		res.Res = &types.DestroyPropertyCollectorResponse{}
+	case *methods.WaitForUpdatesExBody:
+		if len(f.infos) == 0 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		info := f.infos[0]
+		f.infos = f.infos[1:]
+
+		change := types.PropertyChange{Name: "info", Op: types.PropertyChangeOpAssign, Val: info}
+		res.Res = &types.WaitForUpdatesExResponse{
+			Returnval: &types.UpdateSet{
+				FilterSet: []types.PropertyFilterUpdate{
+					{ObjectSet: []types.ObjectUpdate{{ChangeSet: []types.PropertyChange{change}}}},
+				},
+			},
+		}
+	}
+	return nil
+}
+
+func taskSession(infos ...types.TaskInfo) (*Session, *object.Task) {
+	rt := &taskRoundTripper{infos: infos}
+	client := &vim25.Client{RoundTripper: rt}
+
+	s := NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+	return s, object.NewTask(client, types.ManagedObjectReference{Type: "Task", Value: "task-1"})
+}
+
+func TestWaitForTaskWithProgress(t *testing.T) {
+	s, task := taskSession(
+		types.TaskInfo{State: types.TaskInfoStateRunning, Progress: 10},
+		types.TaskInfo{State: types.TaskInfoStateRunning, Progress: 50},
+		// progress is no longer reported once the task completes
+		types.TaskInfo{State: types.TaskInfoStateSuccess},
+	)
+
+	var reported []int
+	info, err := s.WaitForTaskWithProgress(context.Background(), task, func(percent int) {
+		reported = append(reported, percent)
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, types.TaskInfoStateSuccess, info.State)
+	assert.Equal(t, []int{10, 50, 100}, reported)
+}
+
+func TestWaitForTaskWithProgressCancel(t *testing.T) {
+	s, task := taskSession(types.TaskInfo{State: types.TaskInfoStateRunning, Progress: 10})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var reported []int
+	_, err := s.WaitForTaskWithProgress(ctx, task, func(percent int) {
+		reported = append(reported, percent)
+		cancel()
+	})
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, []int{10}, reported, "No completion should be reported once cancelled")
+}
+
+func TestTaskManager(t *testing.T) {
+	_, err := NewSession(&Config{}).TaskManager()
+	assert.Equal(t, ErrSessionExpired, err)
+
+	// a client whose service content lacks the TaskManager
+	s, _ := taskSession()
+	_, err = s.TaskManager()
+	assert.Equal(t, ErrSessionExpired, err)
+
+	ref := types.ManagedObjectReference{Type: "TaskManager", Value: "TaskManager"}
+	s.Client.ServiceContent.TaskManager = &ref
+	tm, err := s.TaskManager()
+	if assert.NoError(t, err) {
+		assert.Equal(t, ref, tm.Reference())
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// AcquireCloneTicket returns a ticket with which another process may join the
+// session's identity through Config.SessionTicket, without logging in. Tickets
+// can only be used once, and expire shortly after they are acquired.
+func (s *Session) AcquireCloneTicket(ctx context.Context) (string, error) {
+	client := s.client()
+	if client == nil {
+		return "", ErrSessionExpired
+	}
+
+	req := types.AcquireCloneTicket{
+		This: *client.ServiceContent.SessionManager,
+	}
+
+	res, err := methods.AcquireCloneTicket(ctx, client, &req)
+	if err != nil {
+		return "", err
+	}
+	return res.Returnval, nil
+}
+
+// cloneSession logs client in with Config.SessionTicket
+func (s *Session) cloneSession(ctx context.Context, client *govmomi.Client) error {
+	req := types.CloneSession{
+		This:        *client.ServiceContent.SessionManager,
+		CloneTicket: s.SessionTicket,
+	}
+
+	_, err := methods.CloneSession(ctx, client, &req)
+	if isInvalidLogin(err) {
+		return errors.Errorf("Session ticket was rejected, it may have expired or already been used: %s", err)
+	}
+	return err
+}
+
+// isInvalidLogin returns whether err is an InvalidLogin fault
+func isInvalidLogin(err error) bool {
+	if !soap.IsSoapFault(err) {
+		return false
+	}
+
+	switch soap.ToSoapFault(err).VimFault().(type) {
+	case types.InvalidLogin, *types.InvalidLogin:
+		return true
+	}
+	return false
+}
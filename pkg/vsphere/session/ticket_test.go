@@ -0,0 +1,114 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const (
+	cloneTicketResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><AcquireCloneTicketResponse xmlns="urn:vim25"><returnval>cst-VCT-52</returnval></AcquireCloneTicketResponse></soapenv:Body>
+</soapenv:Envelope>`
+
+	invalidLoginFault = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><soapenv:Fault><faultcode>ServerFaultCode</faultcode><faultstring>Cannot complete login due to an incorrect user name or password.</faultstring><detail><InvalidLoginFault xmlns="urn:vim25" xsi:type="InvalidLogin" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"></InvalidLoginFault></detail></soapenv:Fault></soapenv:Body>
+</soapenv:Envelope>`
+)
+
+// ticketSession returns a session whose client talks to server, without logging in
+func ticketSession(server *httptest.Server, config *Config) *Session {
+	u, _ := url.Parse(server.URL + "/sdk")
+	sc := soap.NewClient(u, true)
+	ref := types.ManagedObjectReference{Type: "SessionManager", Value: "SessionManager"}
+
+	config.Service = u.String()
+	s := NewSession(config)
+	s.Client = &govmomi.Client{
+		Client: &vim25.Client{
+			Client:         sc,
+			RoundTripper:   sc,
+			ServiceContent: types.ServiceContent{SessionManager: &ref},
+		},
+	}
+	return s
+}
+
+func TestAcquireCloneTicket(t *testing.T) {
+	_, err := NewSession(&Config{}).AcquireCloneTicket(context.Background())
+	assert.Equal(t, ErrSessionExpired, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(cloneTicketResponse))
+	}))
+	defer server.Close()
+
+	ticket, err := ticketSession(server, &Config{}).AcquireCloneTicket(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "cst-VCT-52", ticket)
+}
+
+func TestCloneSession(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(invalidLoginFault))
+	}))
+	defer server.Close()
+
+	s := ticketSession(server, &Config{SessionTicket: "cst-VCT-52"})
+
+	err := s.login(context.Background(), s.Client, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "expired")
+	}
+
+	assert.Contains(t, body, "CloneSession")
+	assert.Contains(t, body, "cst-VCT-52")
+}
+
+func TestSessionTicketValidate(t *testing.T) {
+	config := &Config{
+		Service:       "https://vc.example.com/sdk",
+		SessionTicket: "cst-VCT-52",
+		Token:         "<saml2:Assertion/>",
+	}
+
+	err := config.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Session ticket")
+	}
+
+	config.Token = ""
+	assert.NoError(t, config.Validate())
+	assert.NotContains(t, config.String(), "cst-VCT-52")
+}
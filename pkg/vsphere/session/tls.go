@@ -0,0 +1,220 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// Thumbprint returns the SHA-1 thumbprint of cert in the colon separated form
+// displayed by vSphere, e.g. "AB:CD:...".
+func Thumbprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	return colonHex(sum[:])
+}
+
+// ThumbprintFromPEM returns the SHA-1 thumbprint of the first certificate in the
+// PEM encoded file at path.
+func ThumbprintFromPEM(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	for block, rest := pem.Decode(b); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return "", errors.Errorf("Unable to parse certificate in %s: %s", path, err)
+		}
+		return Thumbprint(cert), nil
+	}
+
+	return "", errors.Errorf("No certificate found in %s", path)
+}
+
+func colonHex(b []byte) string {
+	parts := make([]string, len(b))
+	for i := range b {
+		parts[i] = strings.ToUpper(hex.EncodeToString(b[i : i+1]))
+	}
+	return strings.Join(parts, ":")
+}
+
+// normalizeThumbprint strips separators and case from a thumbprint so that the
+// forms produced by different tools compare equal
+func normalizeThumbprint(thumbprint string) string {
+	return strings.ToUpper(strings.Replace(strings.TrimSpace(thumbprint), ":", "", -1))
+}
+
+// validThumbprint returns whether thumbprint is a SHA-1 or SHA-256 hex digest
+func validThumbprint(thumbprint string) bool {
+	t := normalizeThumbprint(thumbprint)
+	if len(t) != 2*sha1.Size && len(t) != 2*sha256.Size {
+		return false
+	}
+
+	_, err := hex.DecodeString(t)
+	return err == nil
+}
+
+// verifyThumbprint returns a certificate verifier that accepts only a leaf
+// certificate matching thumbprint, in either SHA-1 or SHA-256 form
+func verifyThumbprint(thumbprint string) func([][]byte, [][]*x509.Certificate) error {
+	expected := normalizeThumbprint(thumbprint)
+
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("Server presented no certificate")
+		}
+
+		var actual string
+		if len(expected) == 2*sha256.Size {
+			sum := sha256.Sum256(rawCerts[0])
+			actual = hex.EncodeToString(sum[:])
+		} else {
+			sum := sha1.Sum(rawCerts[0])
+			actual = hex.EncodeToString(sum[:])
+		}
+
+		if strings.ToUpper(actual) != expected {
+			return errors.Errorf("Server certificate thumbprint %s does not match %s", strings.ToUpper(actual), expected)
+		}
+		return nil
+	}
+}
+
+// rootCAs returns the pool of CAs configured by CAFile and CAData, or nil if
+// neither is set so that the system roots are used
+func (c *Config) rootCAs() (*x509.CertPool, error) {
+	if c.CAFile == "" && len(c.CAData) == 0 {
+		return nil, nil
+	}
+
+	pool := x509.NewCertPool()
+
+	if c.CAFile != "" {
+		b, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Errorf("Unable to read CA file %s: %s", c.CAFile, err)
+		}
+
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.Errorf("No PEM encoded certificates found in CA file %s", c.CAFile)
+		}
+	}
+
+	if len(c.CAData) > 0 && !pool.AppendCertsFromPEM(c.CAData) {
+		return nil, errors.New("No PEM encoded certificates found in CA data")
+	}
+
+	return pool, nil
+}
+
+// configureTLS applies the TLS related settings from Config to the soap client.
+// Client certificates set on sc are left in place.
+func (s *Session) configureTLS(sc *soap.Client) error {
+	t, ok := sc.Transport.(*http.Transport)
+	if !ok || t.TLSClientConfig == nil {
+		// not https
+		return nil
+	}
+
+	pool, err := s.rootCAs()
+	if err != nil {
+		return err
+	}
+	if pool != nil {
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	for _, warning := range s.Warnings() {
+		log.Warn(warning)
+	}
+
+	if s.Thumbprint != "" {
+		// the thumbprint check replaces verification against the trusted roots
+		t.TLSClientConfig.InsecureSkipVerify = true
+		t.TLSClientConfig.VerifyPeerCertificate = verifyThumbprint(s.Thumbprint)
+	}
+
+	return nil
+}
+
+// certCapture records the certificate chain the server presented in the TLS
+// handshake, whether or not it was then trusted
+type certCapture struct {
+	mu    sync.Mutex
+	certs []*x509.Certificate
+}
+
+// chain returns the recorded chain, leaf first
+func (c *certCapture) chain() []*x509.Certificate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.certs
+}
+
+func (c *certCapture) record(raw [][]byte) {
+	var certs []*x509.Certificate
+	for _, der := range raw {
+		if cert, err := x509.ParseCertificate(der); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.certs = certs
+}
+
+// captureCertificates records the chain presented in each handshake made by the
+// soap client into c, ahead of any thumbprint check. When the chain is verified
+// against the trusted roots, as it is unless Insecure or Thumbprint is set, a
+// chain that fails that verification isn't recorded.
+func captureCertificates(sc *soap.Client, c *certCapture) {
+	t, ok := sc.Transport.(*http.Transport)
+	if !ok || t.TLSClientConfig == nil {
+		// not https
+		return
+	}
+
+	verify := t.TLSClientConfig.VerifyPeerCertificate
+	t.TLSClientConfig.VerifyPeerCertificate = func(raw [][]byte, chains [][]*x509.Certificate) error {
+		c.record(raw)
+
+		if verify != nil {
+			return verify(raw, chains)
+		}
+		return nil
+	}
+}
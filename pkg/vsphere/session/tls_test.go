@@ -0,0 +1,163 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tlsServer returns a TLS server that fails every request, which is enough to
+// observe whether the handshake succeeded
+func tlsServer() *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not a vSphere endpoint", http.StatusNotFound)
+	}))
+}
+
+func TestThumbprintFromPEM(t *testing.T) {
+	server := tlsServer()
+	defer server.Close()
+
+	f, err := ioutil.TempFile("", "thumbprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+	f.Close()
+
+	thumbprint, err := ThumbprintFromPEM(f.Name())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, Thumbprint(server.Certificate()), thumbprint)
+	assert.True(t, validThumbprint(thumbprint))
+	assert.True(t, validThumbprint(strings.ToLower(strings.Replace(thumbprint, ":", "", -1))))
+	assert.False(t, validThumbprint("AB:CD"))
+}
+
+func TestConnectThumbprint(t *testing.T) {
+	ctx := context.Background()
+
+	server := tlsServer()
+	defer server.Close()
+
+	thumbprint := Thumbprint(server.Certificate())
+
+	// a matching thumbprint gets us past the handshake to the (failing) SOAP request
+	_, err := NewSession(&Config{Service: server.URL, Thumbprint: thumbprint, Insecure: true}).Connect(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "404")
+	}
+
+	// whereas a mismatch fails the handshake
+	wrong := strings.Repeat("AB:", 19) + "AB"
+	_, err = NewSession(&Config{Service: server.URL, Thumbprint: wrong}).Connect(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "does not match")
+	}
+}
+
+func TestConfigWarnings(t *testing.T) {
+	assert.Empty(t, (&Config{Insecure: true}).Warnings())
+	assert.Empty(t, (&Config{Thumbprint: strings.Repeat("AB:", 19) + "AB"}).Warnings())
+
+	// the thumbprint wins, which is valid but worth telling the user
+	config := &Config{Service: "https://localhost/sdk", Insecure: true, Thumbprint: strings.Repeat("AB:", 19) + "AB"}
+	assert.NoError(t, config.Validate())
+	if warnings := config.Warnings(); assert.Len(t, warnings, 1) {
+		assert.Contains(t, warnings[0], "ignoring insecure")
+	}
+}
+
+func TestConnectCA(t *testing.T) {
+	ctx := context.Background()
+
+	server := tlsServer()
+	defer server.Close()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	// trusting the self-signed server certificate gets us past the handshake
+	_, err := NewSession(&Config{Service: server.URL, CAData: ca}).Connect(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "404")
+	}
+
+	// the system roots don't know it
+	_, err = NewSession(&Config{Service: server.URL}).Connect(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "certificate")
+	}
+
+	// and broken CA configuration is reported up front
+	_, err = NewSession(&Config{Service: server.URL, CAData: []byte("garbage")}).Connect(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "CA data")
+	}
+
+	_, err = NewSession(&Config{Service: server.URL, CAFile: "/nonexistent/ca.pem"}).Connect(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "/nonexistent/ca.pem")
+	}
+
+	// as is a CA that insecure would leave unused
+	_, err = NewSession(&Config{Service: server.URL, CAData: ca, Insecure: true}).Connect(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cannot be combined with insecure")
+	}
+}
+
+func TestConnectServerCertificates(t *testing.T) {
+	server := serviceContentServer()
+	defer server.Close()
+
+	ctx := context.Background()
+	leaf := server.TLS.Certificates[0].Certificate[0]
+
+	// recorded even though it wasn't verified
+	s, err := NewSession(&Config{Service: "root:pass@" + server.URL[len("https://"):] + "/sdk", Insecure: true}).Connect(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, s.ServerCertificates, 1) {
+		assert.Equal(t, leaf, s.ServerCertificates[0].Raw)
+	}
+
+	// so that its thumbprint can be pinned
+	thumbprint := Thumbprint(s.ServerCertificates[0])
+	s, err = NewSession(&Config{Service: "root:pass@" + server.URL[len("https://"):] + "/sdk", Thumbprint: thumbprint}).Connect(ctx)
+	if assert.NoError(t, err) {
+		assert.Len(t, s.ServerCertificates, 1)
+	}
+
+	// nothing is kept from a failed connection
+	s = NewSession(&Config{Service: server.URL + "/sdk", Thumbprint: strings.Repeat("00:", 19) + "00"})
+	_, err = s.Connect(ctx)
+	assert.Error(t, err)
+	assert.Empty(t, s.ServerCertificates)
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/govmomi/vim25/xml"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+const (
+	wsseNamespace = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	wsuNamespace  = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+
+	// how long the server should accept the login request for
+	tokenRequestLifetime = 5 * time.Minute
+)
+
+// tokenEnvelope is a SOAP envelope carrying a WS-Security header, which the
+// vendored soap.Client has no way to send
+type tokenEnvelope struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Header  struct {
+		XMLName  xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Header"`
+		Security string   `xml:",innerxml"`
+	}
+	Body struct {
+		XMLName xml.Name            `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+		Req     *types.LoginByToken `xml:"urn:vim25 LoginByToken"`
+	}
+}
+
+// securityHeader returns the WS-Security header presenting the bearer token
+func securityHeader(token string, now time.Time) string {
+	const stamp = "2006-01-02T15:04:05.000Z"
+
+	return fmt.Sprintf(`<wsse:Security xmlns:wsse="%s" xmlns:wsu="%s">`+
+		`<wsu:Timestamp><wsu:Created>%s</wsu:Created><wsu:Expires>%s</wsu:Expires></wsu:Timestamp>`+
+		`%s</wsse:Security>`,
+		wsseNamespace, wsuNamespace,
+		now.UTC().Format(stamp), now.Add(tokenRequestLifetime).UTC().Format(stamp),
+		strings.TrimSpace(token))
+}
+
+// loginByToken exchanges the SAML bearer token, that of Config.Token or one
+// issued by the STS, for a session. The session cookie is kept in the soap
+// client's cookie jar, so subsequent calls made by the client are authenticated.
+func (s *Session) loginByToken(ctx context.Context, client *govmomi.Client, token string) error {
+	sc := client.Client.Client
+
+	env := tokenEnvelope{}
+	env.Header.Security = securityHeader(token, time.Now())
+	env.Body.Req = &types.LoginByToken{This: *client.ServiceContent.SessionManager}
+
+	b, err := xml.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	body := io.MultiReader(strings.NewReader(xml.Header), bytes.NewReader(b))
+	req, err := http.NewRequest("POST", sc.URL().String(), body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(`Content-Type`, `text/xml; charset="utf-8"`)
+	req.Header.Set(`SOAPAction`, fmt.Sprintf("%s/%s", sc.Namespace, sc.Version))
+
+	res, err := ctxhttp.Do(ctx, &sc.Client, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusInternalServerError:
+		// faults are returned with a 500 and decoded below
+	default:
+		return errors.Errorf("Token login failed: %s", res.Status)
+	}
+
+	var resBody methods.LoginByTokenBody
+	dec := xml.NewDecoder(res.Body)
+	dec.TypeFunc = types.TypeFunc()
+	if err = dec.Decode(&soap.Envelope{Body: &resBody}); err != nil {
+		return err
+	}
+
+	if f := resBody.Fault(); f != nil {
+		return soap.WrapSoapFault(f)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const tokenResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><LoginByTokenResponse xmlns="urn:vim25"><returnval><key>52</key><userName>VSPHERE.LOCAL\automation</userName></returnval></LoginByTokenResponse></soapenv:Body>
+</soapenv:Envelope>`
+
+func TestLoginByToken(t *testing.T) {
+	token := `<saml2:Assertion xmlns:saml2="urn:oasis:names:tc:SAML:2.0:assertion" ID="_1"></saml2:Assertion>`
+
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+
+		http.SetCookie(w, &http.Cookie{Name: "vmware_soap_session", Value: "token-session"})
+		w.Write([]byte(tokenResponse))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/sdk")
+	sc := soap.NewClient(u, true)
+	ref := types.ManagedObjectReference{Type: "SessionManager", Value: "SessionManager"}
+
+	s := NewSession(&Config{Service: u.String(), Token: token})
+	s.Client = &govmomi.Client{
+		Client: &vim25.Client{
+			Client:         sc,
+			RoundTripper:   sc,
+			ServiceContent: types.ServiceContent{SessionManager: &ref},
+		},
+	}
+
+	if !assert.NoError(t, s.loginByToken(context.Background(), s.Client, token)) {
+		return
+	}
+
+	assert.Contains(t, body, token, "token should be presented verbatim")
+	assert.Contains(t, body, "Security")
+	assert.Contains(t, body, "LoginByToken")
+
+	cookies := sc.Jar.Cookies(u)
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "token-session", cookies[0].Value)
+	}
+}
+
+func TestLoginByTokenFault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><soapenv:Fault><faultcode>ServerFaultCode</faultcode><faultstring>Invalid token</faultstring><detail><InvalidLoginFaultFault xmlns="urn:vim25" xsi:type="InvalidLogin" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"></InvalidLoginFaultFault></detail></soapenv:Fault></soapenv:Body>
+</soapenv:Envelope>`))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/sdk")
+	sc := soap.NewClient(u, true)
+	ref := types.ManagedObjectReference{Type: "SessionManager", Value: "SessionManager"}
+
+	s := NewSession(&Config{Service: u.String(), Token: "<token/>"})
+	s.Client = &govmomi.Client{
+		Client: &vim25.Client{Client: sc, ServiceContent: types.ServiceContent{SessionManager: &ref}},
+	}
+
+	err := s.loginByToken(context.Background(), s.Client, s.Token)
+	if assert.Error(t, err) {
+		assert.True(t, soap.IsSoapFault(err))
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+
+	"github.com/vmware/govmomi/vim25/progress"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// UploadFile uploads the local file at localPath to dsRelPath, a path on the
+// cached datastore, replacing any file already there
+func (s *Session) UploadFile(ctx context.Context, localPath, dsRelPath string) error {
+	return s.UploadFileWithProgress(ctx, localPath, dsRelPath, nil)
+}
+
+// UploadFileWithProgress uploads as UploadFile does, calling fn if not nil with
+// the percentage transferred each time it advances. The calls are made in order
+// and have all been made by the time this returns.
+//
+// The file is transferred through the service at DatastoreURL, authenticated by
+// the session itself, so the hosts needn't be reachable. The transfer is
+// abandoned should ctx be done before it completes. Read only sessions fail
+// with ErrReadOnly, as the transfer bypasses the SOAP methods they reject.
+func (s *Session) UploadFileWithProgress(ctx context.Context, localPath, dsRelPath string, fn func(percent int)) (err error) {
+	if s.ReadOnly {
+		return ErrReadOnly
+	}
+
+	u, err := s.DatastoreURL(ctx, dsRelPath)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	body, done := transferProgress(f, info.Size(), fn)
+	defer func() { done(err) }()
+
+	res, err := s.transfer(ctx, soap.DefaultUpload.Method, u, body, info.Size())
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// DownloadFile downloads dsRelPath, a path on the cached datastore, to the local
+// file at localPath, replacing any file already there
+func (s *Session) DownloadFile(ctx context.Context, dsRelPath, localPath string) error {
+	return s.DownloadFileWithProgress(ctx, dsRelPath, localPath, nil)
+}
+
+// DownloadFileWithProgress downloads as DownloadFile does, reporting progress
+// to fn and honouring ctx as UploadFileWithProgress does. The download is
+// written to a temporary file alongside localPath, renamed into place once
+// complete, so localPath never holds part of a file.
+func (s *Session) DownloadFileWithProgress(ctx context.Context, dsRelPath, localPath string, fn func(percent int)) (err error) {
+	u, err := s.DatastoreURL(ctx, dsRelPath)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.transfer(ctx, soap.DefaultDownload.Method, u, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	f, err := ioutil.TempFile(filepath.Dir(localPath), filepath.Base(localPath))
+	if err != nil {
+		return err
+	}
+
+	body, done := transferProgress(res.Body, res.ContentLength, fn)
+	defer func() { done(err) }()
+
+	_, err = io.Copy(f, body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), localPath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// transfer makes a request of the datastore file service at u with the session's
+// client, which authenticates it, returning the response if it succeeded
+func (s *Session) transfer(ctx context.Context, method string, u *url.URL, body io.Reader, length int64) (*http.Response, error) {
+	client := s.client()
+	if client == nil {
+		return nil, ErrSessionExpired
+	}
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.ContentLength = length
+		req.Header.Set("Content-Type", soap.DefaultUpload.Type)
+	}
+
+	res, err := ctxhttp.Do(ctx, &client.Client.Client.Client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return res, nil
+	}
+
+	res.Body.Close()
+	return nil, errors.New(res.Status)
+}
+
+// transferProgress returns r, reporting each advance in the percentage of size
+// read from it to fn if not nil, and a function to call with the outcome once
+// the transfer is over, which waits for the reports to have been made
+func transferProgress(r io.Reader, size int64, fn func(percent int)) (io.Reader, func(error)) {
+	if fn == nil {
+		return r, func(error) {}
+	}
+
+	reports := make(chan progress.Report)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		// the reader closes reports once it's done, whatever the outcome
+		last := -1
+		for r := range reports {
+			if percent := int(r.Percentage()); percent > last {
+				last = percent
+				fn(percent)
+			}
+		}
+	}()
+
+	pr := progress.NewReader(progress.SinkFunc(func() chan<- progress.Report { return reports }), r, size)
+	return pr, func(err error) {
+		pr.Done(err)
+		<-done
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// datastoreServer serves the names of the objects it's asked for, the name of
+// each being its value, and the files PUT under /folder
+func datastoreServer(files map[string][]byte, mu *sync.Mutex) *httptest.Server {
+	obj := regexp.MustCompile(`<obj type="([^"]+)">([^<]+)</obj>`)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if strings.HasPrefix(r.URL.Path, "/folder/") {
+			key := r.URL.Path + "?" + r.URL.RawQuery
+			switch r.Method {
+			case "PUT":
+				files[key], _ = ioutil.ReadAll(r.Body)
+				w.WriteHeader(http.StatusCreated)
+			case "GET":
+				b, ok := files[key]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Length", fmt.Sprint(len(b)))
+				w.Write(b)
+			}
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		m := obj.FindSubmatch(body)
+		if m == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(notImplementedFault))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<soapenv:Body><RetrievePropertiesResponse xmlns="urn:vim25"><returnval><obj type="%s">%s</obj>
+<propSet><name>name</name><val xsi:type="xsd:string">%s</val></propSet></returnval></RetrievePropertiesResponse></soapenv:Body>
+</soapenv:Envelope>`, m[1], m[2], m[2])
+	}))
+}
+
+func TestTransferFile(t *testing.T) {
+	var mu sync.Mutex
+	files := make(map[string][]byte)
+	server := datastoreServer(files, &mu)
+	defer server.Close()
+
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "transfer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "config.json")
+	content := []byte(`{"debug": true}`)
+	require.NoError(t, ioutil.WriteFile(local, content, 0600))
+
+	s := ticketSession(server, &Config{})
+	assert.Error(t, s.UploadFile(ctx, local, "vch/config.json"), "expected a failure without a datastore")
+
+	c := s.Vim25()
+	s.Datacenter = object.NewDatacenter(c, types.ManagedObjectReference{Type: "Datacenter", Value: "dc1"})
+	s.Datastore = object.NewDatastore(c, types.ManagedObjectReference{Type: "Datastore", Value: "ds1"})
+
+	var reported []int
+	require.NoError(t, s.UploadFileWithProgress(ctx, local, "/vch/config.json", func(percent int) {
+		reported = append(reported, percent)
+	}))
+	if assert.NotEmpty(t, reported) {
+		assert.Equal(t, 100, reported[len(reported)-1])
+	}
+
+	mu.Lock()
+	assert.Equal(t, content, files["/folder/vch/config.json?dcPath=dc1&dsName=ds1"])
+	mu.Unlock()
+
+	downloaded := filepath.Join(dir, "downloaded.json")
+	require.NoError(t, s.DownloadFile(ctx, "vch/config.json", downloaded))
+	b, err := ioutil.ReadFile(downloaded)
+	require.NoError(t, err)
+	assert.Equal(t, content, b)
+
+	// a failed transfer makes no progress reports
+	reported = nil
+	err = s.DownloadFileWithProgress(ctx, "vch/missing.log", filepath.Join(dir, "missing.log"), func(percent int) {
+		reported = append(reported, percent)
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "404")
+	}
+	assert.Empty(t, reported)
+}
+
+func TestTransferFileReadOnly(t *testing.T) {
+	var mu sync.Mutex
+	files := make(map[string][]byte)
+	server := datastoreServer(files, &mu)
+	defer server.Close()
+
+	s := ticketSession(server, &Config{ReadOnly: true})
+	c := s.Vim25()
+	s.Datacenter = object.NewDatacenter(c, types.ManagedObjectReference{Type: "Datacenter", Value: "dc1"})
+	s.Datastore = object.NewDatastore(c, types.ManagedObjectReference{Type: "Datastore", Value: "ds1"})
+
+	// the upload is rejected before the file is even opened
+	assert.Equal(t, ErrReadOnly, s.UploadFile(context.Background(), "does-not-exist", "vch/config.json"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Empty(t, files)
+}
+
+func TestTransferFileCancel(t *testing.T) {
+	names := datastoreServer(make(map[string][]byte), &sync.Mutex{})
+	defer names.Close()
+
+	// a file service that never answers until the client gives up
+	abandoned := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/folder/") {
+			names.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		// the connection is only watched once the body has been read
+		ioutil.ReadAll(r.Body)
+		<-r.Context().Done()
+		close(abandoned)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "transfer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "config.json")
+	require.NoError(t, ioutil.WriteFile(local, []byte(`{}`), 0600))
+
+	s := ticketSession(server, &Config{})
+	c := s.Vim25()
+	s.Datacenter = object.NewDatacenter(c, types.ManagedObjectReference{Type: "Datacenter", Value: "dc1"})
+	s.Datastore = object.NewDatastore(c, types.ManagedObjectReference{Type: "Datastore", Value: "ds1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, s.UploadFile(ctx, local, "vch/config.json"))
+
+	select {
+	case <-abandoned:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected the request to be abandoned")
+	}
+}
+
+func TestDownloadFileTruncated(t *testing.T) {
+	names := datastoreServer(make(map[string][]byte), &sync.Mutex{})
+	defer names.Close()
+
+	// a file service that drops the connection partway through the file
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/folder/") {
+			names.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", "1024")
+		w.Write([]byte(`{"debug":`))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "transfer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := ticketSession(server, &Config{})
+	c := s.Vim25()
+	s.Datacenter = object.NewDatacenter(c, types.ManagedObjectReference{Type: "Datacenter", Value: "dc1"})
+	s.Datastore = object.NewDatastore(c, types.ManagedObjectReference{Type: "Datastore", Value: "ds1"})
+
+	assert.Error(t, s.DownloadFile(context.Background(), "vch/config.json", filepath.Join(dir, "config.json")))
+
+	// neither the partial file nor the temporary one is left behind
+	infos, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, infos)
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net/http"
+
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+// userAgent sets the User-Agent header of each request before passing it on
+type userAgent struct {
+	agent string
+	http.RoundTripper
+}
+
+func (u *userAgent) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper mustn't modify the request it's given
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("User-Agent", u.agent)
+
+	return u.RoundTripper.RoundTrip(r)
+}
+
+// configureUserAgent identifies the client's requests with Config.UserAgent, if
+// set. The transport is wrapped, so this must follow any other configuration of it
+// bar configureDebug.
+func (s *Session) configureUserAgent(sc *soap.Client) {
+	if s.UserAgent == "" {
+		return
+	}
+
+	transport := sc.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	sc.Transport = &userAgent{agent: s.UserAgent, RoundTripper: transport}
+}
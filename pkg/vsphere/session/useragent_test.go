@@ -0,0 +1,54 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestUserAgent(t *testing.T) {
+	var mu sync.Mutex
+	var agents []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents = append(agents, r.UserAgent())
+		mu.Unlock()
+		http.Error(w, "not an sdk", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	_, err := NewSession(&Config{Service: server.URL + "/sdk", UserAgent: "vic-test/1.0"}).Connect(ctx)
+	assert.Error(t, err)
+
+	_, err = NewSession(&Config{Service: server.URL + "/sdk"}).Connect(ctx)
+	assert.Error(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if assert.Len(t, agents, 2) {
+		assert.Equal(t, "vic-test/1.0", agents[0])
+		assert.NotEqual(t, "vic-test/1.0", agents[1])
+	}
+}
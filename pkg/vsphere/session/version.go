@@ -0,0 +1,166 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// about returns the server's AboutInfo, retrieved with the ServiceContent
+// when the client was created, so no round trip is needed
+func (s *Session) about() types.AboutInfo {
+	client := s.client()
+	if client == nil || client.Client == nil {
+		return types.AboutInfo{}
+	}
+	return client.ServiceContent.About
+}
+
+// APIVersion returns the vSphere API version of the server, e.g. "6.0",
+// or an empty string if not connected
+func (s *Session) APIVersion() string {
+	return s.about().ApiVersion
+}
+
+// ProductVersion returns the product version and build of the server,
+// e.g. "6.0.0 build-3620759", or an empty string if not connected
+func (s *Session) ProductVersion() string {
+	about := s.about()
+	if about.Build == "" {
+		return about.Version
+	}
+	return about.Version + " build-" + about.Build
+}
+
+// AtLeast returns whether the server's API version is at least major.minor
+func (s *Session) AtLeast(major, minor int) bool {
+	return versionAtLeast(s.APIVersion(), major, minor)
+}
+
+// parseAPIVersion splits an API version such as "6.0" into its major and minor
+// parts, ignoring anything after the minor, e.g. the 1 of "5.1.1"
+func parseAPIVersion(version string) (major, minor int, ok bool) {
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return major, minor, true
+}
+
+// versionAtLeast returns whether the API version is at least major.minor
+func versionAtLeast(version string, major, minor int) bool {
+	maj, min, ok := parseAPIVersion(version)
+	if !ok {
+		return false
+	}
+
+	return maj > major || (maj == major && min >= minor)
+}
+
+// checkVimVersion returns an error if the server described by about is older
+// than the VimVersion requested, as it wouldn't understand the client
+func (s *Session) checkVimVersion(about types.AboutInfo) error {
+	if s.VimVersion == "" {
+		return nil
+	}
+
+	major, minor, ok := parseAPIVersion(s.VimVersion)
+	if !ok {
+		return errors.Errorf("Vim version %s must be of the form major.minor", s.VimVersion)
+	}
+
+	if !versionAtLeast(about.ApiVersion, major, minor) {
+		return errors.Errorf("Vim version %s is not supported by %s, whose API version is %s", s.VimVersion, about.FullName, about.ApiVersion)
+	}
+	return nil
+}
+
+// ServerKind distinguishes the kinds of server a session may be connected to
+type ServerKind int
+
+const (
+	// ServerUnknown is the kind of server not recognized, or of no server at all
+	ServerUnknown ServerKind = iota
+	// ServerESXi is a standalone ESXi host
+	ServerESXi
+	// ServerVCSA is the vCenter Server Appliance
+	ServerVCSA
+	// ServerVCWindows is vCenter Server installed on Windows
+	ServerVCWindows
+	// ServerVC is vCenter Server on an operating system not otherwise recognized
+	ServerVC
+)
+
+func (k ServerKind) String() string {
+	switch k {
+	case ServerUnknown:
+		return "unknown"
+	case ServerESXi:
+		return "ESXi"
+	case ServerVCSA:
+		return "vCenter Server Appliance"
+	case ServerVCWindows:
+		return "vCenter Server for Windows"
+	case ServerVC:
+		return "vCenter Server"
+	default:
+		return fmt.Sprintf("ServerKind(%d)", int(k))
+	}
+}
+
+// serverKind derives the kind of server from its AboutInfo
+func serverKind(about types.AboutInfo) ServerKind {
+	switch about.ApiType {
+	case "HostAgent":
+		// both ESXi and the long gone classic ESX are HostAgents
+		if about.ProductLineId == "embeddedEsx" || strings.HasPrefix(about.OsType, "vmnix") {
+			return ServerESXi
+		}
+	case "VirtualCenter":
+		switch {
+		case strings.HasPrefix(about.OsType, "linux"):
+			return ServerVCSA
+		case strings.HasPrefix(about.OsType, "win"):
+			return ServerVCWindows
+		default:
+			return ServerVC
+		}
+	}
+	return ServerUnknown
+}
+
+// ServerKind returns the kind of server the session is connected to, derived
+// from its AboutInfo when the client was created
+func (s *Session) ServerKind() ServerKind {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	return s.kind
+}
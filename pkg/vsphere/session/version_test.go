@@ -0,0 +1,105 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestVersion(t *testing.T) {
+	s := NewSession(&Config{})
+	assert.Equal(t, "", s.APIVersion())
+	assert.False(t, s.AtLeast(1, 0))
+
+	client := &vim25.Client{}
+	client.ServiceContent.About = types.AboutInfo{
+		ApiVersion: "6.0",
+		Version:    "6.0.0",
+		Build:      "3620759",
+	}
+	s = NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+
+	assert.Equal(t, "6.0", s.APIVersion())
+	assert.Equal(t, "6.0.0 build-3620759", s.ProductVersion())
+
+	assert.True(t, s.AtLeast(5, 5))
+	assert.True(t, s.AtLeast(6, 0))
+	assert.False(t, s.AtLeast(6, 5))
+	assert.False(t, s.AtLeast(7, 0))
+}
+
+func TestServerKind(t *testing.T) {
+	assert.Equal(t, ServerUnknown, NewSession(&Config{}).ServerKind())
+
+	kinds := []struct {
+		about types.AboutInfo
+		kind  ServerKind
+	}{
+		{types.AboutInfo{ApiType: "HostAgent", OsType: "vmnix-x86", ProductLineId: "embeddedEsx"}, ServerESXi},
+		{types.AboutInfo{ApiType: "VirtualCenter", OsType: "linux-x64", ProductLineId: "vpx"}, ServerVCSA},
+		{types.AboutInfo{ApiType: "VirtualCenter", OsType: "win32-x64", ProductLineId: "vpx"}, ServerVCWindows},
+		{types.AboutInfo{ApiType: "VirtualCenter", OsType: "beos", ProductLineId: "vpx"}, ServerVC},
+		{types.AboutInfo{ApiType: "Unexpected"}, ServerUnknown},
+	}
+
+	for _, k := range kinds {
+		client := &vim25.Client{}
+		client.ServiceContent.About = k.about
+		s := NewSessionFromClient(&govmomi.Client{Client: client}, nil)
+
+		assert.Equal(t, k.kind, s.ServerKind(), "%+v", k.about)
+	}
+
+	assert.Equal(t, "vCenter Server Appliance", ServerVCSA.String())
+	assert.Equal(t, "ServerKind(42)", ServerKind(42).String())
+}
+
+func TestVimVersion(t *testing.T) {
+	assert.Error(t, (&Config{Service: "https://vc/sdk", VimVersion: "six"}).Validate())
+	assert.NoError(t, (&Config{Service: "https://vc/sdk", VimVersion: "5.5"}).Validate())
+
+	var actions []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actions = append(actions, r.Header.Get("SOAPAction"))
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(serviceContentResponse))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	// the server's API version is 6.0
+	s := NewSession(&Config{Service: server.URL + "/sdk", Insecure: true, VimNamespace: "urn:vim25", VimVersion: "5.5"})
+	_, err := s.Probe(ctx)
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, actions) {
+		assert.Equal(t, "urn:vim25/5.5", actions[0])
+	}
+
+	s = NewSession(&Config{Service: server.URL + "/sdk", Insecure: true, VimVersion: "6.5"})
+	_, err = s.Probe(ctx)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "6.5 is not supported")
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/vic/pkg/errors"
+)
+
+// WatchProperties passes the changes to the properties ps of the object ref
+// refers to to fn until ctx is cancelled, starting with their current values.
+// The watch has a property collector of its own, destroyed when it returns.
+// ctx's error is returned once it's done, otherwise that of the collector.
+func (s *Session) WatchProperties(ctx context.Context, ref types.ManagedObjectReference, ps []string, fn func([]types.PropertyChange)) error {
+	if len(ps) == 0 {
+		return errors.New("No properties to watch")
+	}
+
+	pc := s.PropertyCollector()
+	if pc == nil {
+		return ErrSessionExpired
+	}
+
+	err := property.Wait(ctx, pc, ref, ps, func(changes []types.PropertyChange) bool {
+		fn(changes)
+		return false
+	})
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
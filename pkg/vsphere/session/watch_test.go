@@ -0,0 +1,151 @@
+// Copyright 2016 VMware, Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const (
+	createCollectorResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><CreatePropertyCollectorResponse xmlns="urn:vim25"><returnval type="PropertyCollector">session[52]1</returnval></CreatePropertyCollectorResponse></soapenv:Body>
+</soapenv:Envelope>`
+
+	createFilterResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><CreateFilterResponse xmlns="urn:vim25"><returnval type="PropertyFilter">session[52]2</returnval></CreateFilterResponse></soapenv:Body>
+</soapenv:Envelope>`
+
+	powerStateUpdate = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<soapenv:Body><WaitForUpdatesExResponse xmlns="urn:vim25"><returnval><version>1</version>
+<filterSet><filter type="PropertyFilter">session[52]2</filter><objectSet><kind>enter</kind><obj type="VirtualMachine">vm-42</obj>
+<changeSet><name>runtime.powerState</name><op>assign</op><val xsi:type="VirtualMachinePowerState">poweredOn</val></changeSet>
+</objectSet></filterSet></returnval></WaitForUpdatesExResponse></soapenv:Body>
+</soapenv:Envelope>`
+
+	destroyCollectorResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+<soapenv:Body><DestroyPropertyCollectorResponse xmlns="urn:vim25"></DestroyPropertyCollectorResponse></soapenv:Body>
+</soapenv:Envelope>`
+)
+
+// collectorServer reports a single change to each watch then holds the next
+// WaitForUpdatesEx until the client gives up, or fails it if fail is set
+type collectorServer struct {
+	mu        sync.Mutex
+	fail      bool
+	destroyed int
+}
+
+func (f *collectorServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	w.Header().Set("Content-Type", "text/xml")
+	switch {
+	case strings.Contains(string(body), "<RetrieveServiceContent "):
+		w.Write([]byte(serviceContentResponse))
+	case strings.Contains(string(body), "<Login "):
+		w.Write([]byte(loginResponse))
+	case strings.Contains(string(body), "<Logout "):
+		w.Write([]byte(logoutResponse))
+	case strings.Contains(string(body), "<CreatePropertyCollector "):
+		w.Write([]byte(createCollectorResponse))
+	case strings.Contains(string(body), "<CreateFilter "):
+		w.Write([]byte(createFilterResponse))
+	case strings.Contains(string(body), "<WaitForUpdatesEx "):
+		f.mu.Lock()
+		fail := f.fail
+		f.mu.Unlock()
+
+		switch {
+		case fail:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(notImplementedFault))
+		case !strings.Contains(string(body), "<version>1</version>"):
+			w.Write([]byte(powerStateUpdate))
+		default:
+			<-r.Context().Done()
+		}
+	case strings.Contains(string(body), "<DestroyPropertyCollector "):
+		f.mu.Lock()
+		f.destroyed++
+		f.mu.Unlock()
+		w.Write([]byte(destroyCollectorResponse))
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(notImplementedFault))
+	}
+}
+
+func (f *collectorServer) destroyedCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.destroyed
+}
+
+func TestWatchProperties(t *testing.T) {
+	f := &collectorServer{}
+	server := httptest.NewTLSServer(f)
+	defer server.Close()
+
+	config := &Config{Service: "root:pass@" + strings.TrimPrefix(server.URL, "https://") + "/sdk", Insecure: true}
+	s, err := NewSession(config).Connect(context.Background())
+	require.NoError(t, err)
+
+	vm := types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-42"}
+	ps := []string{"runtime.powerState"}
+
+	assert.Error(t, s.WatchProperties(context.Background(), vm, nil, func([]types.PropertyChange) {}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var changes []types.PropertyChange
+	err = s.WatchProperties(ctx, vm, ps, func(c []types.PropertyChange) {
+		changes = append(changes, c...)
+		// stop once the change is in
+		cancel()
+	})
+	assert.Equal(t, context.Canceled, err, "%s", err)
+
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, "runtime.powerState", changes[0].Name)
+		assert.Equal(t, types.VirtualMachinePowerStatePoweredOn, changes[0].Val)
+	}
+	assert.Equal(t, 1, f.destroyedCount(), "Expected the collector to be destroyed")
+
+	// collector failures are returned
+	f.mu.Lock()
+	f.fail = true
+	f.mu.Unlock()
+
+	err = s.WatchProperties(context.Background(), vm, ps, func([]types.PropertyChange) {})
+	assert.Error(t, err)
+	assert.NotEqual(t, context.Canceled, err)
+	assert.Equal(t, 2, f.destroyedCount(), "Expected the collector to be destroyed")
+}
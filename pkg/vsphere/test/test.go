@@ -40,6 +40,7 @@ func Session(ctx context.Context, t *testing.T) *session.Session {
 		HostPath:       "/ha-datacenter/host/*/*",
 		NetworkPath:    "/ha-datacenter/network/*",
 		PoolPath:       "/ha-datacenter/host/*/Resources",
+		RequireAll:     true,
 	}
 
 	session, err := session.NewSession(config).Create(ctx)
@@ -57,7 +57,7 @@ func NewImageStore(ctx context.Context, s *session.Session) (*ImageStore, error)
 
 	vis := &ImageStore{
 		dm: dm,
-		fm: object.NewFileManager(s.Vim25()),
+		fm: s.FileManager(),
 		s:  s,
 	}
 